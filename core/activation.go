@@ -0,0 +1,200 @@
+package core
+
+import (
+	"dexianta/tgnn/util"
+	"fmt"
+	"math"
+)
+
+const (
+	Sigmoid   Op = "sigmoid"
+	Tanh      Op = "tanh"
+	LeakyReLU Op = "leaky_relu"
+	ELU       Op = "elu"
+	GELU      Op = "gelu"
+	SiLU      Op = "silu"
+	Softplus  Op = "softplus"
+	Softsign  Op = "softsign"
+	HardTanh  Op = "hardtanh"
+)
+
+// activation is an element-wise function with its derivative, shared by V and Tensor
+// df gets both the input x and the output y, as some derivatives are cheaper from the output (e.g. sigmoid)
+type activation struct {
+	op Op
+	fn func(x float64) float64
+	df func(x, y float64) float64
+}
+
+func sigmoidAct() activation {
+	return activation{Sigmoid, util.Sigmoid, func(x, y float64) float64 { return y * (1 - y) }}
+}
+
+func tanhAct() activation {
+	return activation{Tanh, math.Tanh, func(x, y float64) float64 { return 1 - y*y }}
+}
+
+func leakyReLUAct(slope float64) activation {
+	return activation{LeakyReLU,
+		func(x float64) float64 {
+			if x > 0 {
+				return x
+			}
+			return slope * x
+		},
+		func(x, y float64) float64 {
+			if x > 0 {
+				return 1
+			}
+			return slope
+		}}
+}
+
+func eluAct(alpha float64) activation {
+	return activation{ELU,
+		func(x float64) float64 {
+			if x > 0 {
+				return x
+			}
+			return alpha * math.Expm1(x)
+		},
+		func(x, y float64) float64 {
+			if x > 0 {
+				return 1
+			}
+			return y + alpha // alpha * e^x
+		}}
+}
+
+// the gelu is x * Φ(x), where Φ is the cumulative distribution function of the standard normal distribution
+func geluAct() activation {
+	return activation{GELU,
+		func(x float64) float64 {
+			return 0.5 * x * (1 + math.Erf(x/math.Sqrt2))
+		},
+		func(x, y float64) float64 {
+			// Φ(x) + x * φ(x)
+			return 0.5*(1+math.Erf(x/math.Sqrt2)) + x*math.Exp(-x*x/2)/math.Sqrt(2*math.Pi)
+		}}
+}
+
+func siluAct() activation {
+	return activation{SiLU,
+		func(x float64) float64 {
+			return x * util.Sigmoid(x)
+		},
+		func(x, y float64) float64 {
+			s := util.Sigmoid(x)
+			return s * (1 + x*(1-s))
+		}}
+}
+
+func softplusAct() activation {
+	return activation{Softplus,
+		func(x float64) float64 {
+			// log(1 + e^x) without overflow
+			return math.Max(x, 0) + math.Log1p(math.Exp(-math.Abs(x)))
+		},
+		func(x, y float64) float64 {
+			return util.Sigmoid(x)
+		}}
+}
+
+func softsignAct() activation {
+	return activation{Softsign,
+		func(x float64) float64 {
+			return x / (1 + math.Abs(x))
+		},
+		func(x, y float64) float64 {
+			return 1 / ((1 + math.Abs(x)) * (1 + math.Abs(x)))
+		}}
+}
+
+func hardTanhAct(min, max float64) activation {
+	if min > max {
+		panic(fmt.Sprintf("hardtanh: min %v > max %v", min, max))
+	}
+	return activation{HardTanh,
+		func(x float64) float64 {
+			return math.Min(math.Max(x, min), max)
+		},
+		func(x, y float64) float64 {
+			if x > min && x < max {
+				return 1
+			}
+			return 0
+		}}
+}
+
+func (v *V) activate(a activation) *V {
+	return &V{
+		Data: a.fn(v.Data),
+		prev: &UnaryOp{
+			op: a.op,
+			v:  v,
+			df: a.df,
+		},
+	}
+}
+
+func (t Tensor) activate(a activation) Tensor {
+	return unaryOp(t, a.op, a.fn, a.df)
+}
+
+// Sigmoid is 1 / (1 + e^-x)
+func (v *V) Sigmoid() *V { return v.activate(sigmoidAct()) }
+
+func (v *V) Tanh() *V { return v.activate(tanhAct()) }
+
+// LeakyReLU is x for positive x, slope * x otherwise (pytorch uses 0.01 by default)
+func (v *V) LeakyReLU(slope float64) *V { return v.activate(leakyReLUAct(slope)) }
+
+// ELU is x for positive x, alpha * (e^x - 1) otherwise (pytorch uses 1 by default)
+func (v *V) ELU(alpha float64) *V { return v.activate(eluAct(alpha)) }
+
+// GELU is x * Φ(x), where Φ is the cumulative distribution function of the standard normal distribution
+func (v *V) GELU() *V { return v.activate(geluAct()) }
+
+// SiLU is x * sigmoid(x), also known as swish
+func (v *V) SiLU() *V { return v.activate(siluAct()) }
+
+// Swish is the same as SiLU
+func (v *V) Swish() *V { return v.SiLU() }
+
+// Softplus is log(1 + e^x), a smooth version of relu
+func (v *V) Softplus() *V { return v.activate(softplusAct()) }
+
+// Softsign is x / (1 + |x|)
+func (v *V) Softsign() *V { return v.activate(softsignAct()) }
+
+// HardTanh clamps x into [min, max] (pytorch uses [-1, 1] by default)
+func (v *V) HardTanh(min, max float64) *V { return v.activate(hardTanhAct(min, max)) }
+
+// Sigmoid is 1 / (1 + e^-x)
+func (t Tensor) Sigmoid() Tensor { return t.activate(sigmoidAct()) }
+
+func (t Tensor) Tanh() Tensor { return t.activate(tanhAct()) }
+
+// LeakyReLU is x for positive x, slope * x otherwise (pytorch uses 0.01 by default)
+func (t Tensor) LeakyReLU(slope float64) Tensor { return t.activate(leakyReLUAct(slope)) }
+
+// ELU is x for positive x, alpha * (e^x - 1) otherwise (pytorch uses 1 by default)
+func (t Tensor) ELU(alpha float64) Tensor { return t.activate(eluAct(alpha)) }
+
+// GELU is x * Φ(x), where Φ is the cumulative distribution function of the standard normal distribution
+func (t Tensor) GELU() Tensor { return t.activate(geluAct()) }
+
+// SiLU is x * sigmoid(x), also known as swish
+func (t Tensor) SiLU() Tensor { return t.activate(siluAct()) }
+
+// Swish is the same as SiLU
+func (t Tensor) Swish() Tensor { return t.SiLU() }
+
+// Softplus is log(1 + e^x), a smooth version of relu
+func (t Tensor) Softplus() Tensor { return t.activate(softplusAct()) }
+
+// Softsign is x / (1 + |x|)
+func (t Tensor) Softsign() Tensor { return t.activate(softsignAct()) }
+
+// HardTanh clamps x into [min, max] (pytorch uses [-1, 1] by default)
+func (t Tensor) HardTanh(min, max float64) Tensor { return t.activate(hardTanhAct(min, max)) }
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var activationSpecs = []struct {
+	name string
+	v    func(v *V) *V
+	t    func(t Tensor) Tensor
+}{
+	{"relu", (*V).ReLu, Tensor.ReLu},
+	{"sigmoid", (*V).Sigmoid, Tensor.Sigmoid},
+	{"tanh", (*V).Tanh, Tensor.Tanh},
+	{"leaky relu", func(v *V) *V { return v.LeakyReLU(0.01) }, func(t Tensor) Tensor { return t.LeakyReLU(0.01) }},
+	{"elu", func(v *V) *V { return v.ELU(1.5) }, func(t Tensor) Tensor { return t.ELU(1.5) }},
+	{"gelu", (*V).GELU, Tensor.GELU},
+	{"silu", (*V).SiLU, Tensor.SiLU},
+	{"swish", (*V).Swish, Tensor.Swish},
+	{"softplus", (*V).Softplus, Tensor.Softplus},
+	{"softsign", (*V).Softsign, Tensor.Softsign},
+	{"hardtanh", func(v *V) *V { return v.HardTanh(-1, 2) }, func(t Tensor) Tensor { return t.HardTanh(-1, 2) }},
+}
+
+// away from the kinks of relu, leaky relu, elu and hardtanh
+var activationInputs = []float64{-3.1, -1.2, -0.4, 0.3, 1.1, 2.7}
+
+func TestActivationGradV(t *testing.T) {
+	const eps = 1e-6
+	for _, spec := range activationSpecs {
+		t.Run(spec.name, func(t *testing.T) {
+			for _, x := range activationInputs {
+				// through a multiplication, so the incoming gradient isn't 1
+				a := Vx(x)
+				out := spec.v(a).Mul(Vx(3))
+				out.Backward()
+
+				expected := 3 * (spec.v(Vx(x+eps)).Data - spec.v(Vx(x-eps)).Data) / (2 * eps)
+				assert.InDelta(t, expected, a.Grad, 1e-5, "x = %v", x)
+			}
+		})
+	}
+}
+
+func TestActivationGradTensor(t *testing.T) {
+	for _, spec := range activationSpecs {
+		t.Run(spec.name, func(t *testing.T) {
+			x := NewTensor(activationInputs).SetRequiresGrad(true)
+			w := NewTensor(d1{1, -2, 3, -4, 5, -6})
+			fn := func(...Tensor) Tensor { return spec.t(x).Mul(w) }
+			assert.Nil(t, GradCheck(fn, []Tensor{x}, GradCheckOptions{Atol: 1e-5, Rtol: 1e-9}))
+
+			// the same values as V
+			out := spec.t(x).Data()
+			for i, in := range activationInputs {
+				assert.InDelta(t, spec.v(Vx(in)).Data, out[i], 1e-12)
+			}
+		})
+	}
+}
+
+func TestActivationValues(t *testing.T) {
+	x := NewTensor(d1{-1000, -1, 0, 1, 1000})
+
+	assert.Nil(t, EqualFloatArray(x.Sigmoid().Data(), []float64{0, 1 / (1 + math.E), 0.5, 1 / (1 + 1/math.E), 1}, 1e-12))
+	assert.Nil(t, EqualFloatArray(x.Softplus().Data(), []float64{0, math.Log1p(1 / math.E), math.Log(2),
+		1 + math.Log1p(1/math.E), 1000}, 1e-12))
+	assert.Nil(t, EqualFloatArray(x.LeakyReLU(0.1).Data(), []float64{-100, -0.1, 0, 1, 1000}, 1e-12))
+	assert.Nil(t, EqualFloatArray(x.ELU(1).Data(), []float64{-1, 1/math.E - 1, 0, 1, 1000}, 1e-12))
+	assert.Nil(t, EqualFloatArray(x.HardTanh(-1, 1).Data(), []float64{-1, -1, 0, 1, 1}, 1e-12))
+	assert.Nil(t, EqualFloatArray(x.Softsign().Data(), []float64{-1000. / 1001, -0.5, 0, 0.5, 1000. / 1001}, 1e-12))
+	assert.Nil(t, EqualFloatArray(x.GELU().Data(), []float64{0, -0.158655254, 0, 0.841344746, 1000}, 1e-9))
+
+	assert.Panics(t, func() { x.HardTanh(1, -1) })
+}
@@ -39,6 +39,7 @@ type ExpOp struct {
 type UnaryOp struct {
 	op Op
 	v  *V
+	df func(x, y float64) float64 // the derivative of the activations, from the input x and the output y
 }
 
 type NullOp struct{}
@@ -76,47 +77,11 @@ func (v *V) Backward() {
 	v.backward(1.)
 }
 
+// Zerograd resets the gradient of v and every node it depends on
 func (v *V) Zerograd() {
-	v.Grad = 0.
-
-	switch pr := v.prev.(type) {
-	case *BinaryOp:
-		switch pr.op {
-		case Add:
-			pr.l.Grad = 0
-			pr.r.Grad = 0
-			pr.l.Zerograd()
-			pr.r.Zerograd()
-		case Mul:
-			pr.l.Grad = 0
-			pr.r.Grad = 0
-			pr.l.Zerograd()
-			pr.r.Zerograd()
-		}
-	case *LogOp:
-		pr.v.Grad = 0
-		pr.v.Zerograd()
-	case *PowOp:
-		// x^n --> nx^n-1
-		pr.v.Grad = 0
-		pr.v.Zerograd()
-	case *ExpOp:
-		// e^x --> e^x
-		pr.v.Grad = 0
-		pr.v.Zerograd()
-	case *UnaryOp:
-		switch pr.op {
-		case ReLu:
-			pr.v.Grad = 0
-			pr.v.Zerograd()
-		default:
-			panic(fmt.Errorf("invalid op for UnaryOp: %T", pr.op))
-		}
-	case *NullOp:
-	default:
-		panic(fmt.Errorf("invalid op for prev: %T", pr))
+	for _, n := range v.topo() {
+		n.Grad = 0
 	}
-
 }
 
 // Back Propagation is the process to find out the gradient of local variable with regard to the final output of interest:
@@ -146,9 +111,81 @@ func (v *V) Zerograd() {
 // backward will traverse the computation graph and populate the gradient of each node
 // the special case are for the root, which is just 1
 // externalGrad is needed to kick-off the traverse
-// TODO: as golang does not seem to support tail call optimization, this will eventually stackoverflow.
-func (v *V) backward(accumulatedGrad float64) {
-	v.Grad = accumulatedGrad
+//
+// the graph is first flattened into a topological order (without recursion), so every node is visited exactly once,
+// after all the nodes depending on it have pushed their gradient into it.
+// leaf nodes accumulate across calls, intermediate nodes are reset so the same graph can be traversed again.
+func (v *V) backward(externalGrad float64) {
+	order := v.topo()
+	for _, n := range order {
+		if _, leaf := n.prev.(*NullOp); !leaf {
+			n.Grad = 0
+		}
+	}
+
+	v.Grad = externalGrad
+	for i := len(order) - 1; i >= 0; i-- {
+		order[i].propagate()
+	}
+}
+
+// topo returns all the nodes reachable from v in topological order, i.e. a node always comes after its operands,
+// which puts v itself at the very end.
+// an explicit stack is used instead of recursion, so deep graphs won't overflow the goroutine stack.
+func (v *V) topo() (ret []*V) {
+	type frame struct {
+		v        *V
+		expanded bool
+	}
+
+	visited := map[*V]bool{}
+	stack := []frame{{v: v}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if top.expanded {
+			ret = append(ret, top.v)
+			continue
+		}
+		if visited[top.v] {
+			continue
+		}
+		visited[top.v] = true
+
+		stack = append(stack, frame{v: top.v, expanded: true})
+		for _, c := range top.v.children() {
+			if !visited[c] {
+				stack = append(stack, frame{v: c})
+			}
+		}
+	}
+	return
+}
+
+// children returns the operands that produced v
+func (v *V) children() []*V {
+	switch pr := v.prev.(type) {
+	case *BinaryOp:
+		return []*V{pr.l, pr.r}
+	case *LogOp:
+		return []*V{pr.v}
+	case *PowOp:
+		return []*V{pr.v}
+	case *ExpOp:
+		return []*V{pr.v}
+	case *UnaryOp:
+		return []*V{pr.v}
+	case *NullOp:
+		return nil
+	default:
+		panic(fmt.Errorf("invalid op for prev: %T, v: %v", pr, *v))
+	}
+}
+
+// propagate pushes the gradient of v into its operands (one step of the chain rule)
+// it expects v.Grad to be complete, which is guaranteed by visiting the nodes in reversed topological order
+func (v *V) propagate() {
 	switch pr := v.prev.(type) {
 	case *BinaryOp:
 		switch pr.op {
@@ -157,28 +194,31 @@ func (v *V) backward(accumulatedGrad float64) {
 			// the way to calculate gradient is accumulated_grad * d(x + y)/dx = accumulated_grad
 			pr.l.Grad += v.Grad // if the Val were used multiple times, we need to accumulate the gradient
 			pr.r.Grad += v.Grad
-			pr.l.backward(pr.l.Grad)
-			pr.r.backward(pr.r.Grad)
 		case Mul:
 			// for multiplication, x * y
 			// the way to calculate gradient is accumulated_grad * d(x*y)/dx = accumulated_grad * y
 			pr.l.Grad += pr.r.Data * v.Grad
 			pr.r.Grad += pr.l.Data * v.Grad
-			pr.l.backward(pr.l.Grad)
-			pr.r.backward(pr.r.Grad)
+		case Sub:
+			// d(x - y)/dx = 1, d(x - y)/dy = -1
+			pr.l.Grad += v.Grad
+			pr.r.Grad -= v.Grad
+		case Div:
+			// d(x / y)/dx = 1/y, d(x / y)/dy = -x/y^2
+			pr.l.Grad += v.Grad / pr.r.Data
+			pr.r.Grad -= v.Grad * pr.l.Data / (pr.r.Data * pr.r.Data)
+		default:
+			panic(fmt.Errorf("invalid op for BinaryOp: %v", pr.op))
 		}
 	case *LogOp:
-		pr.v.Grad = 1. / pr.v.Data
-		pr.v.backward(pr.v.Grad)
+		// ln(x) --> 1/x
+		pr.v.Grad += v.Grad / pr.v.Data
 	case *PowOp:
 		// x^n --> nx^n-1
 		pr.v.Grad += pr.p * math.Pow(pr.v.Data, pr.p-1) * v.Grad
-		pr.v.backward(pr.v.Grad)
-
 	case *ExpOp:
 		// e^x --> e^x
-		pr.v.Grad += math.Exp(pr.v.Data) * v.Grad
-		pr.v.backward(pr.v.Grad)
+		pr.v.Grad += v.Data * v.Grad
 	case *UnaryOp:
 		switch pr.op {
 		case ReLu:
@@ -187,9 +227,11 @@ func (v *V) backward(accumulatedGrad float64) {
 			} else {
 				pr.v.Grad += 0 // for readability
 			}
-			pr.v.backward(pr.v.Grad)
 		default:
-			panic(fmt.Errorf("invalid op for UnaryOp: %T", pr.op))
+			if pr.df == nil {
+				panic(fmt.Errorf("invalid op for UnaryOp: %v", pr.op))
+			}
+			pr.v.Grad += pr.df(pr.v.Data, v.Data) * v.Grad
 		}
 	case *NullOp:
 	default:
@@ -202,7 +244,14 @@ func (v *V) Neg() *V {
 }
 
 func (v *V) Sub(o *V) *V {
-	return v.Add(o.Neg())
+	ret := &V{}
+	ret.Data = v.Data - o.Data
+	ret.prev = &BinaryOp{
+		op: Sub,
+		l:  v,
+		r:  o,
+	}
+	return ret
 }
 
 func (v *V) Add(o *V) *V {
@@ -228,8 +277,14 @@ func (v *V) Mul(o *V) *V {
 }
 
 func (v *V) Div(o *V) *V {
-	// a / b = a * (b ^ -1)
-	return v.Mul(o.Pow(-1.))
+	ret := &V{}
+	ret.Data = v.Data / o.Data
+	ret.prev = &BinaryOp{
+		op: Div,
+		l:  v,
+		r:  o,
+	}
+	return ret
 }
 
 // base with nature e
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -24,7 +25,7 @@ func TestVal(t *testing.T) {
 	t.Run("", func(t *testing.T) {
 		a := Vx(1)
 		b := Vx(2)
-		d := a.Sub(b) // a - (b * -1)
+		d := a.Sub(b)
 		d.backward(1)
 		assert.Equal(t, a.Grad, 1.0)
 		assert.Equal(t, b.Grad, -1.0)
@@ -68,3 +69,93 @@ func TestVal(t *testing.T) {
 		assert.Equal(t, a.Grad, 0.)
 	})
 }
+
+func TestBackwardSharedSubgraph(t *testing.T) {
+	// x is reused by every level, recursive propagation would visit 2^n paths
+	x := Vx(1.5)
+	y := x
+	for i := 0; i < 64; i++ {
+		y = y.Add(x)
+	}
+	y.Backward()
+	assert.Equal(t, 65., x.Grad)
+
+	// d(x^2^20)/dx is too big, (x * x) on each level still shares both operands
+	a := Vx(1.)
+	b := a
+	for i := 0; i < 30; i++ {
+		b = b.Mul(b)
+	}
+	b.Backward()
+	assert.Equal(t, math.Pow(2, 30), a.Grad)
+}
+
+func TestBackwardDeepGraph(t *testing.T) {
+	x := Vx(2.)
+	y := x
+	for i := 0; i < 200_000; i++ {
+		y = y.Add(Vx(1.))
+	}
+	y.Backward()
+	assert.Equal(t, 1., x.Grad)
+	assert.Equal(t, 200_002., y.Data)
+}
+
+func TestBackwardAccumulates(t *testing.T) {
+	a := Vx(3)
+	b := a.Mul(a).Log() // 2ln(a)
+	b.Backward()
+	assert.InDelta(t, 2./3., a.Grad, 1e-9)
+
+	// traversing the same graph again accumulates on the leaf only
+	b.Backward()
+	assert.InDelta(t, 4./3., a.Grad, 1e-9)
+}
+
+func TestGradFiniteDifference(t *testing.T) {
+	specs := []struct {
+		name string
+		a, b float64
+		fn   func(a, b *V) *V
+	}{
+		{"add", 1.3, -2.1, func(a, b *V) *V { return a.Add(b) }},
+		{"sub", 1.3, -2.1, func(a, b *V) *V { return a.Sub(b) }},
+		{"mul", 1.3, -2.1, func(a, b *V) *V { return a.Mul(b) }},
+		{"div", 1.3, -2.1, func(a, b *V) *V { return a.Div(b) }},
+		{"neg", 1.3, -2.1, func(a, b *V) *V { return a.Neg().Mul(b) }},
+		{"pow", 1.3, -2.1, func(a, b *V) *V { return a.Pow(3).Mul(b) }},
+		{"pow negative", 1.3, -2.1, func(a, b *V) *V { return a.Pow(-1.5).Add(b) }},
+		{"exp", 1.3, -2.1, func(a, b *V) *V { return a.Mul(b).Exp() }},
+		{"log", 1.3, 2.1, func(a, b *V) *V { return a.Mul(b).Log() }},
+		{"relu", 1.3, -2.1, func(a, b *V) *V { return a.ReLu().Add(b.ReLu()) }},
+		{"reused add", 1.3, -2.1, func(a, b *V) *V { return a.Add(a).Mul(b) }},
+		{"reused sub", 1.3, -2.1, func(a, b *V) *V { return a.Sub(a.Mul(b)).Sub(b) }},
+		{"reused div", 1.3, -2.1, func(a, b *V) *V { return a.Div(a.Add(b)).Div(b) }},
+		{"reused log", 1.3, 2.1, func(a, b *V) *V { x := a.Mul(b); return x.Log().Mul(x) }},
+		{"reused exp", 1.3, -2.1, func(a, b *V) *V { x := a.Exp(); return x.Mul(x).Div(b) }},
+		{"reused intermediate", 1.3, -2.1, func(a, b *V) *V {
+			x := a.Mul(b)
+			y := x.Add(a)
+			return y.Mul(x).Sub(y.Div(b)).Pow(2)
+		}},
+	}
+
+	const eps = 1e-6
+	for _, spec := range specs {
+		t.Run(spec.name, func(t *testing.T) {
+			a, b := Vx(spec.a), Vx(spec.b)
+			out := spec.fn(a, b)
+			out.Backward()
+
+			da := (spec.fn(Vx(spec.a+eps), Vx(spec.b)).Data - spec.fn(Vx(spec.a-eps), Vx(spec.b)).Data) / (2 * eps)
+			db := (spec.fn(Vx(spec.a), Vx(spec.b+eps)).Data - spec.fn(Vx(spec.a), Vx(spec.b-eps)).Data) / (2 * eps)
+			assert.InDelta(t, da, a.Grad, 1e-5)
+			assert.InDelta(t, db, b.Grad, 1e-5)
+
+			out.Zerograd()
+			assert.Equal(t, 0., a.Grad)
+			assert.Equal(t, 0., b.Grad)
+			assert.Equal(t, 0., out.Grad)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package core
+
+import "fmt"
+
+// Cat concatenates the tensors along dim, they have the same shape except for dim
+// e.g. the outputs of the two directions of an RNN: Cat([]Tensor{forward, backward}, -1)
+func Cat(ts []Tensor, dim int) Tensor {
+	if len(ts) == 0 {
+		panic("cat: no tensor to concatenate")
+	}
+	dim = normDim(dim, ts[0].Dim())
+	ts = append([]Tensor{}, ts...)
+
+	shape := append(Shape{}, ts[0].Shape...)
+	shape[dim] = 0
+	for i := range ts {
+		ts[i] = ts[i].contiguous()
+		if ts[i].Dim() != len(shape) {
+			panic(fmt.Sprintf("cat: shape %v doesn't match shape %v", ts[i].Shape, ts[0].Shape))
+		}
+		for d := range shape {
+			if d != dim && ts[i].Shape[d] != shape[d] {
+				panic(fmt.Sprintf("cat: shape %v doesn't match shape %v at dim %d", ts[i].Shape, ts[0].Shape, d))
+			}
+		}
+		shape[dim] += ts[i].Shape[dim]
+	}
+
+	// the block of a tensor for an outer index o is contiguous in both the tensor and the result
+	outer, n, inner := splitDim(shape, dim)
+	data := make([]float64, shape.Cap())
+	offsets := make([]int, len(ts)) // the offset of each tensor within a block of the result
+	for i := 1; i < len(ts); i++ {
+		offsets[i] = offsets[i-1] + ts[i-1].Shape[dim]*inner
+	}
+	for i, t := range ts {
+		size := t.Shape[dim] * inner
+		for o := 0; o < outer; o++ {
+			copy(data[o*n*inner+offsets[i]:], t.data[o*size:(o+1)*size])
+		}
+	}
+
+	ret := fromData(data, shape)
+	record(&ret, "cat", func(grad []float64) {
+		for i, t := range ts {
+			if !t.requiresGrad {
+				continue
+			}
+			tg := t.gradBuf()
+			size := t.Shape[dim] * inner
+			for o := 0; o < outer; o++ {
+				src := grad[o*n*inner+offsets[i] : o*n*inner+offsets[i]+size]
+				dst := tg[o*size : (o+1)*size]
+				for k := range src {
+					dst[k] += src[k]
+				}
+			}
+		}
+	}, ts...)
+	return ret
+}
+
+// Stack joins the tensors of the same shape along a new dim
+// e.g. the hidden states of every time step (batch, hidden) into (seq, batch, hidden): Stack(hs, 0)
+func Stack(ts []Tensor, dim int) Tensor {
+	if len(ts) == 0 {
+		panic("stack: no tensor to stack")
+	}
+	dim = normDim(dim, ts[0].Dim()+1)
+	unsqueezed := make([]Tensor, len(ts))
+	for i := range ts {
+		if !ts[i].Shape.Equal(ts[0].Shape) {
+			panic(fmt.Sprintf("stack: shape %v doesn't match shape %v", ts[i].Shape, ts[0].Shape))
+		}
+		unsqueezed[i] = ts[i].Unsqueeze(dim)
+	}
+	return Cat(unsqueezed, dim)
+}
+
+// Chunk splits t into n views of the same size along dim, the size of dim has to be a multiple of n
+// e.g. the 4 gates of a LSTM: gates.Chunk(4, -1)
+func (t Tensor) Chunk(n, dim int) []Tensor {
+	dim = normDim(dim, t.Dim())
+	if n <= 0 || t.Shape[dim]%n != 0 {
+		panic(fmt.Sprintf("chunk: dim %d of shape %v can't be split into %d chunks", dim, t.Shape, n))
+	}
+	size := t.Shape[dim] / n
+	ret := make([]Tensor, n)
+	for i := range ret {
+		ret[i] = t.SliceStep(dim, i*size, (i+1)*size, 1)
+	}
+	return ret
+}
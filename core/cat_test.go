@@ -0,0 +1,51 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCat(t *testing.T) {
+	a := NewTensor(d2{{1, 2}, {3, 4}}).SetRequiresGrad(true)
+	b := NewTensor(d2{{5}, {6}}).SetRequiresGrad(true)
+
+	c := Cat([]Tensor{a, b}, 1)
+	assert.True(t, NewTensor(d2{{1, 2, 5}, {3, 4, 6}}).Equal(c))
+	assert.True(t, NewTensor(d2{{1, 2}, {3, 4}, {1, 2}}).Equal(Cat([]Tensor{a, a.Slice(S{0, 1})}, 0)))
+	// views are fine
+	assert.True(t, NewTensor(d2{{1, 3}, {2, 4}, {5, 6}}).Equal(Cat([]Tensor{a.T(), b.T()}, 0)))
+
+	c.Mul(NewTensor(d1{1, 2, 3})).Backward()
+	assert.Nil(t, EqualFloatArray(a.Grad(), []float64{1, 2, 1, 2}, 0))
+	assert.Nil(t, EqualFloatArray(b.Grad(), []float64{3, 3}, 0))
+
+	assert.Panics(t, func() { Cat([]Tensor{a, b}, 0) })
+	assert.Panics(t, func() { Cat(nil, 0) })
+
+	x := Randn(2, 3, 2).SetRequiresGrad(true)
+	y := Randn(2, 1, 2).SetRequiresGrad(true)
+	fn := func(...Tensor) Tensor { return Cat([]Tensor{x, y, x}, -2).Pow(2) }
+	assert.Nil(t, GradCheck(fn, []Tensor{x, y}, GradCheckOptions{Atol: 1e-5, Rtol: 1e-9}))
+}
+
+func TestStackChunk(t *testing.T) {
+	a := NewTensor(d1{1, 2}).SetRequiresGrad(true)
+	b := NewTensor(d1{3, 4})
+
+	s := Stack([]Tensor{a, b, a}, 0)
+	assert.True(t, NewTensor(d2{{1, 2}, {3, 4}, {1, 2}}).Equal(s))
+	assert.True(t, NewTensor(d2{{1, 3}, {2, 4}}).Equal(Stack([]Tensor{a, b}, -1)))
+	s.Backward()
+	assert.Nil(t, EqualFloatArray(a.Grad(), []float64{2, 2}, 0))
+	assert.Panics(t, func() { Stack([]Tensor{a, Ones(3)}, 0) })
+
+	m := NewTensor(d2{{1, 2, 3, 4}, {5, 6, 7, 8}}).SetRequiresGrad(true)
+	chunks := m.Chunk(2, -1)
+	assert.Len(t, chunks, 2)
+	assert.True(t, NewTensor(d2{{1, 2}, {5, 6}}).Equal(chunks[0]))
+	assert.True(t, NewTensor(d2{{3, 4}, {7, 8}}).Equal(chunks[1]))
+	chunks[1].MulS(3).Backward()
+	assert.Nil(t, EqualFloatArray(m.Grad(), []float64{0, 0, 3, 3, 0, 0, 3, 3}, 0))
+	assert.Panics(t, func() { m.Chunk(3, 1) })
+}
@@ -0,0 +1,279 @@
+package core
+
+import (
+	"dexianta/tgnn/util"
+	"fmt"
+	"math"
+)
+
+// the convolution and pooling over a batch of images laid out as NCHW: (batch, channels, height, width)
+// the convolution is lowered into a matmul by im2col, which copies every receptive field into a row, so the heavy
+// lifting is done by the gemm kernels
+
+// convOutSize is the size of the output along a spatial dim
+func convOutSize(in, kernel, stride, padding, dilation int) int {
+	return (in+2*padding-dilation*(kernel-1)-1)/stride + 1
+}
+
+func checkImages(op Op, x Tensor) {
+	if x.Dim() != 4 {
+		panic(fmt.Sprintf("%s expects a NCHW input of 4 dims, got shape %v", op, x.Shape))
+	}
+}
+
+// im2col gathers the receptive fields of the kernel (kh, kw) over x (N, C, H, W) into the columns of a
+// (N, groups, C/groups*kh*kw, oh*ow) tensor, the padding is filled with 0
+// the row (c, ky, kx) is at (c*kh + ky)*kw + kx, same as a (C/groups, kh, kw) kernel, so the convolution is the matmul
+// of the (out, C/groups*kh*kw) kernels with the columns, which is already laid out as (N, out, oh, ow)
+func im2col(x Tensor, kh, kw int, stride, padding, dilation [2]int, groups int) (ret Tensor, oh, ow int) {
+	n, c, h, w := x.Shape[0], x.Shape[1], x.Shape[2], x.Shape[3]
+	oh = convOutSize(h, kh, stride[0], padding[0], dilation[0])
+	ow = convOutSize(w, kw, stride[1], padding[1], dilation[1])
+	if oh <= 0 || ow <= 0 {
+		panic(fmt.Sprintf("conv2d: kernel (%d, %d) is larger than the padded input %v", kh, kw, x.Shape))
+	}
+	x = x.contiguous()
+
+	// src is the index of every element of the columns of a single image within the image, -1 for the padding
+	// the rows are ordered by (group, channel, ky, kx), as the channels of a group follow each other
+	rows := c * kh * kw
+	src := make([]int, rows*oh*ow)
+	i := 0
+	for ci := 0; ci < c; ci++ {
+		for ky := 0; ky < kh; ky++ {
+			for kx := 0; kx < kw; kx++ {
+				for oy := 0; oy < oh; oy++ {
+					for ox := 0; ox < ow; ox++ {
+						y := oy*stride[0] - padding[0] + ky*dilation[0]
+						xx := ox*stride[1] - padding[1] + kx*dilation[1]
+						src[i] = -1
+						if y >= 0 && y < h && xx >= 0 && xx < w {
+							src[i] = (ci*h+y)*w + xx
+						}
+						i++
+					}
+				}
+			}
+		}
+	}
+
+	image := c * h * w
+	data := make([]float64, n*len(src))
+	for b := 0; b < n; b++ {
+		out, in := data[b*len(src):(b+1)*len(src)], x.data[b*image:(b+1)*image]
+		for j, s := range src {
+			if s >= 0 {
+				out[j] = in[s]
+			}
+		}
+	}
+
+	ret = fromData(data, Shape{n, groups, rows / groups, oh * ow})
+	record(&ret, "im2col", func(grad []float64) {
+		if !x.requiresGrad {
+			return
+		}
+		// col2im: an element of x receives the gradients of all the receptive fields it's in
+		xg := x.gradBuf()
+		for b := 0; b < n; b++ {
+			g, in := grad[b*len(src):(b+1)*len(src)], xg[b*image:(b+1)*image]
+			for j, s := range src {
+				if s >= 0 {
+					in[s] += g[j]
+				}
+			}
+		}
+	}, x)
+	return
+}
+
+// Conv2d is the 2d convolution (cross-correlation, as pytorch) of x (N, C, H, W) with the kernels weight
+// (out, C/groups, kh, kw), bias (out) is added to every output channel, pass Tensor{} for no bias.
+// stride, padding and dilation are (height, width), the input channels are split into groups convolved separately,
+// each of them producing out/groups channels. the result has the shape (N, out, oh, ow), where
+//
+//	oh = (H + 2*padding[0] - dilation[0]*(kh-1) - 1) / stride[0] + 1
+func Conv2d(x, weight, bias Tensor, stride, padding, dilation [2]int, groups int) Tensor {
+	checkImages("conv2d", x)
+	if weight.Dim() != 4 {
+		panic(fmt.Sprintf("conv2d expects a weight of 4 dims, got shape %v", weight.Shape))
+	}
+	out, kh, kw := weight.Shape[0], weight.Shape[2], weight.Shape[3]
+	if groups <= 0 || x.Shape[1]%groups != 0 || out%groups != 0 || weight.Shape[1]*groups != x.Shape[1] {
+		panic(fmt.Sprintf("conv2d: weight %v doesn't match input %v with %d groups", weight.Shape, x.Shape, groups))
+	}
+	for i := range stride {
+		if stride[i] <= 0 || dilation[i] <= 0 || padding[i] < 0 {
+			panic(fmt.Sprintf("conv2d: invalid stride %v, padding %v or dilation %v", stride, padding, dilation))
+		}
+	}
+
+	n := x.Shape[0]
+	cols, oh, ow := im2col(x, kh, kw, stride, padding, dilation, groups)
+	// (G, out/G, K) @ (N, G, K, oh*ow) -> (N, G, out/G, oh*ow)
+	ret := weight.Reshape(groups, out/groups, -1).Matmul(cols).View(n, out, oh, ow)
+	if bias.storage != nil {
+		ret = ret.Add(bias.Reshape(out, 1, 1))
+	}
+	return ret
+}
+
+// pool2d reduces the windows of every channel of x (N, C, H, W) into a (N, C, oh, ow) tensor
+// window gives the indices (within a channel) of the window of an output, -1 for the padding
+// fn reduces the values of a window, and fills dxs with the derivative with respect to each of them
+func pool2d(x Tensor, op Op, oh, ow int, window func(oy, ox int) []int,
+	fn func(vals []float64, idx []int, dxs []float64) float64) Tensor {
+	x = x.contiguous()
+	n, c, h, w := x.Shape[0], x.Shape[1], x.Shape[2], x.Shape[3]
+	plane := h * w
+
+	// offsets[o] is the start of the window of the o-th output of a plane in the concatenated windows
+	windows := make([][]int, oh*ow)
+	offsets := make([]int, oh*ow+1)
+	for oy := 0; oy < oh; oy++ {
+		for ox := 0; ox < ow; ox++ {
+			o := oy*ow + ox
+			windows[o] = window(oy, ox)
+			offsets[o+1] = offsets[o] + len(windows[o])
+		}
+	}
+	size := offsets[oh*ow]
+
+	// the weights of the windows of every plane, one after the other, kept for backward
+	data := make([]float64, n*c*oh*ow)
+	dxs := make([]float64, n*c*size)
+	var vals []float64
+	for p := 0; p < n*c; p++ {
+		in := x.data[p*plane : (p+1)*plane]
+		for o, idx := range windows {
+			vals = vals[:0]
+			for _, i := range idx {
+				if i < 0 {
+					vals = append(vals, math.NaN()) // the padding, fn decides how to treat it
+				} else {
+					vals = append(vals, in[i])
+				}
+			}
+			data[p*oh*ow+o] = fn(vals, idx, dxs[p*size+offsets[o]:p*size+offsets[o+1]])
+		}
+	}
+
+	ret := fromData(data, Shape{n, c, oh, ow})
+	record(&ret, op, func(grad []float64) {
+		if !x.requiresGrad {
+			return
+		}
+		xg := x.gradBuf()
+		for p := 0; p < n*c; p++ {
+			in := xg[p*plane : (p+1)*plane]
+			for o, idx := range windows {
+				g, dx := grad[p*oh*ow+o], dxs[p*size+offsets[o]:]
+				for k, i := range idx {
+					if i >= 0 {
+						in[i] += dx[k] * g
+					}
+				}
+			}
+		}
+	}, x)
+	return ret
+}
+
+// poolWindow returns the window function of a kernel (kh, kw) sliding over a (h, w) plane
+func poolWindow(h, w int, kernel, stride, padding [2]int) func(oy, ox int) []int {
+	return func(oy, ox int) []int {
+		idx := make([]int, 0, kernel[0]*kernel[1])
+		for ky := 0; ky < kernel[0]; ky++ {
+			for kx := 0; kx < kernel[1]; kx++ {
+				y, xx := oy*stride[0]-padding[0]+ky, ox*stride[1]-padding[1]+kx
+				if y >= 0 && y < h && xx >= 0 && xx < w {
+					idx = append(idx, y*w+xx)
+				} else {
+					idx = append(idx, -1)
+				}
+			}
+		}
+		return idx
+	}
+}
+
+func checkPool(op Op, x Tensor, kernel, stride, padding [2]int) (oh, ow int) {
+	checkImages(op, x)
+	for i := range kernel {
+		if kernel[i] <= 0 || stride[i] <= 0 || padding[i] < 0 || padding[i]*2 > kernel[i] {
+			panic(fmt.Sprintf("%s: invalid kernel %v, stride %v or padding %v", op, kernel, stride, padding))
+		}
+	}
+	oh = convOutSize(x.Shape[2], kernel[0], stride[0], padding[0], 1)
+	ow = convOutSize(x.Shape[3], kernel[1], stride[1], padding[1], 1)
+	if oh <= 0 || ow <= 0 {
+		panic(fmt.Sprintf("%s: kernel %v is larger than the padded input %v", op, kernel, x.Shape))
+	}
+	return
+}
+
+// MaxPool2d takes the max of every (kh, kw) window of x (N, C, H, W), the padding is ignored (as -Inf)
+// the gradient goes to the max of the window (the first one in case of ties)
+// padding can't be larger than half of the kernel, so a window always contains an element of x
+func MaxPool2d(x Tensor, kernel, stride, padding [2]int) Tensor {
+	oh, ow := checkPool("max_pool2d", x, kernel, stride, padding)
+	return pool2d(x, "max_pool2d", oh, ow, poolWindow(x.Shape[2], x.Shape[3], kernel, stride, padding),
+		func(vals []float64, idx []int, dxs []float64) float64 {
+			best := -1
+			for k, v := range vals {
+				if idx[k] >= 0 && (best < 0 || v > vals[best] || (math.IsNaN(v) && !math.IsNaN(vals[best]))) {
+					best = k
+				}
+			}
+			dxs[best] = 1
+			return vals[best]
+		})
+}
+
+// AvgPool2d takes the mean of every (kh, kw) window of x (N, C, H, W), the padding counts as 0 in the mean,
+// same as pytorch's default (count_include_pad)
+func AvgPool2d(x Tensor, kernel, stride, padding [2]int) Tensor {
+	oh, ow := checkPool("avg_pool2d", x, kernel, stride, padding)
+	return pool2d(x, "avg_pool2d", oh, ow, poolWindow(x.Shape[2], x.Shape[3], kernel, stride, padding),
+		func(vals []float64, idx []int, dxs []float64) float64 {
+			var s float64
+			for k, v := range vals {
+				if idx[k] >= 0 {
+					s += v
+				}
+				dxs[k] = 1 / float64(len(vals))
+			}
+			return s / float64(len(vals))
+		})
+}
+
+// AdaptiveAvgPool2d averages x (N, C, H, W) into (N, C, oh, ow) whatever the size of the input is, the i-th window
+// along a dim of size n spans [floor(i*n/out), ceil((i+1)*n/out)), same as pytorch
+func AdaptiveAvgPool2d(x Tensor, oh, ow int) Tensor {
+	checkImages("adaptive_avg_pool2d", x)
+	if oh <= 0 || ow <= 0 {
+		panic(fmt.Sprintf("adaptive_avg_pool2d: invalid output size (%d, %d)", oh, ow))
+	}
+	h, w := x.Shape[2], x.Shape[3]
+	span := func(i, out, n int) (int, int) {
+		return i * n / out, ((i+1)*n + out - 1) / out
+	}
+	window := func(oy, ox int) []int {
+		y0, y1 := span(oy, oh, h)
+		x0, x1 := span(ox, ow, w)
+		var idx []int
+		for y := y0; y < y1; y++ {
+			for xx := x0; xx < x1; xx++ {
+				idx = append(idx, y*w+xx)
+			}
+		}
+		return idx
+	}
+	return pool2d(x, "adaptive_avg_pool2d", oh, ow, window,
+		func(vals []float64, idx []int, dxs []float64) float64 {
+			for k := range dxs {
+				dxs[k] = 1 / float64(len(vals))
+			}
+			return util.Sum(vals) / float64(len(vals))
+		})
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// naiveConv2d is the direct definition of the convolution
+func naiveConv2d(x, w, b Tensor, stride, padding, dilation [2]int, groups int) []float64 {
+	n, c, h, wd := x.Shape[0], x.Shape[1], x.Shape[2], x.Shape[3]
+	out, kh, kw := w.Shape[0], w.Shape[2], w.Shape[3]
+	oh := convOutSize(h, kh, stride[0], padding[0], dilation[0])
+	ow := convOutSize(wd, kw, stride[1], padding[1], dilation[1])
+	cg, og := c/groups, out/groups
+
+	var ret []float64
+	for bi := 0; bi < n; bi++ {
+		for o := 0; o < out; o++ {
+			g := o / og
+			for oy := 0; oy < oh; oy++ {
+				for ox := 0; ox < ow; ox++ {
+					s := b.Loc([]int{o})
+					for ci := 0; ci < cg; ci++ {
+						for ky := 0; ky < kh; ky++ {
+							for kx := 0; kx < kw; kx++ {
+								y := oy*stride[0] - padding[0] + ky*dilation[0]
+								xx := ox*stride[1] - padding[1] + kx*dilation[1]
+								if y < 0 || y >= h || xx < 0 || xx >= wd {
+									continue
+								}
+								s += x.Loc([]int{bi, g*cg + ci, y, xx}) * w.Loc([]int{o, ci, ky, kx})
+							}
+						}
+					}
+					ret = append(ret, s)
+				}
+			}
+		}
+	}
+	return ret
+}
+
+func TestConv2d(t *testing.T) {
+	x := NewTensor(d4{{{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}}}})
+	w := Ones(1, 1, 2, 2)
+
+	ret := Conv2d(x, w, Tensor{}, [2]int{1, 1}, [2]int{0, 0}, [2]int{1, 1}, 1)
+	assert.True(t, NewTensor(d4{{{{12, 16}, {24, 28}}}}).Equal(ret))
+
+	ret = Conv2d(x, w, NewTensor(d1{10}), [2]int{2, 2}, [2]int{1, 1}, [2]int{1, 1}, 1)
+	assert.True(t, NewTensor(d4{{{{11, 15}, {21, 38}}}}).Equal(ret))
+
+	specs := []struct {
+		name                      string
+		x, w                      Shape
+		stride, padding, dilation [2]int
+		groups                    int
+	}{
+		{"plain", Shape{2, 3, 6, 5}, Shape{4, 3, 3, 3}, [2]int{1, 1}, [2]int{0, 0}, [2]int{1, 1}, 1},
+		{"stride and padding", Shape{2, 3, 6, 5}, Shape{4, 3, 3, 2}, [2]int{2, 1}, [2]int{1, 2}, [2]int{1, 1}, 1},
+		{"dilation", Shape{1, 2, 7, 7}, Shape{3, 2, 3, 3}, [2]int{1, 2}, [2]int{1, 1}, [2]int{2, 3}, 1},
+		{"groups", Shape{2, 4, 5, 5}, Shape{6, 2, 3, 3}, [2]int{1, 1}, [2]int{1, 1}, [2]int{1, 1}, 2},
+		{"depthwise", Shape{1, 3, 4, 4}, Shape{3, 1, 2, 2}, [2]int{2, 2}, [2]int{0, 0}, [2]int{1, 1}, 3},
+	}
+	for _, spec := range specs {
+		t.Run(spec.name, func(t *testing.T) {
+			x := Randn(spec.x...).SetRequiresGrad(true)
+			w := Randn(spec.w...).SetRequiresGrad(true)
+			b := Randn(spec.w[0]).SetRequiresGrad(true)
+			fn := func(...Tensor) Tensor {
+				return Conv2d(x, w, b, spec.stride, spec.padding, spec.dilation, spec.groups).Pow(2)
+			}
+
+			ret := Conv2d(x, w, b, spec.stride, spec.padding, spec.dilation, spec.groups)
+			assert.Nil(t, EqualFloatArray(ret.Data(), naiveConv2d(x, w, b, spec.stride, spec.padding, spec.dilation,
+				spec.groups), 1e-9))
+
+			assert.Nil(t, GradCheck(fn, []Tensor{x, w, b}, GradCheckOptions{Atol: 1e-4, Rtol: 1e-9}))
+		})
+	}
+
+	one, zero := [2]int{1, 1}, [2]int{}
+	assert.Panics(t, func() { Conv2d(Ones(1, 3, 4, 4), Ones(2, 2, 3, 3), Tensor{}, one, zero, one, 1) })
+	assert.Panics(t, func() { Conv2d(Ones(1, 1, 2, 2), Ones(1, 1, 3, 3), Tensor{}, one, zero, one, 1) })
+	assert.Panics(t, func() { Conv2d(Ones(3, 4, 4), Ones(1, 3, 3, 3), Tensor{}, one, zero, one, 1) })
+}
+
+func TestPool2d(t *testing.T) {
+	x := NewTensor(d4{{{
+		{1, 2, 3, 4},
+		{5, 6, 7, 8},
+		{9, 10, 11, 12},
+		{13, 14, 15, 16},
+	}}}).SetRequiresGrad(true)
+
+	max := MaxPool2d(x, [2]int{2, 2}, [2]int{2, 2}, [2]int{0, 0})
+	assert.True(t, NewTensor(d4{{{{6, 8}, {14, 16}}}}).Equal(max))
+	max.Backward()
+	assert.Nil(t, EqualFloatArray(x.Grad(), []float64{0, 0, 0, 0, 0, 1, 0, 1, 0, 0, 0, 0, 0, 1, 0, 1}, 0))
+
+	// the padding never wins
+	neg := x.Neg()
+	assert.True(t, NewTensor(d4{{{{-1, -2, -4}, {-5, -6, -8}, {-13, -14, -16}}}}).
+		Equal(MaxPool2d(neg, [2]int{2, 2}, [2]int{2, 2}, [2]int{1, 1})))
+
+	avg := AvgPool2d(x, [2]int{2, 2}, [2]int{2, 2}, [2]int{0, 0})
+	assert.True(t, NewTensor(d4{{{{3.5, 5.5}, {11.5, 13.5}}}}).Equal(avg))
+	// the padding counts in the mean
+	assert.True(t, NewTensor(d4{{{{0.25, 1.25, 1}, {3.5, 8.5, 5}, {3.25, 7.25, 4}}}}).
+		Equal(AvgPool2d(x, [2]int{2, 2}, [2]int{2, 2}, [2]int{1, 1})))
+
+	adaptive := AdaptiveAvgPool2d(x, 1, 1)
+	assert.True(t, NewTensor(d4{{{{8.5}}}}).Equal(adaptive))
+	// overlapping windows: [0, 2), [1, 3), [2, 4)
+	top := x.Slice(S{0, 1}, S{0, 1}, S{0, 2}) // (1, 1, 2, 4)
+	assert.True(t, NewTensor(d4{{{{3.5, 4.5, 5.5}}}}).Equal(AdaptiveAvgPool2d(top, 1, 3)))
+
+	specs := []struct {
+		name string
+		fn   func(x Tensor) Tensor
+	}{
+		{"max", func(x Tensor) Tensor { return MaxPool2d(x, [2]int{3, 2}, [2]int{2, 1}, [2]int{1, 1}) }},
+		{"avg", func(x Tensor) Tensor { return AvgPool2d(x, [2]int{3, 2}, [2]int{2, 1}, [2]int{1, 0}) }},
+		{"adaptive avg", func(x Tensor) Tensor { return AdaptiveAvgPool2d(x, 3, 2) }},
+	}
+	for _, spec := range specs {
+		t.Run(spec.name, func(t *testing.T) {
+			x := Randn(2, 3, 5, 4).SetRequiresGrad(true)
+			fn := func(...Tensor) Tensor { return spec.fn(x).Pow(2) }
+			assert.Nil(t, GradCheck(fn, []Tensor{x}, GradCheckOptions{Atol: 1e-5, Rtol: 1e-9}))
+		})
+	}
+
+	assert.Panics(t, func() { MaxPool2d(x, [2]int{2, 2}, [2]int{2, 2}, [2]int{2, 2}) })
+	assert.Panics(t, func() { AvgPool2d(x, [2]int{5, 5}, [2]int{1, 1}, [2]int{0, 0}) })
+}
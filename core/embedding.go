@@ -0,0 +1,47 @@
+package core
+
+import "fmt"
+
+// Embedding looks up the rows of weight (n, dim) by index, a tensor of integers of any shape, the result has the
+// shape (index..., dim). the rows at paddingIdx don't receive any gradient, pass a negative paddingIdx for none
+//
+// unlike IndexSelect, the gradient is sparse: backward only accumulates into the rows looked up, and weight keeps
+// track of them (see SparseGrad), so a large vocabulary doesn't cost a dense update per batch
+func Embedding(weight, index Tensor, paddingIdx int) Tensor {
+	if weight.Dim() != 2 {
+		panic(fmt.Sprintf("embedding expects a weight of 2 dims, got shape %v", weight.Shape))
+	}
+	weight = weight.contiguous()
+	n, dim := weight.Shape[0], weight.Shape[1]
+	idx := toIndices(index, n)
+
+	shape := append(append(Shape{}, index.Shape...), dim)
+	data := make([]float64, len(idx)*dim)
+	for j, i := range idx {
+		copy(data[j*dim:(j+1)*dim], weight.data[i*dim:(i+1)*dim])
+	}
+
+	ret := fromData(data, shape)
+	record(&ret, "embedding", func(grad []float64) {
+		if !weight.requiresGrad {
+			return
+		}
+		var rows []int
+		for _, i := range idx {
+			if i != paddingIdx {
+				rows = append(rows, i)
+			}
+		}
+		wg := weight.sparseGradBuf(rows)
+		for j, i := range idx {
+			if i == paddingIdx {
+				continue
+			}
+			src, dst := grad[j*dim:(j+1)*dim], wg[i*dim:(i+1)*dim]
+			for k := range src {
+				dst[k] += src[k]
+			}
+		}
+	}, weight)
+	return ret
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbedding(t *testing.T) {
+	w := NewTensor(d2{{0, 0}, {1, 2}, {3, 4}, {5, 6}}).SetRequiresGrad(true)
+	index := NewTensor(d2{{1, 3}, {1, 0}, {-1, 2}})
+
+	ret := Embedding(w, index, 0)
+	assert.Equal(t, Shape{3, 2, 2}, ret.Shape)
+	assert.True(t, NewTensor(d3{{{1, 2}, {5, 6}}, {{1, 2}, {0, 0}}, {{5, 6}, {3, 4}}}).Equal(ret))
+
+	// only the rows looked up get gradient, and not the padding
+	rows, ok := w.SparseGrad()
+	assert.True(t, ok)
+	assert.Empty(t, rows)
+	ret.Backward()
+	rows, ok = w.SparseGrad()
+	assert.True(t, ok)
+	assert.Equal(t, []int{1, 2, 3}, rows)
+	assert.Nil(t, EqualFloatArray(w.Grad(), []float64{0, 0, 2, 2, 1, 1, 2, 2}, 0))
+
+	// the same gradient as the dense IndexSelect, apart from the padding
+	x := Randn(5, 3).SetRequiresGrad(true)
+	y := x.Detach().SetRequiresGrad(true)
+	idx := NewTensor(d1{4, 0, 4, 2})
+	c := Randn(4, 3)
+	Embedding(x, idx, -1).Mul(c).Backward()
+	y.IndexSelect(0, idx).Mul(c).Backward()
+	assert.Nil(t, EqualFloatArray(y.Grad(), x.Grad(), 1e-12))
+
+	// ZeroGrad resets the rows, and a dense op makes the gradient dense
+	w.ZeroGrad()
+	rows, ok = w.SparseGrad()
+	assert.True(t, ok)
+	assert.Empty(t, rows)
+	assert.Nil(t, EqualFloatArray(w.Grad(), make([]float64, 8), 0))
+	Embedding(w, NewTensor(d1{2}), -1).Add(w.MulS(2)).Backward()
+	_, ok = w.SparseGrad()
+	assert.False(t, ok)
+	w.ZeroGrad()
+	_, ok = w.SparseGrad()
+	assert.True(t, ok)
+
+	assert.Panics(t, func() { Embedding(w, NewTensor(d1{4}), -1) })
+	assert.Panics(t, func() { Embedding(Ones(4), NewTensor(d1{1}), -1) })
+}
+
+func TestSparseGradViews(t *testing.T) {
+	// the views created before the ZeroGrad (e.g. by the forward pass) still make the gradient dense
+	views := map[string]func(w Tensor) Tensor{
+		"reshape":   func(w Tensor) Tensor { return w.Reshape(-1) },
+		"slicestep": func(w Tensor) Tensor { return w.SliceStep(1, 0, 2, 2) },
+		"transpose": func(w Tensor) Tensor { return w.T().Reshape(-1) },
+	}
+	for name, view := range views {
+		t.Run(name, func(t *testing.T) {
+			w := Ones(3, 2).SetRequiresGrad(true)
+			out := view(w).MulS(2)
+			w.ZeroGrad()
+			out.Backward()
+			_, ok := w.SparseGrad()
+			assert.False(t, ok)
+
+			// creating a view doesn't touch the gradient
+			w.ZeroGrad()
+			view(w)
+			rows, ok := w.SparseGrad()
+			assert.True(t, ok)
+			assert.Empty(t, rows)
+		})
+	}
+
+	// the rows of a view are not the ones of its base
+	w := Ones(3, 2).SetRequiresGrad(true)
+	Embedding(w.SliceStep(0, 1, 3, 1), NewTensor(d1{0}), -1).Backward()
+	_, ok := w.SparseGrad()
+	assert.False(t, ok)
+	assert.Nil(t, EqualFloatArray(w.Grad(), []float64{0, 0, 1, 1, 0, 0}, 0))
+}
@@ -1,37 +1,111 @@
 package core
 
-func Softmax(a Tensor, dim int) (ret Tensor) {
-	if dim >= a.Dim() {
-		panic("invalid dim >= a.Dim()")
+import "math"
+
+// softmaxSlices calls fn for every slice of a along dim, the k-th element of a slice is at start + k*stride
+func softmaxSlices(a Tensor, dim int, fn func(start, stride int)) {
+	outer, n, stride := splitDim(a.Shape, dim)
+	for o := 0; o < outer; o++ {
+		for in := 0; in < stride; in++ {
+			fn(o*n*stride+in, stride)
+		}
 	}
+}
 
-	ret.Shape = a.Shape
-	ret.data = make([]*V, len(a.data))
+// sliceMax is the max of a slice along dim, subtracting it before exp keeps exp(x) in (0, 1]
+// so that large logits (> ~709) don't overflow into +Inf / NaN
+func sliceMax(data []float64, start, stride, n int) float64 {
+	m := math.Inf(-1)
+	for k := 0; k < n; k++ {
+		m = math.Max(m, data[start+k*stride])
+	}
+	if math.IsInf(m, -1) {
+		// all -Inf, nothing to shift
+		return 0
+	}
+	return m
+}
 
-	for i := range ret.data {
-		pos := toPos(i, a.Shape)
-		poses := DimIter(pos, dim, a.Shape)
+// Softmax normalizes the slices along dim into probabilities: exp(x_i) / sum(exp(x_j))
+// it is computed as exp(x_i - max) / sum(exp(x_j - max)), which is the same but never overflows
+func Softmax(a Tensor, dim int) (ret Tensor) {
+	dim = normDim(dim, a.Dim())
+	a = a.contiguous()
+	n := a.Shape[dim]
 
-		var tmp []*V
-		for _, p := range poses {
-			tmp = append(tmp, a.data[toIndex(p, a.Shape)])
+	data := make([]float64, len(a.data))
+	softmaxSlices(a, dim, func(start, stride int) {
+		m := sliceMax(a.data, start, stride, n)
+		var denum float64
+		for k := 0; k < n; k++ {
+			i := start + k*stride
+			data[i] = math.Exp(a.data[i] - m)
+			denum += data[i]
 		}
-
-		fn := func(v *V) *V {
-			return v.Exp()
+		for k := 0; k < n; k++ {
+			data[start+k*stride] /= denum
 		}
-		num := a.data[i].Exp()
-		denum := Sum(MapV(tmp, fn))
-		ret.data[i] = num.Div(denum)
-	}
+	})
 
+	ret = fromData(data, a.Shape)
+	record(&ret, "softmax", func(grad []float64) {
+		if !a.requiresGrad {
+			return
+		}
+		// dx_i = y_i * (g_i - sum_j(g_j * y_j))
+		ag := a.gradBuf()
+		softmaxSlices(a, dim, func(start, stride int) {
+			var dot float64
+			for k := 0; k < n; k++ {
+				dot += grad[start+k*stride] * data[start+k*stride]
+			}
+			for k := 0; k < n; k++ {
+				i := start + k*stride
+				ag[i] += data[i] * (grad[i] - dot)
+			}
+		})
+	}, a)
 	return
 }
 
+// LogSoftmax is log(Softmax(a, dim)), computed directly with the log-sum-exp trick:
+// x_i - max - log(sum(exp(x_j - max))), so it doesn't underflow to -Inf when a probability rounds to 0
 func LogSoftmax(a Tensor, dim int) (ret Tensor) {
-	ret = Softmax(a, dim)
-	for i := range ret.data {
-		ret.data[i] = ret.data[i].Log()
-	}
-	return ret
+	dim = normDim(dim, a.Dim())
+	a = a.contiguous()
+	n := a.Shape[dim]
+
+	data := make([]float64, len(a.data))
+	softmaxSlices(a, dim, func(start, stride int) {
+		m := sliceMax(a.data, start, stride, n)
+		var s float64
+		for k := 0; k < n; k++ {
+			s += math.Exp(a.data[start+k*stride] - m)
+		}
+		lse := m + math.Log(s)
+		for k := 0; k < n; k++ {
+			i := start + k*stride
+			data[i] = a.data[i] - lse
+		}
+	})
+
+	ret = fromData(data, a.Shape)
+	record(&ret, "log_softmax", func(grad []float64) {
+		if !a.requiresGrad {
+			return
+		}
+		// dx_i = g_i - softmax_i * sum_j(g_j), where softmax_i = exp(y_i)
+		ag := a.gradBuf()
+		softmaxSlices(a, dim, func(start, stride int) {
+			var gs float64
+			for k := 0; k < n; k++ {
+				gs += grad[start+k*stride]
+			}
+			for k := 0; k < n; k++ {
+				i := start + k*stride
+				ag[i] += grad[i] - math.Exp(data[i])*gs
+			}
+		})
+	}, a)
+	return
 }
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -37,9 +38,9 @@ func TestSoftmax(t *testing.T) {
 
 func TestLogSoftmaxBackward(t *testing.T) {
 	t.Run("", func(t *testing.T) {
-		a := NewTensor(d1{1., 2., 3., 4.})
+		a := NewTensor(d1{1., 2., 3., 4.}).SetRequiresGrad(true)
 		b := LogSoftmax(a, 0)
-		b.GetV(Pos{0}).Backward()
+		b.Slice(S{0, 1}).Backward()
 		assert.Nil(t,
 			EqualFloatArray(
 				a.Grad(),
@@ -49,11 +50,11 @@ func TestLogSoftmaxBackward(t *testing.T) {
 	})
 
 	t.Run("", func(t *testing.T) {
-		a := NewTensor(d2{{1, 2, 3}, {4, 5, 6}})
+		a := NewTensor(d2{{1, 2, 3}, {4, 5, 6}}).SetRequiresGrad(true)
 		b := LogSoftmax(a, 0)
 		c := LogSoftmax(a, 1)
-		b.GetV(Pos{0, 0}).Backward()
-		c.GetV(Pos{1, 1}).Backward()
+		b.Slice(S{0, 1}, S{0, 1}).Backward()
+		c.Slice(S{1, 2}, S{1, 2}).Backward()
 
 		assert.Nil(t,
 			EqualFloatArray(
@@ -67,9 +68,9 @@ func TestLogSoftmaxBackward(t *testing.T) {
 
 func TestSoftmaxBackward(t *testing.T) {
 	t.Run("", func(t *testing.T) {
-		a := NewTensor(d1{1., 2., 3., 4.})
+		a := NewTensor(d1{1., 2., 3., 4.}).SetRequiresGrad(true)
 		b := Softmax(a, 0)
-		b.GetV(Pos{0}).Backward()
+		b.Slice(S{0, 1}).Backward()
 		assert.Nil(t,
 			EqualFloatArray(
 				a.Grad(),
@@ -79,11 +80,11 @@ func TestSoftmaxBackward(t *testing.T) {
 	})
 
 	t.Run("", func(t *testing.T) {
-		a := NewTensor(d2{{1, 2, 3}, {4, 5, 6}})
+		a := NewTensor(d2{{1, 2, 3}, {4, 5, 6}}).SetRequiresGrad(true)
 		b := Softmax(a, 0)
 		c := Softmax(a, 1)
-		b.GetV(Pos{0, 0}).Backward()
-		c.GetV(Pos{1, 1}).Backward()
+		b.Slice(S{0, 1}, S{0, 1}).Backward()
+		c.Slice(S{1, 2}, S{1, 2}).Backward()
 
 		assert.Nil(t,
 			EqualFloatArray(
@@ -94,3 +95,34 @@ func TestSoftmaxBackward(t *testing.T) {
 		)
 	})
 }
+
+func TestSoftmaxStability(t *testing.T) {
+	a := NewTensor(d2{{1000, 1001, 1002}, {-1000, 0, 1000}}).SetRequiresGrad(true)
+
+	s := Softmax(a, 1)
+	assert.True(t, s.Equal(NewTensor(d2{{0.0900, 0.2447, 0.6652}, {0, 0, 1}})))
+
+	l := LogSoftmax(a, -1)
+	assert.True(t, l.Equal(NewTensor(d2{{-2.4076, -1.4076, -0.4076}, {-2000, -1000, 0}})))
+	for _, v := range append(s.Data(), l.Data()...) {
+		assert.False(t, math.IsNaN(v) || math.IsInf(v, 0))
+	}
+
+	l.Backward()
+	for _, v := range a.Grad() {
+		assert.False(t, math.IsNaN(v) || math.IsInf(v, 0))
+	}
+}
+
+func TestSoftmaxGrad(t *testing.T) {
+	a := Randn(3, 4, 2).MulS(20).SetRequiresGrad(true)
+	for dim := -1; dim < 3; dim++ {
+		for name, fn := range map[string]func(...Tensor) Tensor{
+			"softmax":     func(...Tensor) Tensor { return Softmax(a, dim).Mul(a) },
+			"log softmax": func(...Tensor) Tensor { return LogSoftmax(a, dim).Pow(2) },
+		} {
+			err := GradCheck(fn, []Tensor{a}, GradCheckOptions{Atol: 1e-4, Rtol: 1e-9})
+			assert.Nil(t, err, "%s, dim %d", name, dim)
+		}
+	}
+}
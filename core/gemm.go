@@ -0,0 +1,128 @@
+package core
+
+import (
+	"dexianta/tgnn/util"
+	"math"
+	"runtime"
+	"sync"
+)
+
+const (
+	// gemmBlock is the size of the tiles, a (gemmBlock, gemmBlock) tile of float64 (32KB) fits in the L1/L2 cache
+	gemmBlock = 64
+	// gemmParallelFlops is the amount of multiply-adds below which spawning goroutines costs more than it saves
+	gemmParallelFlops = 1 << 16
+)
+
+// number of goroutines used by the kernels
+var workers = runtime.NumCPU()
+
+// gemm computes c += a @ b over row major buffers, a: (m, k), b: (k, n), c: (m, n)
+func gemm(m, k, n int, a, b, c []float64) {
+	finite := finiteRows(k, n, b)
+	parallelFor(m, m*k*n, func(lo, hi int) {
+		for l0 := 0; l0 < k; l0 += gemmBlock {
+			l1 := util.Imin(l0+gemmBlock, k)
+			for j0 := 0; j0 < n; j0 += gemmBlock {
+				j1 := util.Imin(j0+gemmBlock, n)
+				for i := lo; i < hi; i++ {
+					ci := c[i*n+j0 : i*n+j1]
+					for l := l0; l < l1; l++ {
+						av := a[i*k+l]
+						if av == 0 && finite[l] {
+							continue
+						}
+						bl := b[l*n+j0 : l*n+j1]
+						for j := range ci {
+							ci[j] += av * bl[j]
+						}
+					}
+				}
+			}
+		}
+	})
+}
+
+// gemmNT computes c += a @ b^T, a: (m, n), b: (k, n), c: (m, k)
+// it is the gradient of the left operand of a matmul: grad @ b^T
+func gemmNT(m, n, k int, a, b, c []float64) {
+	parallelFor(m, m*k*n, func(lo, hi int) {
+		for l0 := 0; l0 < k; l0 += gemmBlock {
+			l1 := util.Imin(l0+gemmBlock, k)
+			for i := lo; i < hi; i++ {
+				ai := a[i*n : (i+1)*n]
+				for l := l0; l < l1; l++ {
+					bl := b[l*n : (l+1)*n]
+					var s float64
+					for j := range ai {
+						s += ai[j] * bl[j]
+					}
+					c[i*k+l] += s
+				}
+			}
+		}
+	})
+}
+
+// gemmTN computes c += a^T @ b, a: (m, k), b: (m, n), c: (k, n)
+// it is the gradient of the right operand of a matmul: a^T @ grad
+func gemmTN(m, k, n int, a, b, c []float64) {
+	finite := finiteRows(m, n, b)
+	// every goroutine owns a range of rows of c
+	parallelFor(k, m*k*n, func(lo, hi int) {
+		for i0 := 0; i0 < m; i0 += gemmBlock {
+			i1 := util.Imin(i0+gemmBlock, m)
+			for l := lo; l < hi; l++ {
+				cl := c[l*n : (l+1)*n]
+				for i := i0; i < i1; i++ {
+					av := a[i*k+l]
+					if av == 0 && finite[i] {
+						continue
+					}
+					bi := b[i*n : (i+1)*n]
+					for j := range cl {
+						cl[j] += av * bi[j]
+					}
+				}
+			}
+		}
+	})
+}
+
+// finiteRows tells for every row of the (m, n) buffer a if it has no NaN or Inf
+// the kernels skip the zeros of their left operand (e.g. the blank pixels of an image) only against such rows, since
+// 0 * Inf and 0 * NaN are NaN
+func finiteRows(m, n int, a []float64) []bool {
+	ret := make([]bool, m)
+	for i := range ret {
+		ret[i] = true
+		for _, v := range a[i*n : (i+1)*n] {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				ret[i] = false
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// parallelFor splits [0, n) into contiguous ranges handled by `workers` goroutines
+// small workloads are run in the calling goroutine
+func parallelFor(n, flops int, fn func(lo, hi int)) {
+	w := util.Imin(workers, n)
+	if w <= 1 || flops < gemmParallelFlops {
+		fn(0, n)
+		return
+	}
+
+	chunk := (n + w - 1) / w
+	var wg sync.WaitGroup
+	for lo := 0; lo < n; lo += chunk {
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			fn(lo, hi)
+		}(lo, util.Imin(lo+chunk, n))
+	}
+	wg.Wait()
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func randSlice(n int) []float64 {
+	ret := make([]float64, n)
+	for i := range ret {
+		ret[i] = rand.NormFloat64()
+	}
+	return ret
+}
+
+func TestGemm(t *testing.T) {
+	// make sure the work is split even on a single core machine
+	defer func(w int) { workers = w }(workers)
+	workers = 4
+
+	// sizes crossing the block size and the parallel threshold
+	for _, size := range [][3]int{{1, 1, 1}, {3, 5, 2}, {64, 784, 10}, {130, 70, 129}} {
+		m, k, n := size[0], size[1], size[2]
+		a, b, g := randSlice(m*k), randSlice(k*n), randSlice(m*n)
+
+		// naive version
+		c := make([]float64, m*n)
+		da := make([]float64, m*k)
+		db := make([]float64, k*n)
+		for i := 0; i < m; i++ {
+			for j := 0; j < n; j++ {
+				for l := 0; l < k; l++ {
+					c[i*n+j] += a[i*k+l] * b[l*n+j]
+					da[i*k+l] += g[i*n+j] * b[l*n+j]
+					db[l*n+j] += a[i*k+l] * g[i*n+j]
+				}
+			}
+		}
+
+		c2 := make([]float64, m*n)
+		da2 := make([]float64, m*k)
+		db2 := make([]float64, k*n)
+		gemm(m, k, n, a, b, c2)
+		gemmNT(m, n, k, g, b, da2)
+		gemmTN(m, k, n, a, g, db2)
+		assert.Nil(t, EqualFloatArray(c, c2, 1e-9), "%v", size)
+		assert.Nil(t, EqualFloatArray(da, da2, 1e-9), "%v", size)
+		assert.Nil(t, EqualFloatArray(db, db2, 1e-9), "%v", size)
+	}
+}
+
+func TestMatmulNonFinite(t *testing.T) {
+	a := NewTensor(d2{{0, 1}})
+	for _, v := range []float64{math.Inf(1), math.NaN()} {
+		// 0 * Inf is NaN, like Mul
+		out := a.Matmul(NewTensor(d2{{v}, {1}}))
+		assert.True(t, math.IsNaN(out.Data()[0]), "%v", v)
+		assert.True(t, math.IsNaN(a.Mul(NewTensor(d2{{v, 1}})).SumAll().Data()[0]))
+
+		// the gradient of the right operand, 0 * Inf in a^T @ grad
+		w := NewTensor(d2{{1}, {1}}).SetRequiresGrad(true)
+		NewTensor(d2{{0, 1}, {1, 1}}).Matmul(w).Mul(NewTensor(d2{{v}, {1}})).Backward()
+		assert.True(t, math.IsNaN(w.Grad()[0]), "%v", v)
+	}
+	// the zeros are still skipped against finite values
+	assert.Equal(t, []float64{1}, a.Matmul(NewTensor(d2{{5}, {1}})).Data())
+}
+
+// the shape of a linear layer over a MNIST batch
+func BenchmarkMatmul(b *testing.B) {
+	x := Randn(64, 784)
+	w := Randn(784, 10).SetRequiresGrad(true)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x.Matmul(w).Backward()
+		w.ZeroGrad()
+	}
+}
+
+func BenchmarkMatmulLarge(b *testing.B) {
+	x := Randn(256, 512).SetRequiresGrad(true)
+	w := Randn(512, 256).SetRequiresGrad(true)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x.Matmul(w).Backward()
+	}
+}
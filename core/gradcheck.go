@@ -0,0 +1,167 @@
+package core
+
+import (
+	"dexianta/tgnn/util"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// GradCheckOptions configures GradCheck and GradCheckV, the zero fields take the defaults
+type GradCheckOptions struct {
+	Eps float64 // the step of the central differences, 1e-6 by default
+	// an element matches when |analytic - numeric| <= Atol + Rtol * |numeric|, 1e-5 and 1e-3 by default
+	// a tiny Rtol (e.g. 1e-9) makes it a plain absolute check
+	Atol, Rtol float64
+	Worst      int // the number of mismatches reported, 5 by default
+}
+
+func (o GradCheckOptions) withDefaults() GradCheckOptions {
+	if o.Eps == 0 {
+		o.Eps = 1e-6
+	}
+	if o.Atol == 0 {
+		o.Atol = 1e-5
+	}
+	if o.Rtol == 0 {
+		o.Rtol = 1e-3
+	}
+	if o.Worst == 0 {
+		o.Worst = 5
+	}
+	return o
+}
+
+// GradMismatch is an element of an input where the analytical and the numerical gradients disagree
+type GradMismatch struct {
+	Input    int // the index of the input
+	Pos      Pos // the position of the element in the input, nil for a V
+	Analytic float64
+	Numeric  float64
+}
+
+func (m GradMismatch) diff() float64 {
+	return math.Abs(m.Analytic - m.Numeric)
+}
+
+// GradCheckError is returned by GradCheck and GradCheckV when some gradients disagree
+type GradCheckError struct {
+	Mismatches []GradMismatch // the worst ones, by decreasing absolute difference
+	Count      int            // the number of mismatching elements
+	Checked    int            // the number of elements checked
+}
+
+func (e *GradCheckError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "gradcheck: %d of %d elements mismatch, the worst:", e.Count, e.Checked)
+	for _, m := range e.Mismatches {
+		fmt.Fprintf(&b, "\n\tinput %d", m.Input)
+		if m.Pos != nil {
+			fmt.Fprintf(&b, " %v", m.Pos)
+		}
+		fmt.Fprintf(&b, ": analytic %g, numeric %g, diff %g", m.Analytic, m.Numeric, m.diff())
+	}
+	return b.String()
+}
+
+// gradChecker collects the mismatches of the elements
+type gradChecker struct {
+	GradCheckOptions
+	mismatches []GradMismatch
+	checked    int
+}
+
+func (c *gradChecker) check(m GradMismatch) {
+	c.checked++
+	// written so a NaN on either side is a mismatch
+	if !(m.diff() <= c.Atol+c.Rtol*math.Abs(m.Numeric)) {
+		c.mismatches = append(c.mismatches, m)
+	}
+}
+
+func (c *gradChecker) err() error {
+	if len(c.mismatches) == 0 {
+		return nil
+	}
+	sort.SliceStable(c.mismatches, func(i, j int) bool {
+		// the NaNs first
+		di, dj := c.mismatches[i].diff(), c.mismatches[j].diff()
+		return math.IsNaN(di) && !math.IsNaN(dj) || di > dj
+	})
+	return &GradCheckError{Mismatches: c.mismatches[:util.Imin(c.Worst, len(c.mismatches))], Count: len(c.mismatches),
+		Checked: c.checked}
+}
+
+// GradCheck compares the gradients of fn computed by back propagation with central finite differences
+// (f(x + eps) - f(x - eps)) / 2eps, for every element of the inputs requiring grad, the other inputs (e.g. indices)
+// are passed to fn as is. it returns a *GradCheckError reporting the worst elements when they disagree, e.g.
+//
+//	err := GradCheck(func(xs ...Tensor) Tensor { return xs[0].Matmul(xs[1]) },
+//		[]Tensor{Randn(2, 3).SetRequiresGrad(true), Randn(3, 4).SetRequiresGrad(true)}, GradCheckOptions{})
+//
+// the output of fn can have any shape, it is reduced to a scalar by a sum weighted by fixed random weights, so a
+// wrong gradient can't hide behind a sum (e.g. the sum of a softmax is constant). the inputs must be contiguous since
+// they are perturbed in place, and fn must be deterministic (e.g. no dropout in training mode)
+func GradCheck(fn func(xs ...Tensor) Tensor, xs []Tensor, opts GradCheckOptions) error {
+	c := gradChecker{GradCheckOptions: opts.withDefaults()}
+	var weights Tensor
+	loss := func() Tensor {
+		out := fn(xs...)
+		if weights.storage == nil {
+			rng := rand.New(rand.NewSource(1))
+			weights = Zeros(out.Shape...)
+			for i := range weights.data {
+				weights.data[i] = rng.NormFloat64()
+			}
+		}
+		return out.Mul(weights).SumAll()
+	}
+
+	for i, x := range xs {
+		if !x.IsContiguous() {
+			panic(fmt.Sprintf("gradcheck of the non-contiguous input %d (shape: %v, strides: %v)", i, x.Shape,
+				x.stride()))
+		}
+		x.ZeroGrad()
+	}
+	loss().Backward()
+
+	for i, x := range xs {
+		if !x.requiresGrad {
+			continue
+		}
+		data, grad := x.Data(), x.Grad()
+		for j := range data {
+			v := data[j]
+			data[j] = v + c.Eps
+			hi := loss().Data()[0]
+			data[j] = v - c.Eps
+			lo := loss().Data()[0]
+			data[j] = v
+			c.check(GradMismatch{Input: i, Pos: toPos(j, x.Shape), Analytic: grad[j], Numeric: (hi - lo) / (2 * c.Eps)})
+		}
+	}
+	return c.err()
+}
+
+// GradCheckV is GradCheck for a function of Vs
+func GradCheckV(fn func(vs ...*V) *V, vs []*V, opts GradCheckOptions) error {
+	c := gradChecker{GradCheckOptions: opts.withDefaults()}
+	for _, v := range vs {
+		v.Grad = 0
+	}
+	fn(vs...).Backward()
+
+	for i, v := range vs {
+		x := v.Data
+		v.Data = x + c.Eps
+		hi := fn(vs...).Data
+		v.Data = x - c.Eps
+		lo := fn(vs...).Data
+		v.Data = x
+		c.check(GradMismatch{Input: i, Analytic: v.Grad, Numeric: (hi - lo) / (2 * c.Eps)})
+	}
+	return c.err()
+}
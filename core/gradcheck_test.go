@@ -0,0 +1,243 @@
+package core
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// param returns a leaf requiring grad with the values of t
+func param(t Tensor) Tensor {
+	return t.Contiguous().Detach().SetRequiresGrad(true)
+}
+
+// smooth returns a param of the shape with normal values drawn from rng, moved at least 0.05 away from the kinks of
+// the tested ops (0 and ±0.5) where the finite differences don't match the gradient
+func smooth(rng *rand.Rand, dims ...int) Tensor {
+	ret := Zeros(dims...)
+	for i := range ret.data {
+		v := rng.NormFloat64()
+		for _, k := range []float64{-0.5, 0, 0.5} {
+			if math.Abs(v-k) < 0.05 {
+				v = k + math.Copysign(0.05, v-k)
+			}
+		}
+		ret.data[i] = v
+	}
+	return param(ret)
+}
+
+// positive returns a param of the shape with values in [0.5, 1.5)
+func positive(rng *rand.Rand, dims ...int) Tensor {
+	return param(smooth(rng, dims...).Abs().Clamp(0, 1).AddS(0.5))
+}
+
+func TestGradCheck(t *testing.T) {
+	x := param(NewTensor(d2{{1, 2, 3}, {4, 5, 6}}))
+	// the gradient of x^2 is 2x, the backward here gets it wrong at [1, 2] and a bit off at [0, 1]
+	square := func(xs ...Tensor) Tensor {
+		data := xs[0].Data()
+		ret := make([]float64, len(data))
+		for i, v := range data {
+			ret[i] = v * v
+		}
+		return Function("square", xs[0].Shape, ret, func(grad []float64) [][]float64 {
+			g := make([]float64, len(grad))
+			for i := range grad {
+				g[i] = 2 * data[i] * grad[i]
+			}
+			g[5] = 0
+			g[1] += 0.01 * grad[1]
+			return [][]float64{g}
+		}, xs...)
+	}
+
+	err := GradCheck(square, []Tensor{x}, GradCheckOptions{Worst: 1})
+	var gcErr *GradCheckError
+	assert.ErrorAs(t, err, &gcErr)
+	assert.Equal(t, 2, gcErr.Count)
+	assert.Equal(t, 6, gcErr.Checked)
+	assert.Len(t, gcErr.Mismatches, 1)
+	m := gcErr.Mismatches[0]
+	assert.Equal(t, Pos{1, 2}, m.Pos)
+	assert.Equal(t, 0., m.Analytic)
+	assert.Contains(t, err.Error(), "2 of 6 elements mismatch")
+	assert.Contains(t, err.Error(), "input 0 [1 2]: analytic 0")
+
+	// a larger tolerance only leaves the worst one
+	err = GradCheck(square, []Tensor{x}, GradCheckOptions{Atol: 1})
+	assert.ErrorAs(t, err, &gcErr)
+	assert.Equal(t, 1, gcErr.Count)
+	// the inputs are left as is
+	assert.Equal(t, []float64{1, 2, 3, 4, 5, 6}, x.Data())
+
+	// the inputs without grad are only passed through
+	index := NewTensor(d1{2, 0})
+	assert.Nil(t, GradCheck(func(xs ...Tensor) Tensor { return xs[0].IndexSelect(1, xs[1]) }, []Tensor{x, index},
+		GradCheckOptions{}))
+	assert.Panics(t, func() { GradCheck(square, []Tensor{param(Randn(3, 2)).T()}, GradCheckOptions{}) })
+}
+
+func TestGradCheckV(t *testing.T) {
+	a, b := Vx(1.5), Vx(-2)
+	assert.Nil(t, GradCheckV(func(vs ...*V) *V { return vs[0].Mul(vs[1]).Sub(vs[1].Div(vs[0])).Pow(2) },
+		[]*V{a, b}, GradCheckOptions{}))
+
+	// an activation with the derivative of its opposite
+	wrong := func(vs ...*V) *V {
+		return &V{Data: math.Sin(vs[0].Data), prev: &UnaryOp{op: "sin", v: vs[0], df: func(x, y float64) float64 {
+			return -math.Cos(x)
+		}}}
+	}
+	err := GradCheckV(wrong, []*V{a}, GradCheckOptions{})
+	var gcErr *GradCheckError
+	assert.ErrorAs(t, err, &gcErr)
+	assert.InDelta(t, math.Cos(1.5), gcErr.Mismatches[0].Numeric, 1e-8)
+	assert.Nil(t, gcErr.Mismatches[0].Pos)
+}
+
+func TestGradCheckVOps(t *testing.T) {
+	ops := map[string]func(vs ...*V) *V{
+		"add":        func(vs ...*V) *V { return vs[0].Add(vs[1]) },
+		"sub":        func(vs ...*V) *V { return vs[0].Sub(vs[1]) },
+		"mul":        func(vs ...*V) *V { return vs[0].Mul(vs[1]) },
+		"div":        func(vs ...*V) *V { return vs[0].Div(vs[1]) },
+		"neg":        func(vs ...*V) *V { return vs[0].Neg() },
+		"exp":        func(vs ...*V) *V { return vs[0].Exp() },
+		"log":        func(vs ...*V) *V { return vs[1].Log() },
+		"pow":        func(vs ...*V) *V { return vs[1].Pow(2.5) },
+		"relu":       func(vs ...*V) *V { return vs[0].ReLu().Add(vs[1].ReLu()) },
+		"sigmoid":    func(vs ...*V) *V { return vs[0].Sigmoid() },
+		"tanh":       func(vs ...*V) *V { return vs[0].Tanh() },
+		"leaky relu": func(vs ...*V) *V { return vs[0].LeakyReLU(0.1) },
+		"elu":        func(vs ...*V) *V { return vs[0].ELU(1) },
+		"gelu":       func(vs ...*V) *V { return vs[0].GELU() },
+		"silu":       func(vs ...*V) *V { return vs[0].SiLU() },
+		"softplus":   func(vs ...*V) *V { return vs[0].Softplus() },
+		"softsign":   func(vs ...*V) *V { return vs[0].Softsign() },
+		"hard tanh":  func(vs ...*V) *V { return vs[0].HardTanh(-1, 1).Add(vs[1].HardTanh(-1, 1)) },
+	}
+	for name, fn := range ops {
+		assert.Nil(t, GradCheckV(fn, []*V{Vx(-0.7), Vx(1.3)}, GradCheckOptions{}), name)
+	}
+}
+
+// every differentiable op of Tensor, on seeded random inputs away from the kinks
+func TestGradCheckOps(t *testing.T) {
+	// a source per op, since the maps are iterated in a random order
+	seeded := func() *rand.Rand { return rand.New(rand.NewSource(1)) }
+	unary := map[string]func(x Tensor) Tensor{
+		"neg":        Tensor.Neg,
+		"exp":        Tensor.Exp,
+		"pow":        func(x Tensor) Tensor { return x.Pow(3) },
+		"relu":       Tensor.ReLu,
+		"abs":        Tensor.Abs,
+		"sign":       Tensor.Sign,
+		"sin":        Tensor.Sin,
+		"cos":        Tensor.Cos,
+		"tan":        func(x Tensor) Tensor { return x.MulS(0.3).Tan() },
+		"expm1":      Tensor.Expm1,
+		"clamp":      func(x Tensor) Tensor { return x.Clamp(-0.5, 0.5) },
+		"scalars":    func(x Tensor) Tensor { return x.AddS(1).MulS(3).DivS(2) },
+		"sigmoid":    Tensor.Sigmoid,
+		"tanh":       Tensor.Tanh,
+		"leaky relu": func(x Tensor) Tensor { return x.LeakyReLU(0.1) },
+		"elu":        func(x Tensor) Tensor { return x.ELU(1) },
+		"gelu":       Tensor.GELU,
+		"silu":       Tensor.SiLU,
+		"softplus":   Tensor.Softplus,
+		"softsign":   Tensor.Softsign,
+		"hard tanh":  func(x Tensor) Tensor { return x.HardTanh(-0.5, 0.5) },
+
+		"sum":      func(x Tensor) Tensor { return x.Sum(1, false) },
+		"mean":     func(x Tensor) Tensor { return x.Mean(0, true) },
+		"sum all":  Tensor.SumAll,
+		"mean all": Tensor.MeanAll,
+		"max":      func(x Tensor) Tensor { return x.Max(1, false) },
+		"min":      func(x Tensor) Tensor { return x.Min(-1, true) },
+		"var":      func(x Tensor) Tensor { return x.Var(1, true, false) },
+		"std":      func(x Tensor) Tensor { return x.Std(0, false, true) },
+		"prod":     func(x Tensor) Tensor { return x.Prod(1, false) },
+
+		"slice":       func(x Tensor) Tensor { return x.Slice([2]int{1, 3}) },
+		"slice step":  func(x Tensor) Tensor { return x.SliceStep(1, 0, 4, 2) },
+		"index":       func(x Tensor) Tensor { return x.Index(1, 2) },
+		"view":        func(x Tensor) Tensor { return x.View(4, 3) },
+		"reshape":     func(x Tensor) Tensor { return x.T().Reshape(-1) },
+		"flatten":     func(x Tensor) Tensor { return x.Unsqueeze(0).Flatten(1, 2) },
+		"permute":     func(x Tensor) Tensor { return x.Unsqueeze(1).Permute(2, 0, 1).Squeeze(2) },
+		"transpose":   func(x Tensor) Tensor { return x.Transpose(0, 1).Contiguous() },
+		"chunk":       func(x Tensor) Tensor { return x.Chunk(2, 1)[1] },
+		"cat":         func(x Tensor) Tensor { return Cat([]Tensor{x, x.Exp()}, 1) },
+		"stack":       func(x Tensor) Tensor { return Stack([]Tensor{x, x.Sin()}, 0) },
+		"index sel":   func(x Tensor) Tensor { return x.IndexSelect(1, NewTensor(d1{3, 0, 3})) },
+		"gather":      func(x Tensor) Tensor { return x.Gather(1, NewTensor(d2{{0, 3}, {1, 1}, {2, 0}})) },
+		"masked sel":  func(x Tensor) Tensor { return x.MaskedSelect(NewTensor(d1{1, 0, 0, 1})) },
+		"softmax":     func(x Tensor) Tensor { return Softmax(x, 1) },
+		"log softmax": func(x Tensor) Tensor { return LogSoftmax(x, 0) },
+		"normalize": func(x Tensor) Tensor {
+			ret, _, _ := Normalize(x, 1, 1e-5)
+			return ret
+		},
+	}
+	for name, fn := range unary {
+		assert.Nil(t, GradCheck(func(xs ...Tensor) Tensor { return fn(xs[0]) }, []Tensor{smooth(seeded(), 3, 4)},
+			GradCheckOptions{}), name)
+	}
+
+	// the ops only defined for positive inputs
+	for name, fn := range map[string]func(x Tensor) Tensor{
+		"log":   Tensor.Log,
+		"sqrt":  Tensor.Sqrt,
+		"rsqrt": Tensor.Rsqrt,
+		"log1p": Tensor.Log1p,
+		"pow":   func(x Tensor) Tensor { return x.Pow(-1.5) },
+	} {
+		assert.Nil(t, GradCheck(func(xs ...Tensor) Tensor { return fn(xs[0]) }, []Tensor{positive(seeded(), 3, 4)},
+			GradCheckOptions{}), name)
+	}
+
+	// with broadcasting
+	binary := map[string]func(a, b Tensor) Tensor{
+		"add":     Tensor.Add,
+		"sub":     Tensor.Sub,
+		"mul":     Tensor.Mul,
+		"div":     func(a, b Tensor) Tensor { return a.Div(b.Abs().AddS(0.5)) },
+		"maximum": Tensor.Maximum,
+		"minimum": Tensor.Minimum,
+		"where":   func(a, b Tensor) Tensor { return Where(NewTensor(d2{{1, 0, 1, 0}}), a, b) },
+	}
+	for name, fn := range binary {
+		rng := seeded()
+		assert.Nil(t, GradCheck(func(xs ...Tensor) Tensor { return fn(xs[0], xs[1]) },
+			[]Tensor{smooth(rng, 3, 4), smooth(rng, 3, 1)}, GradCheckOptions{}), name)
+	}
+
+	rng := seeded()
+	for name, c := range map[string]struct {
+		fn func(xs ...Tensor) Tensor
+		xs []Tensor
+	}{
+		"matmul": {func(xs ...Tensor) Tensor { return xs[0].Matmul(xs[1]) },
+			[]Tensor{smooth(rng, 3, 4), smooth(rng, 4, 2)}},
+		"batched matmul": {func(xs ...Tensor) Tensor { return xs[0].Matmul(xs[1]) },
+			[]Tensor{smooth(rng, 2, 3, 4), smooth(rng, 4, 2)}},
+		"matrix vector": {func(xs ...Tensor) Tensor { return xs[0].Matmul(xs[1]) },
+			[]Tensor{smooth(rng, 3, 4), smooth(rng, 4)}},
+		"embedding": {func(xs ...Tensor) Tensor { return Embedding(xs[0], xs[1], -1) },
+			[]Tensor{smooth(rng, 4, 3), NewTensor(d2{{0, 2}, {3, 0}})}},
+		"conv2d": {func(xs ...Tensor) Tensor {
+			return Conv2d(xs[0], xs[1], xs[2], [2]int{2, 1}, [2]int{1, 1}, [2]int{1, 2}, 2)
+		}, []Tensor{smooth(rng, 2, 4, 5, 5), smooth(rng, 2, 2, 3, 3), smooth(rng, 2)}},
+		"max pool": {func(xs ...Tensor) Tensor { return MaxPool2d(xs[0], [2]int{2, 2}, [2]int{2, 2}, [2]int{1, 1}) },
+			[]Tensor{smooth(rng, 1, 2, 5, 5)}},
+		"avg pool": {func(xs ...Tensor) Tensor { return AvgPool2d(xs[0], [2]int{3, 3}, [2]int{2, 2}, [2]int{1, 1}) },
+			[]Tensor{smooth(rng, 1, 2, 5, 5)}},
+		"adaptive avg pool": {func(xs ...Tensor) Tensor { return AdaptiveAvgPool2d(xs[0], 2, 3) },
+			[]Tensor{smooth(rng, 1, 2, 5, 5)}},
+	} {
+		assert.Nil(t, GradCheck(c.fn, c.xs, GradCheckOptions{}), name)
+	}
+}
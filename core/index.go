@@ -0,0 +1,193 @@
+package core
+
+import (
+	"fmt"
+	"math"
+)
+
+// normIndex turns a negative index (counting from the end) into a positive one
+func normIndex(i, size int) int {
+	if i < 0 {
+		i += size
+	}
+	return i
+}
+
+// SliceStep takes the elements start, start+step, ... before end along dim, like python's start:end:step
+// negative start and end count from the end of the dimension, and they are clamped into the dimension
+// so t.SliceStep(1, 0, math.MaxInt, 2) takes every other column
+// the result is a view sharing the storage of t
+func (t Tensor) SliceStep(dim, start, end, step int) Tensor {
+	dim = normDim(dim, t.Dim())
+	if step <= 0 {
+		panic(fmt.Sprintf("slice step must be positive, got %d", step))
+	}
+
+	size := t.Shape[dim]
+	clamp := func(i int) int {
+		i = normIndex(i, size)
+		if i < 0 {
+			return 0
+		}
+		if i > size {
+			return size
+		}
+		return i
+	}
+	start, end = clamp(start), clamp(end)
+
+	n := 0
+	if end > start {
+		n = (end - start + step - 1) / step
+	}
+
+	strides := append([]int{}, t.stride()...)
+	shape := append(Shape{}, t.Shape...)
+	offset := t.offset + start*strides[dim]
+	shape[dim] = n
+	strides[dim] *= step
+	return t.view(shape, strides, offset)
+}
+
+// Index selects the i-th element along dim, the dimension is removed from the result
+// e.g. t.Index(0, -1) is the last row of a matrix
+func (t Tensor) Index(dim, i int) Tensor {
+	dim = normDim(dim, t.Dim())
+	if j := normIndex(i, t.Shape[dim]); j < 0 || j >= t.Shape[dim] {
+		panic(fmt.Sprintf("index %d is out of range for dim %d of shape %v", i, dim, t.Shape))
+	}
+	return t.SliceStep(dim, i, normIndex(i, t.Shape[dim])+1, 1).Squeeze(dim)
+}
+
+// toIndices converts the values of an index tensor into ints in [0, size)
+// negative values count from the end like the other indices
+func toIndices(index Tensor, size int) []int {
+	vals := index.values()
+	ret := make([]int, len(vals))
+	for i, v := range vals {
+		if v != math.Trunc(v) {
+			panic(fmt.Sprintf("index tensor has non integer value %v", v))
+		}
+		ret[i] = normIndex(int(v), size)
+		if ret[i] < 0 || ret[i] >= size {
+			panic(fmt.Sprintf("index %v is out of range [0, %d)", v, size))
+		}
+	}
+	return ret
+}
+
+// IndexSelect takes the entries of index along dim, index is a 1-D tensor of integers
+// e.g. rows of an embedding matrix: weights.IndexSelect(0, NewTensor(d1{3, 0, 3}))
+func (t Tensor) IndexSelect(dim int, index Tensor) Tensor {
+	dim = normDim(dim, t.Dim())
+	if index.Dim() != 1 {
+		panic(fmt.Sprintf("index select expects a 1-D index, got shape %v", index.Shape))
+	}
+	t = t.contiguous()
+	idx := toIndices(index, t.Shape[dim])
+
+	shape := append(Shape{}, t.Shape...)
+	shape[dim] = len(idx)
+
+	// each selected entry is a block of `inner` contiguous elements
+	outer, n, inner := splitDim(t.Shape, dim)
+	data := make([]float64, shape.Cap())
+	for o := 0; o < outer; o++ {
+		for j, i := range idx {
+			copy(data[(o*len(idx)+j)*inner:(o*len(idx)+j+1)*inner], t.data[(o*n+i)*inner:(o*n+i+1)*inner])
+		}
+	}
+
+	ret := fromData(data, shape)
+	record(&ret, "index_select", func(grad []float64) {
+		if !t.requiresGrad {
+			return
+		}
+		// an entry selected multiple times accumulates all of its gradients
+		tg := t.gradBuf()
+		for o := 0; o < outer; o++ {
+			for j, i := range idx {
+				src := grad[(o*len(idx)+j)*inner : (o*len(idx)+j+1)*inner]
+				dst := tg[(o*n+i)*inner : (o*n+i+1)*inner]
+				for k := range src {
+					dst[k] += src[k]
+				}
+			}
+		}
+	}, t)
+	return ret
+}
+
+// Gather picks the values along dim by index, as torch.gather:
+//
+//	ret[i][j][k] = t[index[i][j][k]][j][k]  // dim == 0
+//	ret[i][j][k] = t[i][index[i][j][k]][k]  // dim == 1
+//
+// index has the same number of dims as t, and the result has the shape of index
+// e.g. the log probability of the target classes: logProbs.Gather(1, target.Unsqueeze(1))
+func (t Tensor) Gather(dim int, index Tensor) Tensor {
+	dim = normDim(dim, t.Dim())
+	if index.Dim() != t.Dim() {
+		panic(fmt.Sprintf("gather: index shape %v doesn't match shape %v", index.Shape, t.Shape))
+	}
+	for d := range t.Shape {
+		if d != dim && index.Shape[d] > t.Shape[d] {
+			panic(fmt.Sprintf("gather: index shape %v is out of shape %v at dim %d", index.Shape, t.Shape, d))
+		}
+	}
+	t = t.contiguous()
+	idx := toIndices(index, t.Shape[dim])
+	strides := rowMajorStrides(t.Shape)
+
+	// src[i] is the element of t picked for the i-th output
+	src := make([]int, len(idx))
+	data := make([]float64, len(idx))
+	for i := range idx {
+		pos := toPos(i, index.Shape)
+		pos[dim] = idx[i]
+		for d := range pos {
+			src[i] += pos[d] * strides[d]
+		}
+		data[i] = t.data[src[i]]
+	}
+
+	ret := fromData(data, index.Shape)
+	record(&ret, "gather", func(grad []float64) {
+		for i := range grad {
+			accumulate(t, src[i], grad[i])
+		}
+	}, t)
+	return ret
+}
+
+// MaskedSelect returns a 1-D tensor of the elements where mask is not 0
+// mask is broadcast to the shape of t
+func (t Tensor) MaskedSelect(mask Tensor) Tensor {
+	shape, err := broadcastShape(t.Shape, mask.Shape)
+	if err != nil || !shape.Equal(t.Shape) {
+		panic(fmt.Sprintf("mask of shape %v cannot be applied on shape %v", mask.Shape, t.Shape))
+	}
+	t = t.contiguous()
+	m := mask.values()
+	mi := broadcastIndex(mask.Shape, t.Shape)
+
+	var src []int
+	var data []float64
+	for i := range t.data {
+		if m[mi[i]] != 0 {
+			src = append(src, i)
+			data = append(data, t.data[i])
+		}
+	}
+	if data == nil {
+		data = []float64{}
+	}
+
+	ret := fromData(data, Shape{len(data)})
+	record(&ret, "masked_select", func(grad []float64) {
+		for i := range grad {
+			accumulate(t, src[i], grad[i])
+		}
+	}, t)
+	return ret
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegativeSlice(t *testing.T) {
+	a := NewTensor(d2{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}})
+	assert.True(t, a.Slice(S{-1, 3}).Equal(NewTensor(d2{{7, 8, 9}})))
+	assert.True(t, a.Slice(S{0, -1}, S{-2, 3}).Equal(NewTensor(d2{{2, 3}, {5, 6}})))
+	assert.Panics(t, func() { a.Slice(S{-4, 1}) })
+}
+
+func TestSliceStep(t *testing.T) {
+	a := NewTensor(d2{{1, 2, 3, 4, 5}, {6, 7, 8, 9, 10}})
+	assert.True(t, a.SliceStep(1, 0, math.MaxInt, 2).Equal(NewTensor(d2{{1, 3, 5}, {6, 8, 10}})))
+	assert.True(t, a.SliceStep(-1, 1, -1, 2).Equal(NewTensor(d2{{2, 4}, {7, 9}})))
+	assert.True(t, a.SliceStep(0, -1, 10, 1).Equal(NewTensor(d2{{6, 7, 8, 9, 10}})))
+	assert.Equal(t, Shape{2, 0}, a.SliceStep(1, 4, 2, 1).Shape)
+	assert.Panics(t, func() { a.SliceStep(1, 0, 5, 0) })
+
+	// steps on a transposed view
+	b := a.T().SliceStep(0, 1, 5, 3)
+	assert.True(t, b.Equal(NewTensor(d2{{2, 7}, {5, 10}})))
+}
+
+func TestIndex(t *testing.T) {
+	a := NewTensor(d3{{{1, 2}, {3, 4}}, {{5, 6}, {7, 8}}})
+	assert.True(t, a.Index(0, 1).Equal(NewTensor(d2{{5, 6}, {7, 8}})))
+	assert.True(t, a.Index(1, -1).Equal(NewTensor(d2{{3, 4}, {7, 8}})))
+	assert.True(t, a.Index(2, 0).Equal(NewTensor(d2{{1, 3}, {5, 7}})))
+	assert.Equal(t, Shape{}, a.Index(0, 0).Index(0, 1).Index(0, 1).Shape)
+	assert.Equal(t, 4., a.Index(0, 0).Index(0, 1).Index(0, 1).Data()[0])
+	assert.Panics(t, func() { a.Index(0, 2) })
+	assert.Panics(t, func() { a.Index(0, -3) })
+}
+
+func TestIndexSelect(t *testing.T) {
+	a := NewTensor(d2{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}})
+	assert.True(t, a.IndexSelect(0, NewTensor(d1{2, 0, 2})).Equal(NewTensor(d2{{7, 8, 9}, {1, 2, 3}, {7, 8, 9}})))
+	assert.True(t, a.IndexSelect(1, NewTensor(d1{-1, 1})).Equal(NewTensor(d2{{3, 2}, {6, 5}, {9, 8}})))
+	assert.Panics(t, func() { a.IndexSelect(0, NewTensor(d1{3})) })
+	assert.Panics(t, func() { a.IndexSelect(0, NewTensor(d1{0.5})) })
+}
+
+func TestGather(t *testing.T) {
+	a := NewTensor(d2{{1, 2, 3}, {4, 5, 6}})
+	assert.True(t, a.Gather(1, NewTensor(d2{{2}, {0}})).Equal(NewTensor(d2{{3}, {4}})))
+	assert.True(t, a.Gather(0, NewTensor(d2{{1, 0, 1}})).Equal(NewTensor(d2{{4, 2, 6}})))
+	assert.True(t, a.Gather(1, NewTensor(d2{{0, 0}, {1, 2}})).Equal(NewTensor(d2{{1, 1}, {5, 6}})))
+	assert.Panics(t, func() { a.Gather(1, NewTensor(d1{0, 1})) })
+}
+
+func TestMaskedSelect(t *testing.T) {
+	a := NewTensor(d2{{1, 2, 3}, {4, 5, 6}})
+	assert.True(t, a.MaskedSelect(NewTensor(d2{{1, 0, 1}, {0, 0, 1}})).Equal(NewTensor(d1{1, 3, 6})))
+	// broadcast mask
+	assert.True(t, a.MaskedSelect(NewTensor(d1{0, 1, 0})).Equal(NewTensor(d1{2, 5})))
+	assert.Equal(t, Shape{0}, a.MaskedSelect(Zeros(2, 3)).Shape)
+	assert.Panics(t, func() { a.MaskedSelect(Ones(2)) })
+}
+
+func TestIndexBackward(t *testing.T) {
+	a := Randn(3, 4).SetRequiresGrad(true)
+	specs := map[string]func(...Tensor) Tensor{
+		"slice step":   func(...Tensor) Tensor { return a.SliceStep(1, -3, -1, 1).Add(a.SliceStep(1, 0, 4, 3)).Pow(2) },
+		"index":        func(...Tensor) Tensor { return a.Index(0, -1).Mul(a.Index(1, 2).Index(0, 0)).Exp() },
+		"index select": func(...Tensor) Tensor { return a.IndexSelect(1, NewTensor(d1{3, 0, 3})).Pow(2) },
+		"gather":       func(...Tensor) Tensor { return a.Gather(1, NewTensor(d2{{1, 1}, {0, 3}, {2, 1}})).Pow(3) },
+		"masked":       func(...Tensor) Tensor { return a.MaskedSelect(NewTensor(d1{1, 0, 0, 1})).Exp() },
+	}
+
+	for name, fn := range specs {
+		t.Run(name, func(t *testing.T) {
+			assert.Nil(t, GradCheck(fn, []Tensor{a}, GradCheckOptions{Atol: 1e-5, Rtol: 1e-9}))
+		})
+	}
+}
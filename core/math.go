@@ -0,0 +1,118 @@
+package core
+
+import (
+	"dexianta/tgnn/util"
+	"fmt"
+	"math"
+)
+
+// the element-wise math functions, all of them are differentiable
+// the derivative at a point where the function isn't differentiable (e.g. Abs at 0) is taken as 0, same as pytorch
+
+func (t Tensor) Sqrt() Tensor {
+	return unaryOp(t, "sqrt", math.Sqrt, func(x, y float64) float64 { return 0.5 / y })
+}
+
+// Rsqrt is 1 / sqrt(x)
+func (t Tensor) Rsqrt() Tensor {
+	return unaryOp(t, "rsqrt",
+		func(x float64) float64 { return 1 / math.Sqrt(x) },
+		func(x, y float64) float64 { return -0.5 * y * y * y })
+}
+
+func (t Tensor) Abs() Tensor {
+	return unaryOp(t, "abs", math.Abs, func(x, y float64) float64 { return util.Sign(x) })
+}
+
+// Sign is 1 for positive x, -1 for negative x and 0 for 0, its gradient is always 0
+func (t Tensor) Sign() Tensor {
+	return unaryOp(t, "sign", util.Sign, func(x, y float64) float64 { return 0 })
+}
+
+func (t Tensor) Sin() Tensor {
+	return unaryOp(t, "sin", math.Sin, func(x, y float64) float64 { return math.Cos(x) })
+}
+
+func (t Tensor) Cos() Tensor {
+	return unaryOp(t, "cos", math.Cos, func(x, y float64) float64 { return -math.Sin(x) })
+}
+
+func (t Tensor) Tan() Tensor {
+	return unaryOp(t, "tan", math.Tan, func(x, y float64) float64 { return 1 + y*y })
+}
+
+// Log1p is log(1 + x), accurate for small x
+func (t Tensor) Log1p() Tensor {
+	return unaryOp(t, "log1p", math.Log1p, func(x, y float64) float64 { return 1 / (1 + x) })
+}
+
+// Expm1 is e^x - 1, accurate for small x
+func (t Tensor) Expm1() Tensor {
+	return unaryOp(t, "expm1", math.Expm1, func(x, y float64) float64 { return y + 1 })
+}
+
+// Clamp limits the elements into [min, max], the gradient only flows through the elements within the range
+// use math.Inf for a single sided clamp, e.g. t.Clamp(0, math.Inf(1))
+func (t Tensor) Clamp(min, max float64) Tensor {
+	if min > max {
+		panic(fmt.Sprintf("clamp: min %v > max %v", min, max))
+	}
+	return unaryOp(t, "clamp",
+		func(x float64) float64 { return math.Min(math.Max(x, min), max) },
+		func(x, y float64) float64 {
+			if x >= min && x <= max {
+				return 1
+			}
+			return 0
+		})
+}
+
+// Maximum is the element-wise max of t and a, broadcast together
+// in case of a tie, the gradient is split evenly between t and a
+func (t Tensor) Maximum(a Tensor) Tensor {
+	return broadcastOp(t, a, "maximum")
+}
+
+// Minimum is the element-wise min of t and a, broadcast together
+// in case of a tie, the gradient is split evenly between t and a
+func (t Tensor) Minimum(a Tensor) Tensor {
+	return broadcastOp(t, a, "minimum")
+}
+
+// Where picks the elements of a where cond is not 0, and the ones of b otherwise
+// cond, a and b are broadcast together, the gradient goes to the picked element only
+// e.g. a masked fill: Where(mask, All(math.Inf(-1), []int{1}), scores)
+func Where(cond, a, b Tensor) Tensor {
+	shape, err := broadcastShape(cond.Shape, a.Shape)
+	if err == nil {
+		shape, err = broadcastShape(shape, b.Shape)
+	}
+	if err != nil {
+		panic(fmt.Errorf("where: cannot broadcast cond(%v), a(%v), b(%v)", cond.Shape, a.Shape, b.Shape))
+	}
+
+	c := cond.values()
+	a, b = a.contiguous(), b.contiguous()
+	ci, ai, bi := broadcastIndex(cond.Shape, shape), broadcastIndex(a.Shape, shape), broadcastIndex(b.Shape, shape)
+
+	data := make([]float64, shape.Cap())
+	for i := range data {
+		if c[ci[i]] != 0 {
+			data[i] = a.data[ai[i]]
+		} else {
+			data[i] = b.data[bi[i]]
+		}
+	}
+
+	ret := fromData(data, shape)
+	record(&ret, "where", func(grad []float64) {
+		for i := range grad {
+			if c[ci[i]] != 0 {
+				accumulate(a, ai[i], grad[i])
+			} else {
+				accumulate(b, bi[i], grad[i])
+			}
+		}
+	}, a, b)
+	return ret
+}
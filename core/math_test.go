@@ -0,0 +1,95 @@
+package core
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnaryMath(t *testing.T) {
+	x := NewTensor(d1{-2, -0.5, 0, 0.5, 2})
+	p := NewTensor(d1{0.25, 1, 4})
+
+	assert.Nil(t, EqualFloatArray(p.Sqrt().Data(), []float64{0.5, 1, 2}, 1e-12))
+	assert.Nil(t, EqualFloatArray(p.Rsqrt().Data(), []float64{2, 1, 0.5}, 1e-12))
+	assert.Nil(t, EqualFloatArray(x.Abs().Data(), []float64{2, 0.5, 0, 0.5, 2}, 0))
+	assert.Nil(t, EqualFloatArray(x.Sign().Data(), []float64{-1, -1, 0, 1, 1}, 0))
+	assert.Nil(t, EqualFloatArray(x.Clamp(-1, 1).Data(), []float64{-1, -0.5, 0, 0.5, 1}, 0))
+	assert.Nil(t, EqualFloatArray(x.Clamp(0, math.Inf(1)).Data(), []float64{0, 0, 0, 0.5, 2}, 0))
+	assert.Nil(t, EqualFloatArray(NewTensor(d1{1e-10}).Log1p().Data(), []float64{1e-10}, 1e-20))
+	assert.Nil(t, EqualFloatArray(NewTensor(d1{1e-10}).Expm1().Data(), []float64{1e-10}, 1e-20))
+	assert.Panics(t, func() { x.Clamp(1, -1) })
+}
+
+func TestUnaryMathGrad(t *testing.T) {
+	specs := []struct {
+		name string
+		fn   func(t Tensor) Tensor
+	}{
+		{"sqrt", Tensor.Sqrt},
+		{"rsqrt", Tensor.Rsqrt},
+		{"abs", Tensor.Abs},
+		{"sign", Tensor.Sign},
+		{"sin", Tensor.Sin},
+		{"cos", Tensor.Cos},
+		{"tan", Tensor.Tan},
+		{"log1p", Tensor.Log1p},
+		{"expm1", Tensor.Expm1},
+		{"clamp", func(t Tensor) Tensor { return t.Clamp(0.5, 1.5) }},
+	}
+
+	for _, spec := range specs {
+		t.Run(spec.name, func(t *testing.T) {
+			// positive for sqrt and log, away from the kinks of clamp and the poles of tan
+			x := NewTensor(d2{{0.2, 0.7, 1.1}, {1.3, 0.4, 1.9}}).SetRequiresGrad(true)
+			fn := func(...Tensor) Tensor { return spec.fn(x.T()).Mul(NewTensor(d1{1, -2})) }
+			assert.Nil(t, GradCheck(fn, []Tensor{x}, GradCheckOptions{Atol: 1e-5, Rtol: 1e-9}))
+		})
+	}
+}
+
+func TestMaximumMinimum(t *testing.T) {
+	a := NewTensor(d2{{1, 5}, {3, 2}}).SetRequiresGrad(true)
+	b := NewTensor(d1{2, 2}).SetRequiresGrad(true)
+
+	max := a.Maximum(b)
+	assert.True(t, NewTensor(d2{{2, 5}, {3, 2}}).Equal(max))
+	max.Backward()
+	// the tie at [1][1] is split
+	assert.Nil(t, EqualFloatArray(a.Grad(), []float64{0, 1, 1, 0.5}, 0))
+	assert.Nil(t, EqualFloatArray(b.Grad(), []float64{1, 0.5}, 0))
+
+	a.ZeroGrad()
+	b.ZeroGrad()
+	min := a.Minimum(b)
+	assert.True(t, NewTensor(d2{{1, 2}, {2, 2}}).Equal(min))
+	min.Backward()
+	assert.Nil(t, EqualFloatArray(a.Grad(), []float64{1, 0, 0, 0.5}, 0))
+	assert.Nil(t, EqualFloatArray(b.Grad(), []float64{1, 1.5}, 0))
+
+	// numerically, without ties
+	x := NewTensor(d2{{0.3, -1.2, 2.5}, {1.7, 0.1, -0.4}}).SetRequiresGrad(true)
+	y := NewTensor(d1{0.5, -0.5, 1}).SetRequiresGrad(true)
+	fn := func(...Tensor) Tensor { return x.Maximum(y).Mul(x.Minimum(y).AddS(2)) }
+	assert.Nil(t, GradCheck(fn, []Tensor{x, y}, GradCheckOptions{Atol: 1e-5, Rtol: 1e-9}))
+}
+
+func TestWhere(t *testing.T) {
+	cond := NewTensor(d2{{1}, {0}})                   // (2, 1)
+	a := NewTensor(d1{1, 2, 3}).SetRequiresGrad(true) // (3)
+	b := NewTensor(d2{{-1, -2, -3}, {-4, -5, -6}}).SetRequiresGrad(true)
+
+	ret := Where(cond, a, b)
+	assert.True(t, NewTensor(d2{{1, 2, 3}, {-4, -5, -6}}).Equal(ret))
+
+	ret.Mul(NewTensor(d1{1, 2, 3})).Backward()
+	assert.Nil(t, EqualFloatArray(a.Grad(), []float64{1, 2, 3}, 0))
+	assert.Nil(t, EqualFloatArray(b.Grad(), []float64{0, 0, 0, 1, 2, 3}, 0))
+
+	// a masked fill
+	filled := Where(NewTensor(d1{0, 1, 0}), All(math.Inf(-1), []int{1}), a)
+	assert.Equal(t, []float64{1, math.Inf(-1), 3}, filled.Data())
+
+	assert.Panics(t, func() { Where(Ones(2), a, b) })
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"dexianta/tgnn/util"
+	"fmt"
+	"math"
+)
+
+// Normalize standardizes x over the trailing dims from start: every x[i_0, ..., i_start-1] is shifted by its mean and
+// divided by sqrt(variance + eps), the variance is biased (divided by n). it returns the mean and the variance of every
+// slice as well, as tensors of the shape x.Shape[:start] without gradient, e.g. for the running stats of batch norm
+// the normalization layers are built on it, reshaping the input so that the normalized elements are trailing, e.g.
+// layer norm of the last dim of (N, L, E) is Normalize(x, 2, eps)
+//
+// the backward is fused rather than recorded as mean, sub, var, div ops: with y = (x - mean) / std and n elements
+//
+//	dx = (g - mean(g) - y * mean(g * y)) / std
+func Normalize(x Tensor, start int, eps float64) (ret, mean, variance Tensor) {
+	if start < 0 {
+		start += x.Dim()
+	}
+	if start < 0 || start >= x.Dim() {
+		panic(fmt.Sprintf("normalize: start dim %d is out of range for shape %v", start, x.Shape))
+	}
+	x = x.contiguous()
+	outer, n := mul(x.Shape[:start]), mul(x.Shape[start:])
+
+	data := make([]float64, len(x.data))
+	means, vars := make([]float64, outer), make([]float64, outer)
+	rstds := make([]float64, outer) // 1 / std
+	for o := 0; o < outer; o++ {
+		xs, ys := x.data[o*n:(o+1)*n], data[o*n:(o+1)*n]
+		m := util.Sum(xs) / float64(n)
+		var v float64
+		for _, xi := range xs {
+			v += (xi - m) * (xi - m)
+		}
+		v /= float64(n)
+		rstd := 1 / math.Sqrt(v+eps)
+		for i, xi := range xs {
+			ys[i] = (xi - m) * rstd
+		}
+		means[o], vars[o], rstds[o] = m, v, rstd
+	}
+
+	ret = fromData(data, x.Shape)
+	record(&ret, "normalize", func(grad []float64) {
+		if !x.requiresGrad {
+			return
+		}
+		xg := x.gradBuf()
+		for o := 0; o < outer; o++ {
+			gs, ys := grad[o*n:(o+1)*n], data[o*n:(o+1)*n]
+			var mg, mgy float64
+			for i := range gs {
+				mg += gs[i]
+				mgy += gs[i] * ys[i]
+			}
+			mg, mgy = mg/float64(n), mgy/float64(n)
+			for i := range gs {
+				xg[o*n+i] += (gs[i] - mg - ys[i]*mgy) * rstds[o]
+			}
+		}
+	}, x)
+
+	stats := append(Shape{}, x.Shape[:start]...)
+	return ret, fromData(means, stats), fromData(vars, stats)
+}
@@ -0,0 +1,51 @@
+package core
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	x := NewTensor(d2{{1, 2, 3}, {2, 2, 2}})
+	ret, mean, variance := Normalize(x, 1, 0)
+	s := math.Sqrt(1.5)
+	assert.Nil(t, EqualFloatArray(ret.Data(), []float64{-s, 0, s, 0, 0, 0}, 1e-12))
+	assert.True(t, NewTensor(d1{2, 2}).Equal(mean))
+	assert.Nil(t, EqualFloatArray(variance.Data(), []float64{2. / 3, 0}, 1e-12))
+
+	// eps keeps the constant rows finite
+	ret, _, _ = Normalize(x, -1, 1e-5)
+	assert.False(t, math.IsNaN(ret.Data()[3]))
+
+	specs := []struct {
+		name  string
+		shape Shape
+		start int
+	}{
+		{"rows", Shape{3, 5}, 1},
+		{"trailing dims", Shape{2, 3, 4}, 1},
+		{"whole", Shape{4, 3}, 0},
+	}
+	for _, spec := range specs {
+		t.Run(spec.name, func(t *testing.T) {
+			x := Randn(spec.shape...).SetRequiresGrad(true)
+			// a random weighting, so that the gradient isn't trivially 0
+			w := Randn(spec.shape...)
+			fn := func(...Tensor) Tensor {
+				ret, _, _ := Normalize(x, spec.start, 1e-5)
+				return ret.Mul(w).Pow(2)
+			}
+			assert.Nil(t, GradCheck(fn, []Tensor{x}, GradCheckOptions{Atol: 1e-4, Rtol: 1e-9}))
+		})
+	}
+
+	// views are fine
+	v := Randn(3, 4).SetRequiresGrad(true)
+	ret, _, _ = Normalize(v.T(), 1, 1e-5)
+	expected, _, _ := Normalize(v.T().Contiguous(), 1, 1e-5)
+	assert.True(t, expected.Equal(ret))
+
+	assert.Panics(t, func() { Normalize(x, 2, 0) })
+}
@@ -23,7 +23,7 @@ func (m *MomentumOptim) Step() {
 	}
 }
 
-func (m MomentumOptim) ZeroGrad() {
+func (m *MomentumOptim) ZeroGrad() {
 	for _, v := range m.vs {
 		v.Grad = 0
 	}
@@ -0,0 +1,218 @@
+package core
+
+import (
+	"dexianta/tgnn/util"
+	"math"
+)
+
+// reducedShape is the shape of t reduced along dim, the dim is kept with size 1 if keepdim
+func reducedShape(shape Shape, dim int, keepdim bool) Shape {
+	ret := append(Shape{}, shape[:dim]...)
+	if keepdim {
+		ret = append(ret, 1)
+	}
+	return append(ret, shape[dim+1:]...)
+}
+
+// reduceOp reduces every slice of t along dim into a single value with fn
+// df fills dxs with the local derivatives of the slice xs, from xs and the reduced value y
+func reduceOp(t Tensor, dim int, keepdim bool, op Op,
+	fn func(xs []float64) float64, df func(xs []float64, y float64, dxs []float64)) Tensor {
+	dim = normDim(dim, t.Dim())
+	t = t.contiguous()
+
+	// slice (o, in) is made of the elements o*n*inner + k*inner + in, for k in [0, n)
+	outer, n, inner := splitDim(t.Shape, dim)
+	xs := make([]float64, n)
+	gather := func(o, in int) {
+		for k := range xs {
+			xs[k] = t.data[(o*n+k)*inner+in]
+		}
+	}
+
+	data := make([]float64, outer*inner)
+	for o := 0; o < outer; o++ {
+		for in := 0; in < inner; in++ {
+			gather(o, in)
+			data[o*inner+in] = fn(xs)
+		}
+	}
+
+	ret := fromData(data, reducedShape(t.Shape, dim, keepdim))
+	if df == nil {
+		return ret
+	}
+	record(&ret, op, func(grad []float64) {
+		if !t.requiresGrad {
+			return
+		}
+		tg := t.gradBuf()
+		dxs := make([]float64, n)
+		for o := 0; o < outer; o++ {
+			for in := 0; in < inner; in++ {
+				gather(o, in)
+				df(xs, data[o*inner+in], dxs)
+				g := grad[o*inner+in]
+				for k := range dxs {
+					tg[(o*n+k)*inner+in] += dxs[k] * g
+				}
+			}
+		}
+	}, t)
+	return ret
+}
+
+// Sum adds up the elements along dim, the dim is removed from the result unless keepdim
+func (t Tensor) Sum(dim int, keepdim bool) Tensor {
+	return reduceOp(t, dim, keepdim, "sum",
+		func(xs []float64) float64 {
+			return util.Sum(xs)
+		},
+		func(xs []float64, y float64, dxs []float64) {
+			for i := range dxs {
+				dxs[i] = 1
+			}
+		})
+}
+
+func (t Tensor) Mean(dim int, keepdim bool) Tensor {
+	return reduceOp(t, dim, keepdim, "mean",
+		func(xs []float64) float64 {
+			return util.Sum(xs) / float64(len(xs))
+		},
+		func(xs []float64, y float64, dxs []float64) {
+			for i := range dxs {
+				dxs[i] = 1 / float64(len(xs))
+			}
+		})
+}
+
+// SumAll adds up all the elements into a scalar
+func (t Tensor) SumAll() Tensor {
+	return t.Reshape(-1).Sum(0, false)
+}
+
+// MeanAll is the mean of all the elements, as a scalar
+func (t Tensor) MeanAll() Tensor {
+	return t.Reshape(-1).Mean(0, false)
+}
+
+// argBest returns the index of the best element of xs (the first one in case of ties), NaN beats everything
+func argBest(xs []float64, better func(a, b float64) bool) int {
+	best := 0
+	for i := range xs {
+		if better(xs[i], xs[best]) || (math.IsNaN(xs[i]) && !math.IsNaN(xs[best])) {
+			best = i
+		}
+	}
+	return best
+}
+
+func greater(a, b float64) bool { return a > b }
+func less(a, b float64) bool    { return a < b }
+
+// selectOp reduces a slice into its best element, which is the only one receiving the gradient
+func selectOp(t Tensor, dim int, keepdim bool, op Op, better func(a, b float64) bool) Tensor {
+	return reduceOp(t, dim, keepdim, op,
+		func(xs []float64) float64 {
+			return xs[argBest(xs, better)]
+		},
+		func(xs []float64, y float64, dxs []float64) {
+			for i := range dxs {
+				dxs[i] = 0
+			}
+			dxs[argBest(xs, better)] = 1
+		})
+}
+
+// Max is the largest element along dim, in case of ties the gradient goes to the first one
+func (t Tensor) Max(dim int, keepdim bool) Tensor {
+	return selectOp(t, dim, keepdim, "max", greater)
+}
+
+// Min is the smallest element along dim, in case of ties the gradient goes to the first one
+func (t Tensor) Min(dim int, keepdim bool) Tensor {
+	return selectOp(t, dim, keepdim, "min", less)
+}
+
+// ArgMax is the index of the largest element along dim, it is not differentiable
+// e.g. the predicted classes of a batch of logits: logits.ArgMax(1, false)
+func (t Tensor) ArgMax(dim int, keepdim bool) Tensor {
+	return reduceOp(t, dim, keepdim, "argmax", func(xs []float64) float64 {
+		return float64(argBest(xs, greater))
+	}, nil)
+}
+
+// ArgMin is the index of the smallest element along dim, it is not differentiable
+func (t Tensor) ArgMin(dim int, keepdim bool) Tensor {
+	return reduceOp(t, dim, keepdim, "argmin", func(xs []float64) float64 {
+		return float64(argBest(xs, less))
+	}, nil)
+}
+
+// variance of xs, divided by n - 1 if unbiased (Bessel's correction), otherwise by n
+func variance(xs []float64, unbiased bool) (v, mean, denum float64) {
+	mean = util.Sum(xs) / float64(len(xs))
+	denum = float64(len(xs))
+	if unbiased {
+		denum--
+	}
+	for _, x := range xs {
+		v += (x - mean) * (x - mean)
+	}
+	return v / denum, mean, denum
+}
+
+// Var is the variance along dim, see variance for unbiased
+func (t Tensor) Var(dim int, unbiased, keepdim bool) Tensor {
+	return reduceOp(t, dim, keepdim, "var",
+		func(xs []float64) float64 {
+			v, _, _ := variance(xs, unbiased)
+			return v
+		},
+		func(xs []float64, y float64, dxs []float64) {
+			// d(sum((x - mean)^2) / denum)/dx_i = 2(x_i - mean) / denum, as sum(x - mean) = 0
+			_, mean, denum := variance(xs, unbiased)
+			for i := range dxs {
+				dxs[i] = 2 * (xs[i] - mean) / denum
+			}
+		})
+}
+
+// Std is the standard deviation along dim, see variance for unbiased
+func (t Tensor) Std(dim int, unbiased, keepdim bool) Tensor {
+	return reduceOp(t, dim, keepdim, "std",
+		func(xs []float64) float64 {
+			v, _, _ := variance(xs, unbiased)
+			return math.Sqrt(v)
+		},
+		func(xs []float64, y float64, dxs []float64) {
+			// d(sqrt(var))/dx = dvar/dx / (2 * std)
+			_, mean, denum := variance(xs, unbiased)
+			for i := range dxs {
+				dxs[i] = (xs[i] - mean) / (denum * y)
+			}
+		})
+}
+
+// Prod multiplies the elements along dim
+func (t Tensor) Prod(dim int, keepdim bool) Tensor {
+	return reduceOp(t, dim, keepdim, "prod",
+		func(xs []float64) float64 {
+			return mul(xs)
+		},
+		func(xs []float64, y float64, dxs []float64) {
+			// the derivative for x_i is the product of all the others, computed with prefix and suffix products
+			// rather than y / x_i, which doesn't work with zeros
+			prefix := 1.
+			for i := range xs {
+				dxs[i] = prefix
+				prefix *= xs[i]
+			}
+			suffix := 1.
+			for i := len(xs) - 1; i >= 0; i-- {
+				dxs[i] *= suffix
+				suffix *= xs[i]
+			}
+		})
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReduce(t *testing.T) {
+	a := NewTensor(d2{{1, 5, 3}, {4, 2, 6}})
+
+	specs := []struct {
+		name     string
+		actual   Tensor
+		expected Tensor
+	}{
+		{"sum 0", a.Sum(0, false), NewTensor(d1{5, 7, 9})},
+		{"sum 1", a.Sum(1, false), NewTensor(d1{9, 12})},
+		{"sum keepdim", a.Sum(-1, true), NewTensor(d2{{9}, {12}})},
+		{"mean", a.Mean(0, true), NewTensor(d2{{2.5, 3.5, 4.5}})},
+		{"max", a.Max(1, false), NewTensor(d1{5, 6})},
+		{"min", a.Min(0, false), NewTensor(d1{1, 2, 3})},
+		{"argmax", a.ArgMax(1, false), NewTensor(d1{1, 2})},
+		{"argmin", a.ArgMin(0, true), NewTensor(d2{{0, 1, 0}})},
+		{"var", a.Var(1, true, false), NewTensor(d1{4, 4})},
+		{"var biased", a.Var(0, false, false), NewTensor(d1{2.25, 2.25, 2.25})},
+		{"std", a.Std(1, true, false), NewTensor(d1{2, 2})},
+		{"prod", a.Prod(0, false), NewTensor(d1{4, 10, 18})},
+	}
+
+	for _, spec := range specs {
+		assert.True(t, spec.expected.Equal(spec.actual), spec.name)
+	}
+
+	assert.Equal(t, Shape{}, a.SumAll().Shape)
+	assert.Equal(t, 21., a.SumAll().Data()[0])
+	assert.Equal(t, 3.5, a.MeanAll().Data()[0])
+
+	b := NewTensor(d3{{{1, 2}, {3, 4}}, {{5, 6}, {7, 8}}})
+	assert.True(t, b.Sum(1, false).Equal(NewTensor(d2{{4, 6}, {12, 14}})))
+	assert.True(t, b.Max(0, false).Equal(NewTensor(d2{{5, 6}, {7, 8}})))
+	assert.True(t, b.T().Sum(0, false).Equal(NewTensor(d2{{3, 11}, {7, 15}})))
+	assert.True(t, NewTensor(d1{1, math.NaN(), 3}).ArgMax(0, false).Equal(NewTensor(d1{1}).Sum(0, false)))
+	assert.Panics(t, func() { a.Sum(2, false) })
+}
+
+func TestReduceBackward(t *testing.T) {
+	a := Randn(3, 4, 2).SetRequiresGrad(true)
+	specs := map[string]func(...Tensor) Tensor{
+		"sum":         func(...Tensor) Tensor { return a.Sum(1, false).Pow(2) },
+		"mean":        func(...Tensor) Tensor { return a.Mean(-1, true).Mul(a).Pow(2) },
+		"max":         func(...Tensor) Tensor { return a.Max(1, false).Pow(2) },
+		"min":         func(...Tensor) Tensor { return a.Min(0, true).Exp() },
+		"var":         func(...Tensor) Tensor { return a.Var(1, true, false).Pow(2) },
+		"var biased":  func(...Tensor) Tensor { return a.Var(0, false, true).Mul(a) },
+		"std":         func(...Tensor) Tensor { return a.Std(2, true, false).Pow(3) },
+		"prod":        func(...Tensor) Tensor { return a.Prod(1, false).Pow(2) },
+		"mean all":    func(...Tensor) Tensor { return a.Pow(2).MeanAll() },
+		"transposed":  func(...Tensor) Tensor { return a.Transpose(0, 2).Sum(0, true).Pow(2) },
+		"sum of view": func(...Tensor) Tensor { return a.Index(2, 1).Max(0, false).Pow(2) },
+	}
+
+	for name, fn := range specs {
+		t.Run(name, func(t *testing.T) {
+			assert.Nil(t, GradCheck(fn, []Tensor{a}, GradCheckOptions{Atol: 1e-5, Rtol: 1e-9}))
+		})
+	}
+
+	t.Run("max ties and prod zeros", func(t *testing.T) {
+		b := NewTensor(d1{3, 1, 3}).SetRequiresGrad(true)
+		b.Max(0, false).Backward()
+		assert.Equal(t, []float64{1, 0, 0}, b.Grad())
+
+		c := NewTensor(d1{2, 0, 3}).SetRequiresGrad(true)
+		c.Prod(0, false).Backward()
+		assert.Equal(t, []float64{0, 6, 0}, c.Grad())
+	})
+}
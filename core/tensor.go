@@ -82,218 +82,371 @@ func (s Shape) Iter() ShapeIter {
 	}
 }
 
+// storage holds the flat buffers behind a Tensor, it is shared by all the copies of a Tensor value
+type storage struct {
+	data         []float64
+	grad         []float64 // allocated by the first backward pass reaching it
+	requiresGrad bool
+
+	// the rows (along dim 0) holding the gradient when it has only been accumulated by sparse ops (see
+	// sparseGradBuf) since the last ZeroGrad, dense is set by any other access to the gradient buffer
+	sparseRows map[int]bool
+	dense      bool
+
+	base *storage // the storage a view was made of, marked dense along with the view, nil if not a view
+}
+
 // Tensor is a n-dimensional array
 // implemented with a single dimensional array with indexing tricks
+//
+// unlike V, the values and gradients are stored in contiguous float64 buffers, and each operation over tensors
+// adds a single node into the computation graph, regardless of the number of elements (see tensor_autograd.go)
 type Tensor struct {
-	data  []*V
+	*storage
 	Shape Shape
-}
 
-// get a list of value with corresponding positions
-func (t Tensor) GetVs(pos []Pos) (ret []*V) {
-	for _, p := range pos {
-		ret = append(ret, t.data[toIndex(p, t.Shape)])
-	}
-	return
+	// the layout of a view in storage (see view.go), strides is nil for the row major layout
+	strides []int
+	offset  int
+
+	prev *node // the operation that produces this tensor, nil for leaf tensor
 }
 
-func (t Tensor) GetV(pos Pos) *V {
-	if len(pos) != len(t.Shape) {
-		panic("invalid pos")
+func fromData(data []float64, shape Shape) Tensor {
+	if len(data) != shape.Cap() {
+		panic(fmt.Sprintf("data of length %d doesn't fit in shape %v", len(data), shape))
+	}
+	return Tensor{
+		storage: &storage{data: data},
+		Shape:   shape,
 	}
-
-	return t.data[toIndex(pos, t.Shape)]
 }
 
 func (t Tensor) Dim() int {
 	return len(t.Shape)
 }
 
+// Data returns the elements in row major order
+// for a contiguous tensor, it is the underlying buffer: writing into it changes the tensor in place, which is how
+// parameters get updated. for other views it is a copy.
+func (t Tensor) Data() []float64 {
+	return t.values()
+}
+
+// RequiresGrad tells if the gradient of t is tracked in back propagation
+func (t Tensor) RequiresGrad() bool {
+	return t.requiresGrad
+}
+
+// SetRequiresGrad marks a leaf tensor (e.g. weights) to be tracked by the computation graph
+// tensors created by NewTensor, Zeros, Randn etc. are constants unless being marked
+func (t Tensor) SetRequiresGrad(b bool) Tensor {
+	if t.prev != nil && !b {
+		panic("cannot stop tracking the gradient of a non-leaf tensor, use Detach instead")
+	}
+	t.requiresGrad = b
+	return t
+}
+
+// Detach returns a leaf tensor sharing the same data, but outside the computation graph
+func (t Tensor) Detach() Tensor {
+	ret := t
+	ret.storage = &storage{data: t.data}
+	ret.prev = nil
+	return ret
+}
+
 func NewTensor[T ndb](arr T) (ret Tensor) {
+	// plain slices (e.g. from outside of the package) are parsed as the named n-d arrays
+	switch v := any(arr).(type) {
+	case []float64:
+		return NewTensor(d1(v))
+	case [][]float64:
+		return NewTensor(d2(v))
+	case [][][]float64:
+		return NewTensor(d3(v))
+	case [][][][]float64:
+		return NewTensor(d4(v))
+	}
+
 	shape, err := parseShape(arr, []int{})
 	if err != nil {
 		panic(err)
 	}
 
-	ret.Shape = shape
-	var data = make([]*V, mul(shape))
+	var data = make([]float64, mul(shape))
 	buildNdArrayIntoSingleDim(arr, shape, data)
-	ret.data = data
-	return
+	return fromData(data, shape)
 }
 
 func Zeros(dims ...int) Tensor {
 	shape := Shape(dims)
-	ret := Tensor{
-		data:  make([]*V, shape.Cap()),
-		Shape: shape,
-	}
-	for i := range ret.data {
-		ret.data[i] = Vx(0)
-	}
-	return ret
+	return fromData(make([]float64, shape.Cap()), shape)
 }
 
 func All(val float64, dims []int) Tensor {
 	shape := Shape(dims)
-	t := Tensor{
-		data:  make([]*V, shape.Cap()),
-		Shape: shape,
-	}
+	t := fromData(make([]float64, shape.Cap()), shape)
 
 	for i := range t.data {
-		t.data[i] = Vx(val)
+		t.data[i] = val
 	}
 
 	return t
 }
 
 func Ones(dims ...int) Tensor {
+	return All(1, dims)
+}
+
+func Randn(dims ...int) Tensor {
 	shape := Shape(dims)
-	t := Tensor{
-		data:  make([]*V, shape.Cap()),
-		Shape: shape,
-	}
+	t := fromData(make([]float64, shape.Cap()), shape)
 
 	for i := range t.data {
-		t.data[i] = Vx(1)
+		t.data[i] = rand.NormFloat64()
 	}
 
 	return t
 }
 
-func Randn(dims ...int) Tensor {
+// RandnRNG is Randn with the values drawn from rng, for reproducible tensors
+func RandnRNG(rng *rand.Rand, dims ...int) Tensor {
 	shape := Shape(dims)
-	t := Tensor{
-		data:  make([]*V, shape.Cap()),
-		Shape: shape,
-	}
+	t := fromData(make([]float64, shape.Cap()), shape)
 
 	for i := range t.data {
-		t.data[i] = Vx(rand.NormFloat64())
+		t.data[i] = rng.NormFloat64()
 	}
 
 	return t
 }
 
-func sortRank(a, b Tensor) (higher, lower Tensor) {
-	if len(a.Shape) > len(b.Shape) {
-		return a, b
-	}
-	return b, a
-}
-
-// only support a simpler version of broadcast
+// canBroadcast tells if a and b can be broadcast together, see broadcastShape
 func canBroadcast(a, b Tensor) bool {
-	highRank, lowRank := sortRank(a, b)
-	if reflect.DeepEqual(lowRank.Shape, Shape{1}) {
-		return true
-	}
+	_, err := broadcastShape(a.Shape, b.Shape)
+	return err == nil
+}
 
-	diff := len(highRank.Shape) - len(lowRank.Shape)
-	for i := len(lowRank.Shape) - 1; i >= 0; i-- {
-		if lowRank.Shape[i] != highRank.Shape[i+diff] {
-			return false
-		}
+func basicOp(a, b float64, op Op) float64 {
+	switch op {
+	case Mul:
+		return a * b
+	case Add:
+		return a + b
+	case Div:
+		return a / b
+	case Sub:
+		return a - b
+	case "maximum":
+		return math.Max(a, b)
+	case "minimum":
+		return math.Min(a, b)
+	default:
+		panic("invalid op")
 	}
-	return true
 }
 
-func basicOp(a, b *V, op string) *V {
+// basicGrad returns the local derivatives of (a op b) with respect to a and b
+func basicGrad(a, b float64, op Op) (da, db float64) {
 	switch op {
-	case "*":
-		return a.Mul(b)
-	case "+":
-		return a.Add(b)
-	case "/":
-		return a.Div(b)
-	case "-":
-		return a.Sub(b)
+	case Mul:
+		return b, a
+	case Add:
+		return 1, 1
+	case Div:
+		return 1 / b, -a / (b * b)
+	case Sub:
+		return 1, -1
+	case "maximum", "minimum":
+		// the selected one takes the gradient, split evenly in case of a tie
+		switch {
+		case a == b:
+			return 0.5, 0.5
+		case (a > b) == (op == "maximum"):
+			return 1, 0
+		default:
+			return 0, 1
+		}
 	default:
 		panic("invalid op")
 	}
 }
 
-func broadcastOp(x, y Tensor, op string) (ret Tensor) {
-	if x.Shape.Equal(y.Shape) {
-		ret.Shape = x.Shape
-		ret.data = make([]*V, len(x.data))
-		for i := range ret.data {
-			ret.data[i] = basicOp(x.data[i], y.data[i], op)
-		}
-		return
+func broadcastOp(x, y Tensor, op Op) (ret Tensor) {
+	shape, err := broadcastShape(x.Shape, y.Shape)
+	if err != nil {
+		panic(err)
 	}
+	x, y = x.contiguous(), y.contiguous()
 
-	if canBroadcast(x, y) {
-		h, _ := sortRank(x, y)
-		ret.Shape = h.Shape // set the shape
-		ret.data = make([]*V, len(h.data))
-		for i := range ret.data {
-			ret.data[i] = basicOp(x.data[i], y.data[i%len(y.data)], op)
-		}
-	} else {
-		panic("cannot add")
+	// xi[i] and yi[i] are the elements of x and y used for the i-th output
+	xi, yi := broadcastIndex(x.Shape, shape), broadcastIndex(y.Shape, shape)
+	data := make([]float64, shape.Cap())
+	for i := range data {
+		data[i] = basicOp(x.data[xi[i]], y.data[yi[i]], op)
 	}
 
+	ret = fromData(data, shape)
+	record(&ret, op, func(grad []float64) {
+		// a broadcast element receives the gradients from all of its copies,
+		// which reduces the gradient back to the original shape
+		for i := range grad {
+			dx, dy := basicGrad(x.data[xi[i]], y.data[yi[i]], op)
+			accumulate(x, xi[i], dx*grad[i])
+			accumulate(y, yi[i], dy*grad[i])
+		}
+	}, x, y)
 	return
 }
 
 func (t Tensor) Add(a Tensor) (ret Tensor) {
-	return broadcastOp(t, a, "+")
+	return broadcastOp(t, a, Add)
 }
 
 func (t Tensor) Sub(a Tensor) (ret Tensor) {
-	return broadcastOp(t, a, "-")
+	return broadcastOp(t, a, Sub)
 }
 
 func (t Tensor) Mul(a Tensor) (ret Tensor) {
-	return broadcastOp(t, a, "*")
+	return broadcastOp(t, a, Mul)
 }
 
 func (t Tensor) Div(a Tensor) (ret Tensor) {
-	return broadcastOp(t, a, "/")
+	return broadcastOp(t, a, Div)
+}
+
+// unaryOp applies fn over every element
+// df gives the local derivative from the input x and the output y
+func unaryOp(t Tensor, op Op, fn func(x float64) float64, df func(x, y float64) float64) Tensor {
+	t = t.contiguous()
+	data := make([]float64, len(t.data))
+	for i := range data {
+		data[i] = fn(t.data[i])
+	}
+
+	ret := fromData(data, t.Shape)
+	record(&ret, op, func(grad []float64) {
+		if !t.requiresGrad {
+			return
+		}
+		tg := t.gradBuf()
+		for i := range grad {
+			tg[i] += df(t.data[i], ret.data[i]) * grad[i]
+		}
+	}, t)
+	return ret
 }
 
 // S means scalar
 func (t Tensor) AddS(v float64) Tensor {
-	for i := range t.data {
-		t.data[i].Data = t.data[i].Data + v
-	}
-	return t
+	return unaryOp(t, Add,
+		func(x float64) float64 { return x + v },
+		func(x, y float64) float64 { return 1 })
 }
 
 func (t Tensor) MulS(v float64) Tensor {
-	for i := range t.data {
-		t.data[i].Data = t.data[i].Data * v
-	}
-	return t
+	return unaryOp(t, Mul,
+		func(x float64) float64 { return x * v },
+		func(x, y float64) float64 { return v })
 }
 
 func (t Tensor) DivS(v float64) Tensor {
 	return t.MulS(1. / v)
 }
 
+func (t Tensor) Neg() Tensor {
+	return t.MulS(-1)
+}
+
+// base with nature e
+func (t Tensor) Exp() Tensor {
+	return unaryOp(t, Exp, math.Exp, func(x, y float64) float64 { return y })
+}
+
+func (t Tensor) Log() Tensor {
+	return unaryOp(t, "log", math.Log, func(x, y float64) float64 { return 1 / x })
+}
+
+func (t Tensor) Pow(p float64) Tensor {
+	return unaryOp(t, Pow,
+		func(x float64) float64 { return math.Pow(x, p) },
+		func(x, y float64) float64 { return p * math.Pow(x, p-1) })
+}
+
+func (t Tensor) ReLu() Tensor {
+	return unaryOp(t, ReLu,
+		func(x float64) float64 { return math.Max(x, 0) },
+		func(x, y float64) float64 {
+			if x > 0 {
+				return 1
+			}
+			return 0
+		})
+}
+
+// Grad returns a copy of the gradient, all zeros if no gradient has been computed yet
 func (t Tensor) Grad() (ret []float64) {
-	ret = make([]float64, len(t.data))
-	for i := range t.data {
-		ret[i] = t.data[i].Grad
+	ret = make([]float64, t.Shape.Cap())
+	if t.grad == nil {
+		return
 	}
-	return ret
+	if t.IsContiguous() {
+		copy(ret, t.grad)
+		return
+	}
+	for i, idx := range t.storageIndex() {
+		ret[i] = t.grad[idx]
+	}
+	return
 }
 
-func (t *Tensor) Equal(o Tensor) bool {
-	if !reflect.DeepEqual(t.Shape, o.Shape) {
-		return false
+// RawGrad returns the gradient buffer of a contiguous tensor without copying it, nil if no gradient has been computed
+// yet, e.g. for an optimizer reading only the rows of a sparse gradient (see SparseGrad)
+func (t Tensor) RawGrad() []float64 {
+	if !t.IsContiguous() {
+		panic(fmt.Sprintf("raw grad of a non-contiguous tensor (shape: %v, strides: %v), use Grad instead",
+			t.Shape, t.stride()))
+	}
+	return t.grad
+}
+
+// ZeroGrad resets the gradient of t
+func (t Tensor) ZeroGrad() {
+	if t.grad == nil {
+		return
+	}
+	if t.IsContiguous() {
+		if rows, ok := t.SparseGrad(); ok {
+			for _, r := range rows {
+				size := len(t.grad) / t.Shape[0]
+				for i := r * size; i < (r+1)*size; i++ {
+					t.grad[i] = 0
+				}
+			}
+		} else {
+			for i := range t.grad {
+				t.grad[i] = 0
+			}
+		}
+		t.sparseRows, t.dense = nil, false
+		return
+	}
+	for _, idx := range t.storageIndex() {
+		t.grad[idx] = 0
 	}
+}
 
-	if len(t.data) != len(o.data) {
+func (t Tensor) Equal(o Tensor) bool {
+	if !reflect.DeepEqual(t.Shape, o.Shape) {
 		return false
 	}
 
-	for i := range t.data {
-		dff := math.Abs(t.data[i].Data - o.data[i].Data)
+	a, b := t.values(), o.values()
+	for i := range a {
+		dff := math.Abs(a[i] - b[i])
 		if dff > 0.001 {
-			fmt.Printf("inequality: %v, %v, dff: %v\n", t.data[i].Data, o.data[i].Data, dff)
+			fmt.Printf("inequality: %v, %v, dff: %v\n", a[i], b[i], dff)
 			return false
 		}
 	}
@@ -301,57 +454,55 @@ func (t *Tensor) Equal(o Tensor) bool {
 }
 
 func (t *Tensor) Loc(loc []int) float64 {
-	return t.data[toIndex(loc, t.Shape)].Data
-}
-
-func (t *Tensor) At(pos []int) *V {
-	Panic(t.Shape.Valid(pos))
-	return t.data[toIndex(pos, t.Shape)]
+	Panic(t.Shape.Valid(loc))
+	idx := t.offset
+	for i, s := range t.stride() {
+		idx += loc[i] * s
+	}
+	return t.data[idx]
 }
 
 func (t Tensor) String() string {
-	return fmt.Sprintf("\n%s\n", buildString([]int{}, t.Shape, t.data, "data"))
+	return fmt.Sprintf("\n%s\n", buildString([]int{}, t.Shape, t.values()))
 }
 
 func (t Tensor) PrintData() {
-	fmt.Println(buildString([]int{}, t.Shape, t.data, "data"))
+	fmt.Println(buildString([]int{}, t.Shape, t.values()))
 }
 
 func (t Tensor) PrintGrad() {
-	fmt.Println(buildString([]int{}, t.Shape, t.data, "grad"))
+	fmt.Println(buildString([]int{}, t.Shape, t.Grad()))
 }
 
-// matrix multiplication
+// matrix multiplication, following the semantic of torch.matmul (see planMatmul)
 func (t Tensor) Matmul(o Tensor) (ret Tensor) {
-	// dot product
-	if len(t.Shape) == 1 && len(o.Shape) == 1 && t.Shape[0] == o.Shape[0] {
-		var data = make([]*V, t.Shape[0])
-		for i := range t.data {
-			data[i] = t.data[i].Mul(o.data[i])
-		}
-		ret.data = data
-		ret.Shape = t.Shape
-		return
+	// the shape is checked before touching any data
+	p, err := planMatmul(t.Shape, o.Shape)
+	if err != nil {
+		panic(err)
 	}
+	t, o = t.contiguous(), o.contiguous()
+	m, k, n := p.m, p.k, p.n
 
-	// ===========================
-	// normal matrix multiplication
-	// ===========================
-	newShape, _ := newShapeForMatMul(t.Shape, o.Shape)
-	ret.Shape = newShape
-	ret.data = make([]*V, newShape.Cap()) // initialize
-
-	iter := newShape.Iter()
-	for iter.Next() {
-		pos := iter.Step()
-		idx := toIndex(pos, newShape)
-		ps := getMatmulPairs(t.Shape, o.Shape, pos)
-		var v []*V
-		for _, p := range ps {
-			v = append(v, t.At(p.a).Mul(o.At(p.b)))
-		}
-		ret.data[idx] = Sum(v)
+	data := make([]float64, p.shape.Cap())
+	for b := range p.aBatch {
+		gemm(m, k, n, t.data[p.aBatch[b]*m*k:], o.data[p.bBatch[b]*k*n:], data[b*m*n:])
 	}
+
+	ret = fromData(data, p.shape)
+	record(&ret, "matmul", func(grad []float64) {
+		for b := range p.aBatch {
+			tb, ob, gb := t.data[p.aBatch[b]*m*k:], o.data[p.bBatch[b]*k*n:], grad[b*m*n:]
+			if t.requiresGrad {
+				// dt = grad @ o^T
+				gemmNT(m, n, k, gb, ob, t.gradBuf()[p.aBatch[b]*m*k:])
+			}
+			if o.requiresGrad {
+				// do = t^T @ grad, the broadcast matrices accumulate the gradients from all of their copies
+				gemmTN(m, k, n, tb, gb, o.gradBuf()[p.bBatch[b]*k*n:])
+			}
+		}
+	}, t, o)
 	return
 }
 
@@ -367,31 +518,19 @@ func toVerboseSlice(sl [][2]int, shape Shape) (ret [][2]int) {
 	return
 }
 
-func inRange(idx int, verboseRange [][2]int, shape Shape) (bool, []int) {
-	if len(verboseRange) != len(shape) {
-		panic("verbose slice range is not valid")
-	}
-
-	pos := toPos(idx, shape)
-	newPos := make([]int, len(pos))
-	for i := range pos {
-		if pos[i] >= verboseRange[i][1] || pos[i] < verboseRange[i][0] {
-			return false, []int{}
-		}
-		newPos[i] = pos[i] - verboseRange[i][0]
-	}
-
-	return true, newPos
-}
-
+// Slice takes the range [start, end) of the leading dimensions, e.g. t.Slice(S{0, 64}) is a batch of the first 64 rows
+// negative start and end count from the end of the dimension, e.g. t.Slice(S{-2, -1}) is the second last row
+// the result is a view sharing the storage of t, see SliceStep for step sizes
 func (t Tensor) Slice(sl ...[2]int) (ret Tensor) {
 	if len(sl) > len(t.Shape) {
 		panic("invalid slicing")
 	}
 
+	sl = append([][2]int{}, sl...)
 	for i := range sl {
+		sl[i][0], sl[i][1] = normIndex(sl[i][0], t.Shape[i]), normIndex(sl[i][1], t.Shape[i])
 		if sl[i][0] < 0 || sl[i][1] < 0 {
-			panic("negative slice not supported")
+			panic(fmt.Sprintf("out of range index: %v, shape: %v", sl, t.Shape))
 		}
 		if sl[i][0] > sl[i][1] {
 			panic("invalid slicing: start>end")
@@ -401,42 +540,31 @@ func (t Tensor) Slice(sl ...[2]int) (ret Tensor) {
 		}
 	}
 
-	// initialize new Tensor
-	// new shape
-	ret.Shape = make(Shape, len(t.Shape))
-	for i := range t.Shape {
-		if i >= len(sl) {
-			ret.Shape[i] = t.Shape[i]
-		} else {
-			ret.Shape[i] = sl[i][1] - sl[i][0]
-		}
-	}
-	ret.data = make([]*V, ret.Shape.Cap())
-
+	// new shape, the strides stay the same, only the starting point moves
 	verboseSlice := toVerboseSlice(sl, t.Shape)
-	for i := range t.data {
-		if ok, pos := inRange(i, verboseSlice, t.Shape); ok {
-			ret.data[toIndex(pos, ret.Shape)] = t.data[i]
-		}
+	strides := t.stride()
+	shape := make(Shape, len(t.Shape))
+	offset := t.offset
+	for i := range t.Shape {
+		shape[i] = verboseSlice[i][1] - verboseSlice[i][0]
+		offset += verboseSlice[i][0] * strides[i]
 	}
 
-	return
+	return t.view(shape, strides, offset)
 }
 
-func buildString(pos, shape []int, data []*V, field string) string {
+func buildString(pos, shape []int, data []float64) string {
+	if len(shape) == 0 {
+		// scalar
+		return fmt.Sprintf("%.4f", data[0])
+	}
+
 	var tmp []string
 	if len(pos) == len(shape)-1 {
 		pos = append(pos, 0)
 		start := toIndex(pos, shape)
 		for i := 0; i < shape[len(shape)-1]; i++ {
-			switch field {
-			case "data":
-				tmp = append(tmp, fmt.Sprintf("%.4f", data[start+i].Data))
-			case "grad":
-				tmp = append(tmp, fmt.Sprintf("%.4f", data[start+i].Grad))
-			default:
-				panic("invalid field to build string")
-			}
+			tmp = append(tmp, fmt.Sprintf("%.4f", data[start+i]))
 		}
 
 		return fmt.Sprint(tmp)
@@ -444,7 +572,7 @@ func buildString(pos, shape []int, data []*V, field string) string {
 
 	// len(pos) is the depth of recursion
 	for i := 0; i < shape[len(pos)]; i++ {
-		tmp = append(tmp, buildString(append(pos, i), shape, data, field))
+		tmp = append(tmp, buildString(append(pos, i), shape, data))
 	}
 	return fmt.Sprintf("[%s]", strings.Join(tmp, strings.Repeat("\n", len(shape)-len(pos)-1)))
 }
@@ -0,0 +1,191 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+)
+
+// node is an operation in the computation graph of tensors
+// a whole tensor operation is a single node, backward receives the gradient of the output (same layout as the output
+// data) and accumulates the gradients of the operands
+type node struct {
+	op       Op
+	prev     []Tensor // operands
+	backward func()
+	out      *storage // the storage of the result, nil for a view which shares the one of its operand
+}
+
+// record attaches the operation producing ret into the computation graph
+// nothing is recorded when none of the operands requires gradient, so constants (e.g. the data set) don't build graph
+func record(ret *Tensor, op Op, backward func(grad []float64), operands ...Tensor) {
+	var track bool
+	for _, o := range operands {
+		track = track || o.requiresGrad
+	}
+	if !track {
+		return
+	}
+
+	out := *ret
+	out.requiresGrad = true
+	out.prev = &node{
+		op:   op,
+		prev: operands,
+		backward: func() {
+			backward(out.gradBuf())
+		},
+		out: out.storage,
+	}
+	*ret = out
+}
+
+// gradBuf returns the gradient buffer, allocating it if needed
+func (s *storage) gradBuf() []float64 {
+	for b := s; b != nil; b = b.base {
+		b.dense = true
+	}
+	return s.allocGrad()
+}
+
+// sparseGradBuf returns the gradient buffer for an op accumulating only into the rows (along dim 0) rows
+// the gradient stays sparse (see SparseGrad) as long as only such ops reach it
+// the rows of a view are not the ones of its base, so a view is always dense
+func (s *storage) sparseGradBuf(rows []int) []float64 {
+	if s.base != nil {
+		return s.gradBuf()
+	}
+	if s.sparseRows == nil {
+		s.sparseRows = map[int]bool{}
+	}
+	for _, r := range rows {
+		s.sparseRows[r] = true
+	}
+	return s.allocGrad()
+}
+
+func (s *storage) allocGrad() []float64 {
+	if s.grad == nil {
+		s.grad = make([]float64, len(s.data))
+	}
+	return s.grad
+}
+
+// SparseGrad returns the sorted rows (along dim 0) of t which hold the gradient, when it has only been accumulated
+// by sparse ops (e.g. Embedding) since the last ZeroGrad, the other rows are 0. ok is false for a dense gradient
+// it lets an optimizer update only the rows of a large embedding looked up by a batch
+func (t Tensor) SparseGrad() (rows []int, ok bool) {
+	if t.dense || t.Dim() == 0 {
+		return nil, false
+	}
+	for r := range t.sparseRows {
+		rows = append(rows, r)
+	}
+	sort.Ints(rows)
+	return rows, true
+}
+
+// accumulate adds g into the gradient of t at the flat index i
+func accumulate(t Tensor, i int, g float64) {
+	if !t.requiresGrad {
+		return
+	}
+	t.gradBuf()[i] += g
+}
+
+// Backward populates the gradient of every tensor t depends on, treating t as the start of back propagation
+// for a non scalar tensor, it is the same as back propagating from the sum of its elements
+func (t Tensor) Backward() {
+	if !t.requiresGrad {
+		panic("tensor does not require grad")
+	}
+
+	var order []*node
+	if t.prev != nil {
+		order = t.prev.topo()
+	}
+	// the leaves accumulate across calls, the results of the operations are reset so the same graph can be
+	// traversed again, same as V.backward
+	for _, n := range order {
+		if n.out != nil && n.out.grad != nil {
+			for i := range n.out.grad {
+				n.out.grad[i] = 0
+			}
+			n.out.sparseRows, n.out.dense = nil, false
+		}
+	}
+
+	g := t.gradBuf()
+	if t.IsContiguous() {
+		for i := range g {
+			g[i] += 1
+		}
+	} else {
+		for _, i := range t.storageIndex() {
+			g[i] += 1
+		}
+	}
+	for i := len(order) - 1; i >= 0; i-- {
+		order[i].backward()
+	}
+}
+
+// topo returns the nodes reachable from n in topological order (operands first), same as V.topo
+func (n *node) topo() (ret []*node) {
+	type frame struct {
+		n        *node
+		expanded bool
+	}
+
+	visited := map[*node]bool{}
+	stack := []frame{{n: n}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if top.expanded {
+			ret = append(ret, top.n)
+			continue
+		}
+		if visited[top.n] {
+			continue
+		}
+		visited[top.n] = true
+
+		stack = append(stack, frame{n: top.n, expanded: true})
+		for _, p := range top.n.prev {
+			if p.prev != nil && !visited[p.prev] {
+				stack = append(stack, frame{n: p.prev})
+			}
+		}
+	}
+	return
+}
+
+// Function creates the result of an operation implemented outside of core, e.g. a loss function with a fused
+// gradient, as a single node of the computation graph.
+// data is the result in row major order. backward receives the gradient of the result, and returns the gradient of
+// each input in the row major order of its shape, an entry can be nil if the input doesn't need it.
+func Function(op Op, shape Shape, data []float64, backward func(grad []float64) [][]float64, inputs ...Tensor) Tensor {
+	inputs = append([]Tensor{}, inputs...)
+	for i := range inputs {
+		inputs[i] = inputs[i].contiguous()
+	}
+
+	ret := fromData(data, shape)
+	record(&ret, op, func(grad []float64) {
+		grads := backward(grad)
+		if len(grads) != len(inputs) {
+			panic(fmt.Sprintf("%s: %d gradients for %d inputs", op, len(grads), len(inputs)))
+		}
+		for i, in := range inputs {
+			if grads[i] == nil || !in.requiresGrad {
+				continue
+			}
+			g := in.gradBuf()
+			for j := range grads[i] {
+				g[j] += grads[i][j]
+			}
+		}
+	}, inputs...)
+	return ret
+}
@@ -1,7 +1,7 @@
 package core
 
 import (
-	"fmt"
+	"dexianta/tgnn/util"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -16,6 +16,54 @@ func TestBroadCastable(t *testing.T) {
 	assert.True(t, canBroadcast(a, c))
 	assert.True(t, canBroadcast(c, a))
 	assert.False(t, canBroadcast(a, Ones(2, 3)))
+	assert.True(t, canBroadcast(Ones(3, 1), Ones(2, 1, 4)))
+	assert.True(t, canBroadcast(Ones(1, 3, 1), Ones(2, 1, 4)))
+	assert.False(t, canBroadcast(Ones(3, 2), Ones(2, 3)))
+}
+
+func TestBroadcastOp(t *testing.T) {
+	t.Run("swapped operands", func(t *testing.T) {
+		a := NewTensor(d2{{1, 2, 3}, {4, 5, 6}})
+		b := NewTensor(d1{10, 20, 30})
+		expected := NewTensor(d2{{11, 22, 33}, {14, 25, 36}})
+		assert.True(t, expected.Equal(a.Add(b)))
+		assert.True(t, expected.Equal(b.Add(a)))
+		assert.True(t, NewTensor(d2{{9, 18, 27}, {6, 15, 24}}).Equal(b.Sub(a)))
+	})
+
+	t.Run("stretched on both sides", func(t *testing.T) {
+		a := NewTensor(d2{{1}, {2}, {3}}) // (3, 1)
+		b := NewTensor(d2{{10, 20}})      // (1, 2)
+		c := a.Mul(b)
+		assert.Equal(t, Shape{3, 2}, c.Shape)
+		assert.True(t, NewTensor(d2{{10, 20}, {20, 40}, {30, 60}}).Equal(c))
+
+		d := NewTensor(d3{{{1, 2}}, {{3, 4}}}) // (2, 1, 2)
+		e := d.Add(a)                          // (3, 1) -> (2, 3, 2)
+		assert.Equal(t, Shape{2, 3, 2}, e.Shape)
+		assert.True(t, NewTensor(d3{
+			{{2, 3}, {3, 4}, {4, 5}},
+			{{4, 5}, {5, 6}, {6, 7}},
+		}).Equal(e))
+	})
+
+	t.Run("error names both shapes", func(t *testing.T) {
+		assert.PanicsWithError(t, "cannot broadcast shapes: a([3 2]), b([2 3])", func() {
+			Ones(3, 2).Add(Ones(2, 3))
+		})
+	})
+
+	t.Run("backward reduces to the original shapes", func(t *testing.T) {
+		// fixed values, a*b + 3 stays away from 0
+		a := NewTensor(d2{{0.5}, {-0.3}, {1.2}}).SetRequiresGrad(true)
+		b := NewTensor(d3{{{0.1, -0.7, 0.4, 0.9}}, {{-1.1, 0.6, 0.2, -0.5}}}).SetRequiresGrad(true)
+		c := NewTensor(d1{1.5, -0.8, 0.3, 2.2}).SetRequiresGrad(true)
+		fn := func(...Tensor) Tensor {
+			return c.Div(a.Mul(b).AddS(3)).Sub(a)
+		}
+
+		assert.Nil(t, GradCheck(fn, []Tensor{a, b, c}, GradCheckOptions{Atol: 1e-5, Rtol: 1e-9}))
+	})
 }
 
 func TestRand(t *testing.T) {
@@ -36,6 +84,9 @@ func TestTensorInit(t *testing.T) {
 			}
 		}
 	}
+
+	// plain slices work the same
+	assert.True(t, tn.Equal(NewTensor([][][]float64{{{1, 2, 3}, {4, 5, 6}}, {{7, 8, 9}, {10, 11, 12}}})))
 }
 
 func TestShapeIter(t *testing.T) {
@@ -66,17 +117,6 @@ func TestSlice(t *testing.T) {
 	assert.True(t, s3.Equal(expected3))
 }
 
-func TestInRange(t *testing.T) {
-	// {3,3,3} slice {1:2}
-	shape := Shape{3, 3, 3}
-	sl := [][2]int{{0, 2}}
-	verbose := toVerboseSlice(sl, shape)
-	for i := 0; i < 27; i++ {
-		ok, pos := inRange(i, verbose, shape)
-		fmt.Println(toPos(i, shape), ok, pos)
-	}
-}
-
 func TestAdd(t *testing.T) {
 	a := Ones(2, 3, 3)
 	b := Ones(3, 3)
@@ -86,7 +126,7 @@ func TestAdd(t *testing.T) {
 
 	assert.True(t, c.Equal(d))
 	for _, v := range c.data {
-		assert.Equal(t, v.Data, 2.0)
+		assert.Equal(t, v, 2.0)
 	}
 
 	a = NewTensor(d2{{1, 2, 3}, {4, 5, 6}})
@@ -116,3 +156,160 @@ func TestMatMul(t *testing.T) {
 		assert.True(t, c.Equal(Ones(2, 3, 5).MulS(4)))
 	})
 }
+
+func TestMatMulVector(t *testing.T) {
+	m := NewTensor(d2{{1, 2}, {3, 4}, {5, 6}})
+
+	t.Run("dot product", func(t *testing.T) {
+		c := NewTensor(d1{1, 2, 3}).Matmul(NewTensor(d1{4, 5, 6}))
+		assert.Equal(t, Shape{}, c.Shape)
+		assert.Equal(t, 32., c.Data()[0])
+	})
+
+	t.Run("matrix @ vector", func(t *testing.T) {
+		c := m.Matmul(NewTensor(d1{1, 10}))
+		assert.Equal(t, Shape{3}, c.Shape)
+		assert.True(t, NewTensor(d1{21, 43, 65}).Equal(c))
+	})
+
+	t.Run("vector @ matrix", func(t *testing.T) {
+		c := NewTensor(d1{1, 10, 100}).Matmul(m)
+		assert.Equal(t, Shape{2}, c.Shape)
+		assert.True(t, NewTensor(d1{531, 642}).Equal(c))
+	})
+
+	t.Run("broadcast batch", func(t *testing.T) {
+		a := Ones(3, 1, 2, 4)
+		b := Ones(5, 4, 6)
+		c := a.Matmul(b)
+		assert.Equal(t, Shape{3, 5, 2, 6}, c.Shape)
+		assert.True(t, c.Equal(All(4, []int{3, 5, 2, 6})))
+
+		// batch of matrices @ vector
+		d := Ones(2, 3, 4).Matmul(Ones(4))
+		assert.Equal(t, Shape{2, 3}, d.Shape)
+	})
+
+	t.Run("invalid shape", func(t *testing.T) {
+		a := Ones(2, 3).SetRequiresGrad(true)
+		assert.PanicsWithError(t, "invalid shape: a([2 3]), b([2])", func() {
+			a.Matmul(Ones(2))
+		})
+		assert.Panics(t, func() {
+			Ones(2, 2, 3).Matmul(Ones(3, 3, 2))
+		})
+	})
+}
+
+func TestMatMulBackward(t *testing.T) {
+	specs := []struct {
+		name string
+		a, b Shape
+	}{
+		{"dot", Shape{3}, Shape{3}},
+		{"matrix @ vector", Shape{2, 3}, Shape{3}},
+		{"vector @ matrix", Shape{3}, Shape{3, 2}},
+		{"vector @ batch", Shape{3}, Shape{4, 3, 2}},
+		{"broadcast batch", Shape{2, 1, 2, 3}, Shape{3, 3, 4}},
+	}
+
+	for _, spec := range specs {
+		t.Run(spec.name, func(t *testing.T) {
+			a := Randn(spec.a...).SetRequiresGrad(true)
+			b := Randn(spec.b...).SetRequiresGrad(true)
+			fn := func(...Tensor) Tensor {
+				return a.Matmul(b).Pow(2)
+			}
+
+			assert.Nil(t, GradCheck(fn, []Tensor{a, b}, GradCheckOptions{Atol: 1e-5, Rtol: 1e-9}))
+		})
+	}
+}
+
+func TestTensorBackward(t *testing.T) {
+	a := NewTensor(d2{{1, 2, 3}, {4, 5, 6}}).SetRequiresGrad(true)
+	b := NewTensor(d1{2, 3, 4})
+	c := a.Mul(b).Add(a).DivS(2) // (a * b + a) / 2
+
+	c.Backward()
+	assert.Nil(t, EqualFloatArray(a.Grad(), []float64{1.5, 2, 2.5, 1.5, 2, 2.5}, 1e-9))
+	assert.False(t, b.RequiresGrad())
+	assert.Nil(t, b.grad)
+
+	a.ZeroGrad()
+	assert.Nil(t, EqualFloatArray(a.Grad(), make([]float64, 6), 0))
+}
+
+func TestTensorBackwardMatmulLogSoftmax(t *testing.T) {
+	input := Randn(4, 8)
+	weights := Randn(8, 5).SetRequiresGrad(true)
+	onehot := NewTensor(d2{
+		{0, 1, 0, 0, 0},
+		{0, 0, 0, 1, 0},
+		{1, 0, 0, 0, 0},
+		{0, 0, 0, 0, 1},
+	})
+
+	// nll loss: -mean(out[i][target[i]])
+	loss := func(...Tensor) Tensor {
+		out := LogSoftmax(input.Matmul(weights), 1)
+		return Ones(1, 4).Matmul(out.Mul(onehot).Matmul(Ones(5, 1))).DivS(-4)
+	}
+
+	assert.Nil(t, GradCheck(loss, []Tensor{weights}, GradCheckOptions{Atol: 1e-6, Rtol: 1e-9}))
+}
+
+func TestTensorBackwardBatchMatmul(t *testing.T) {
+	a := Randn(2, 3, 4).SetRequiresGrad(true)
+	b := Randn(4, 5).SetRequiresGrad(true)
+	fn := func(...Tensor) Tensor {
+		return a.Matmul(b).Pow(2)
+	}
+
+	assert.Nil(t, GradCheck(fn, []Tensor{a, b}, GradCheckOptions{Atol: 1e-5, Rtol: 1e-9}))
+}
+
+func TestTensorBackwardSharedGraph(t *testing.T) {
+	x := NewTensor(d1{1, 2}).SetRequiresGrad(true)
+	y := x
+	for i := 0; i < 64; i++ {
+		y = y.Add(x)
+	}
+	y.Backward()
+	assert.Nil(t, EqualFloatArray(x.Grad(), []float64{65, 65}, 0))
+}
+
+func TestTensorBackwardTwice(t *testing.T) {
+	x := NewTensor(d1{1, 2}).SetRequiresGrad(true)
+	y := x.MulS(2)
+	z := y.MulS(3)
+	z.Backward()
+	assert.Equal(t, []float64{6, 6}, x.Grad())
+
+	// the leaves accumulate, the intermediate results don't propagate their stale gradient again
+	z.Backward()
+	assert.Equal(t, []float64{12, 12}, x.Grad())
+	assert.Equal(t, []float64{3, 3}, y.Grad())
+
+	// through a view, the gradient of the leaf isn't reset either
+	x.ZeroGrad()
+	w := x.View(2, 1).MulS(2)
+	w.Backward()
+	w.Backward()
+	assert.Equal(t, []float64{4, 4}, x.Grad())
+}
+
+func TestFunction(t *testing.T) {
+	a := NewTensor(d2{{1, 2}, {3, 4}}).SetRequiresGrad(true)
+	b := NewTensor(d1{5, 6})
+
+	// a custom dot product of the first column and b
+	col := a.T().Index(0, 0)
+	c := Function("dot", Shape{}, []float64{util.Sum([]float64{1 * 5, 3 * 6})}, func(grad []float64) [][]float64 {
+		return [][]float64{{5 * grad[0], 6 * grad[0]}, nil}
+	}, col, b)
+	assert.Equal(t, 23., c.Data()[0])
+
+	c.MulS(2).Backward()
+	assert.Equal(t, []float64{10, 0, 12, 0}, a.Grad())
+}
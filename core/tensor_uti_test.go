@@ -95,6 +95,30 @@ func TestMatmulShape(t *testing.T) {
 			Shape{10, 3, 1},
 			4,
 		},
+		{
+			Shape{10, 1, 3, 4},
+			Shape{5, 4, 2},
+			Shape{10, 5, 3, 2},
+			4,
+		},
+		{
+			Shape{3, 4},
+			Shape{4},
+			Shape{3},
+			4,
+		},
+		{
+			Shape{4},
+			Shape{2, 4, 5},
+			Shape{2, 5},
+			4,
+		},
+		{
+			Shape{4},
+			Shape{4},
+			Shape{},
+			4,
+		},
 		{
 			Shape{10, 3, 4},
 			Shape{10, 4, 5},
@@ -104,7 +128,8 @@ func TestMatmulShape(t *testing.T) {
 	}
 
 	for _, spec := range specs {
-		actual, k := newShapeForMatMul(spec.a, spec.b)
+		actual, k, err := newShapeForMatMul(spec.a, spec.b)
+		assert.Nil(t, err)
 		assert.Equal(t, spec.expected, actual)
 		assert.Equal(t, k, spec.k)
 	}
@@ -133,12 +158,32 @@ func TestValidMatmulShape(t *testing.T) {
 		},
 		{
 			Shape{10, 3, 4},
-			Shape{1, 3, 5}, // should be able to broadcast in pytorch, but not supported now
+			Shape{1, 3, 5},
 			false,
 		},
 		{
 			Shape{10, 3, 4},
-			Shape{2, 4, 5}, // should be able to broadcast in pytorch, but not supported now
+			Shape{1, 4, 5}, // batch dimension is broadcast
+			true,
+		},
+		{
+			Shape{10, 3, 4},
+			Shape{2, 4, 5},
+			false,
+		},
+		{
+			Shape{3, 4},
+			Shape{3},
+			false,
+		},
+		{
+			Shape{3},
+			Shape{4},
+			false,
+		},
+		{
+			Shape{},
+			Shape{3},
 			false,
 		},
 	}
@@ -153,21 +198,14 @@ func TestValidMatmulShape(t *testing.T) {
 	}
 }
 
-func TestGetKpair(t *testing.T) {
+func TestGetK(t *testing.T) {
 	t.Run("", func(t *testing.T) {
 		a := Shape{2, 3, 4, 5}
 		b := Shape{3, 5, 3}
 
-		c, k := newShapeForMatMul(a, b)
+		c, k, _ := newShapeForMatMul(a, b)
 		assert.Equal(t, c, Shape{2, 3, 4, 3})
 		assert.Equal(t, k, 5)
-
-		iter := c.Iter()
-		for iter.Next() {
-			pos := iter.Step()
-			pairs := getMatmulPairs(a, b, pos)
-			assert.Len(t, pairs, 5)
-		}
 	})
 
 	t.Run("", func(t *testing.T) {
@@ -178,44 +216,41 @@ func TestGetKpair(t *testing.T) {
 		//  x,x,x     y,y
 		//            y,y
 
-		c, k := newShapeForMatMul(a, b)
+		c, k, _ := newShapeForMatMul(a, b)
 		assert.Equal(t, c, Shape{2, 2})
 		assert.Equal(t, 3, k)
-
-		iter := c.Iter()
-		assert.Equal(t,
-			getMatmulPairs(a, b, iter.Step()),
-			[]matmulPair{
-				{
-					a: []int{0, 0},
-					b: []int{0, 0},
-				},
-				{
-					a: []int{0, 1},
-					b: []int{1, 0},
-				},
-				{
-					a: []int{0, 2},
-					b: []int{2, 0},
-				},
-			})
-
-		// 0,1
-		assert.Equal(t,
-			getMatmulPairs(a, b, iter.Step()),
-			[]matmulPair{
-				{
-					a: []int{0, 0},
-					b: []int{0, 1},
-				},
-				{
-					a: []int{0, 1},
-					b: []int{1, 1},
-				},
-				{
-					a: []int{0, 2},
-					b: []int{2, 1},
-				},
-			})
 	})
 }
+
+func TestBroadcastShape(t *testing.T) {
+	specs := []struct {
+		a, b     Shape
+		expected Shape
+	}{
+		{Shape{2, 3}, Shape{2, 3}, Shape{2, 3}},
+		{Shape{2, 3}, Shape{3}, Shape{2, 3}},
+		{Shape{3}, Shape{2, 3}, Shape{2, 3}},
+		{Shape{2, 1, 3}, Shape{4, 1}, Shape{2, 4, 3}},
+		{Shape{1}, Shape{5, 4}, Shape{5, 4}},
+		{Shape{5, 1, 4}, Shape{1, 3, 1}, Shape{5, 3, 4}},
+		{Shape{2, 3}, Shape{3, 2}, nil},
+		{Shape{2, 3}, Shape{2}, nil},
+	}
+
+	for _, spec := range specs {
+		actual, err := broadcastShape(spec.a, spec.b)
+		if spec.expected == nil {
+			assert.NotNil(t, err)
+			continue
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, spec.expected, actual)
+	}
+}
+
+func TestBroadcastIndex(t *testing.T) {
+	assert.Equal(t, []int{0, 1, 2, 3}, broadcastIndex(Shape{2, 2}, Shape{2, 2}))
+	assert.Equal(t, []int{0, 1, 2, 0, 1, 2}, broadcastIndex(Shape{3}, Shape{2, 3}))
+	assert.Equal(t, []int{0, 0, 0, 1, 1, 1}, broadcastIndex(Shape{2, 1}, Shape{2, 3}))
+	assert.Equal(t, []int{0, 1, 0, 1, 2, 3, 2, 3}, broadcastIndex(Shape{2, 1, 2}, Shape{2, 2, 2}))
+}
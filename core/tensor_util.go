@@ -74,34 +74,34 @@ func toIndex(pos, shape []int) (ret int) {
 	return
 }
 
-func buildNdArrayIntoSingleDim[T ndb](arr T, shape []int, data []*V) {
+func buildNdArrayIntoSingleDim[T ndb](arr T, shape []int, data []float64) {
 	// dim should match with the shape of arr
 	switch v := any(arr).(type) {
 	case []uint8:
 		for _, i := range nrange(shape[0]) {
-			data[i] = Vx(float64(v[i]))
+			data[i] = float64(v[i])
 		}
 	case [][]uint8:
 		for _, i := range nrange(shape[0]) {
 			for _, j := range nrange(shape[1]) {
-				data[toIndex([]int{i, j}, shape)] = Vx(float64(v[i][j]))
+				data[toIndex([]int{i, j}, shape)] = float64(v[i][j])
 			}
 		}
 	case d1:
 		for _, i := range nrange(shape[0]) {
-			data[i] = Vx(v[i])
+			data[i] = v[i]
 		}
 	case d2:
 		for _, i := range nrange(shape[0]) {
 			for _, j := range nrange(shape[1]) {
-				data[toIndex([]int{i, j}, shape)] = Vx(v[i][j])
+				data[toIndex([]int{i, j}, shape)] = v[i][j]
 			}
 		}
 	case d3:
 		for _, i := range nrange(shape[0]) {
 			for _, j := range nrange(shape[1]) {
 				for _, k := range nrange(shape[2]) {
-					data[toIndex([]int{i, j, k}, shape)] = Vx(v[i][j][k])
+					data[toIndex([]int{i, j, k}, shape)] = v[i][j][k]
 				}
 			}
 		}
@@ -110,7 +110,7 @@ func buildNdArrayIntoSingleDim[T ndb](arr T, shape []int, data []*V) {
 			for _, j := range nrange(shape[1]) {
 				for _, k := range nrange(shape[2]) {
 					for _, l := range nrange(shape[3]) {
-						data[toIndex([]int{i, j, k, l}, shape)] = Vx(v[i][j][k][l])
+						data[toIndex([]int{i, j, k, l}, shape)] = v[i][j][k][l]
 					}
 				}
 			}
@@ -204,73 +204,137 @@ func parseShape[T ndb](arr T, dim []int) ([]int, error) {
 }
 
 func validShapesForMatmul(a, b Shape) error {
-	if len(a) < 2 || len(b) < 2 {
-		return errInvalidShape(a, b)
-	}
-	// check the basic matmul dimension
-	if a[len(a)-1] != b[len(b)-2] {
-		return errInvalidShape(a, b)
-	}
+	_, err := planMatmul(a, b)
+	return err
+}
 
-	// check the batch multiply dimension
-	for i := len(b) - 3; i >= 0; i-- {
-		if b[i] != a[i+len(a)-len(b)] {
-			return errInvalidShape(a, b)
-		}
-	}
-	return nil
+// newShapeForMatMul returns the shape of a @ b, and the size of the dimension being summed over
+func newShapeForMatMul(a, b Shape) (ret Shape, k int, err error) {
+	p, err := planMatmul(a, b)
+	return p.shape, p.k, err
 }
 
-// only support a reduced version of the matrix multiplication
-func newShapeForMatMul(a, b Shape) (ret Shape, k int) {
-	// the most common matrix usecase (for me)
-	// not taking care of broadcasting, I don't find it nature anyway
-	if len(a) < len(b) {
-		a, b = b, a
+// matmulPlan describes a @ b as a batch of (m, k) @ (k, n) matrix multiplications
+type matmulPlan struct {
+	shape   Shape // shape of the result
+	m, k, n int
+	// aBatch[i] and bBatch[i] are the matrices of a and b multiplied for the i-th matrix of the result
+	aBatch, bBatch []int
+}
+
+// planMatmul follows the semantic of torch.matmul:
+//   - vector @ vector is the dot product, which is a scalar (0-dim tensor)
+//   - matrix @ vector and vector @ matrix treat the vector as a (k, 1) or (1, k) matrix, the extra dimension
+//     is removed from the result
+//   - for batch matmul, the leading (batch) dimensions are broadcast against each other
+//     e.g. (10, 1, 3, 4) @ (5, 4, 2) -> (10, 5, 3, 2)
+func planMatmul(a, b Shape) (p matmulPlan, err error) {
+	if len(a) == 0 || len(b) == 0 {
+		return p, fmt.Errorf("matmul doesn't support scalar: a(%v), b(%v)", a, b)
 	}
 
-	// other types of configuration
-	// e.g. [2,3] @ [3] (lower dimension stuff)
+	am, bm := a, b
+	if len(a) == 1 {
+		am = Shape{1, a[0]}
+	}
+	if len(b) == 1 {
+		bm = Shape{b[0], 1}
+	}
 
-	// batch or normal matmul
-	Panic(validShapesForMatmul(a, b))
-	ret = make([]int, len(a))
-	copy(ret, a)
+	// the basic matmul dimension
+	p.m, p.k = am[len(am)-2], am[len(am)-1]
+	p.n = bm[len(bm)-1]
+	if p.k != bm[len(bm)-2] {
+		return p, errInvalidShape(a, b)
+	}
 
-	ret[len(a)-1] = b[len(b)-1]
-	k = a[len(a)-1]
-	return
-}
+	// the batch dimension
+	aBatch, bBatch := am[:len(am)-2], bm[:len(bm)-2]
+	batch, err := broadcastShape(aBatch, bBatch)
+	if err != nil {
+		return p, errInvalidShape(a, b)
+	}
+	p.aBatch = broadcastIndex(aBatch, batch)
+	p.bBatch = broadcastIndex(bBatch, batch)
 
-type matmulPair struct {
-	a []int
-	b []int
+	p.shape = append(Shape{}, batch...)
+	if len(a) > 1 {
+		p.shape = append(p.shape, p.m)
+	}
+	if len(b) > 1 {
+		p.shape = append(p.shape, p.n)
+	}
+	return p, nil
 }
 
-// sum(a(i,k) * b(k,j))
-func getMatmulPairs(a, b Shape, cPos []int) (ret []matmulPair) {
+// splitDim views shape as [outer, shape[dim], inner], i.e. the product of the dimensions before dim,
+// the size of dim, and the product of the dimensions after dim (which is also the stride of dim)
+func splitDim(shape Shape, dim int) (outer, n, inner int) {
+	return mul(shape[:dim]), shape[dim], mul(shape[dim+1:])
+}
 
+// broadcastShape follows the broadcasting rule of numpy:
+// the shapes are aligned from the trailing dimension, and each pair of dimensions must either be equal,
+// or one of them is 1 (or missing), in which case it is stretched to the other one
+// e.g. (2, 1, 3) and (4, 1) -> (2, 4, 3)
+func broadcastShape(a, b Shape) (Shape, error) {
+	origA, origB := a, b
 	if len(a) < len(b) {
 		a, b = b, a
 	}
 
-	Panic(validShapesForMatmul(a, b))
-	// assumption:
-	// - len(a) >= 2 && len(b) >= 2
-	// - len(a) == len(cPos)
-	// - len(b) <= len(cPos)
-	// - a[len(a)-2] == b[len(b)-1]
-	k := a[len(a)-1]
-	for i := 0; i < k; i++ {
-		aa := append([]int{}, cPos...)
-		aa[len(a)-1] = i
-		bb := append([]int{}, cPos[len(cPos)-len(b):]...)
-		bb[len(b)-2] = i
-		ret = append(ret, matmulPair{
-			a: aa,
-			b: bb,
-		})
+	ret := make(Shape, len(a))
+	copy(ret, a)
+	diff := len(a) - len(b)
+	for i := range b {
+		switch {
+		case b[i] == a[i+diff]:
+		case b[i] == 1:
+		case a[i+diff] == 1:
+			ret[i+diff] = b[i]
+		default:
+			return nil, fmt.Errorf("cannot broadcast shapes: a(%v), b(%v)", origA, origB)
+		}
 	}
+	return ret, nil
+}
 
-	return
+// broadcastIndex maps every flat index of shape `to` into the flat index of the element of shape `from`
+// it is broadcast from, `to` has to be a valid broadcast shape of `from`
+func broadcastIndex(from, to Shape) []int {
+	ret := make([]int, to.Cap())
+	if from.Equal(to) {
+		for i := range ret {
+			ret[i] = i
+		}
+		return ret
+	}
+
+	// strides of from, aligned with the dimensions of to, a stretched dimension doesn't move
+	diff := len(to) - len(from)
+	strides := make([]int, len(to))
+	stride := 1
+	for i := len(from) - 1; i >= 0; i-- {
+		if from[i] != 1 {
+			strides[i+diff] = stride
+		}
+		stride *= from[i]
+	}
+
+	pos := make([]int, len(to))
+	var idx int
+	for i := range ret {
+		ret[i] = idx
+		// move to the next position like an odometer
+		for d := len(to) - 1; d >= 0; d-- {
+			pos[d]++
+			idx += strides[d]
+			if pos[d] < to[d] {
+				break
+			}
+			idx -= strides[d] * pos[d]
+			pos[d] = 0
+		}
+	}
+	return ret
 }
@@ -21,13 +21,6 @@ func mul[T ~int | ~float64](arr []T) (ret T) {
 	return
 }
 
-func sum[T ~int | ~float64](arr []T) (ret T) {
-	for _, t := range arr {
-		ret += t
-	}
-	return
-}
-
 func Panic(err error) {
 	if err != nil {
 		panic(err.Error())
@@ -0,0 +1,295 @@
+package core
+
+import "fmt"
+
+// a view is a tensor sharing the storage (data and gradients) of another one, only the way to walk through the
+// elements is changed by the strides and offset, so nothing is copied.
+// the elements of a view are laid out as:
+//
+//	data[offset + pos[0]*strides[0] + pos[1]*strides[1] + ...]
+//
+// most of the operations need the row major layout, they call contiguous() to materialize the view first.
+
+// rowMajorStrides returns the strides of the default (row major) layout
+func rowMajorStrides(shape Shape) []int {
+	ret := make([]int, len(shape))
+	stride := 1
+	for i := len(shape) - 1; i >= 0; i-- {
+		ret[i] = stride
+		stride *= shape[i]
+	}
+	return ret
+}
+
+func (t Tensor) stride() []int {
+	if t.strides == nil {
+		return rowMajorStrides(t.Shape)
+	}
+	return t.strides
+}
+
+// IsContiguous tells if the elements of t are laid out in row major order, filling its whole storage
+func (t Tensor) IsContiguous() bool {
+	if t.offset != 0 || len(t.data) != t.Shape.Cap() {
+		return false
+	}
+	if t.strides == nil {
+		return true
+	}
+	for i, s := range rowMajorStrides(t.Shape) {
+		if t.Shape[i] != 1 && t.strides[i] != s {
+			return false
+		}
+	}
+	return true
+}
+
+// storageIndex returns the index in storage of every element of t, in row major order
+func (t Tensor) storageIndex() []int {
+	ret := make([]int, t.Shape.Cap())
+	strides := t.stride()
+	pos := make([]int, len(t.Shape))
+	idx := t.offset
+	for i := range ret {
+		ret[i] = idx
+		// move to the next position like an odometer
+		for d := len(t.Shape) - 1; d >= 0; d-- {
+			pos[d]++
+			idx += strides[d]
+			if pos[d] < t.Shape[d] {
+				break
+			}
+			idx -= strides[d] * pos[d]
+			pos[d] = 0
+		}
+	}
+	return ret
+}
+
+// values returns the elements in row major order, without recording anything into the computation graph
+// it is the storage itself if t is contiguous
+func (t Tensor) values() []float64 {
+	if t.IsContiguous() {
+		return t.data
+	}
+	idx := t.storageIndex()
+	ret := make([]float64, len(idx))
+	for i := range idx {
+		ret[i] = t.data[idx[i]]
+	}
+	return ret
+}
+
+// Contiguous returns t if it is contiguous, otherwise a copy of t in row major order
+func (t Tensor) Contiguous() Tensor {
+	return t.contiguous()
+}
+
+func (t Tensor) contiguous() Tensor {
+	if t.IsContiguous() {
+		return t
+	}
+
+	idx := t.storageIndex()
+	data := make([]float64, len(idx))
+	for i := range idx {
+		data[i] = t.data[idx[i]]
+	}
+
+	ret := fromData(data, t.Shape)
+	record(&ret, "contiguous", func(grad []float64) {
+		if !t.requiresGrad {
+			return
+		}
+		tg := t.gradBuf()
+		for i := range idx {
+			tg[idx[i]] += grad[i]
+		}
+	}, t)
+	return ret
+}
+
+// view creates a tensor over the same storage as t, with a new layout
+// the storage is narrowed down to the span of the elements reachable from the new layout, so a view over a range of
+// rows (e.g. a batch) is contiguous itself. the gradients are shared with t as well: the gradient buffer is a window
+// into the one of t, so the view is just an ordering constraint in the computation graph and has nothing to do in
+// backward.
+func (t Tensor) view(shape Shape, strides []int, offset int) Tensor {
+	if strides == nil {
+		strides = rowMajorStrides(shape)
+	}
+
+	lo, hi := offset, offset+1
+	for i := range shape {
+		if shape[i] == 0 {
+			hi = lo
+			break
+		}
+		if strides[i] > 0 {
+			hi += (shape[i] - 1) * strides[i]
+		} else {
+			lo += (shape[i] - 1) * strides[i]
+		}
+	}
+
+	st := &storage{
+		data:         t.data[lo:hi],
+		requiresGrad: t.requiresGrad,
+		base:         t.storage,
+	}
+	if t.requiresGrad {
+		// not marked dense yet, the backward passes through the view will (e.g. after a ZeroGrad of the base)
+		st.grad = t.allocGrad()[lo:hi]
+	}
+
+	ret := Tensor{
+		storage: st,
+		Shape:   shape,
+		strides: strides,
+		offset:  offset - lo,
+	}
+	if ret.IsContiguous() {
+		ret.strides = nil
+	}
+	record(&ret, "view", func([]float64) {}, t)
+	if ret.prev != nil {
+		ret.prev.out = nil // the gradient belongs to t, e.g. a leaf accumulating across backward passes
+	}
+	return ret
+}
+
+// normDim turns a negative dim (counting from the end) into a positive one
+func normDim(dim, ndim int) int {
+	if dim < 0 {
+		dim += ndim
+	}
+	if dim < 0 || dim >= ndim {
+		panic(fmt.Sprintf("invalid dim %d for a tensor of %d dims", dim, ndim))
+	}
+	return dim
+}
+
+// inferShape replaces the -1 in dims with the size fitting n elements
+func inferShape(dims []int, n int) Shape {
+	ret := make(Shape, len(dims))
+	copy(ret, dims)
+
+	infer := -1
+	known := 1
+	for i, d := range ret {
+		switch {
+		case d == -1 && infer == -1:
+			infer = i
+		case d < 0:
+			panic(fmt.Sprintf("invalid shape %v", dims))
+		default:
+			known *= d
+		}
+	}
+	if infer != -1 && known != 0 {
+		ret[infer] = n / known
+	}
+	if ret.Cap() != n {
+		panic(fmt.Sprintf("shape %v is invalid for %d elements", dims, n))
+	}
+	return ret
+}
+
+// View returns a tensor of a new shape sharing the data and gradients of t, t has to be contiguous
+// one of the dims can be -1, which is inferred from the number of elements
+func (t Tensor) View(dims ...int) Tensor {
+	if !t.IsContiguous() {
+		panic(fmt.Sprintf("view on a non-contiguous tensor (shape: %v, strides: %v), use Reshape instead",
+			t.Shape, t.stride()))
+	}
+	return t.view(inferShape(dims, t.Shape.Cap()), nil, 0)
+}
+
+// Reshape is View, but copies t when it is not contiguous
+func (t Tensor) Reshape(dims ...int) Tensor {
+	return t.contiguous().View(dims...)
+}
+
+// Flatten merges the dims from start to end (both inclusive, can be negative) into one
+// e.g. a batch of images (64, 1, 28, 28).Flatten(1, -1) -> (64, 784)
+func (t Tensor) Flatten(start, end int) Tensor {
+	start, end = normDim(start, t.Dim()), normDim(end, t.Dim())
+	if start > end {
+		panic(fmt.Sprintf("flatten: start dim %d > end dim %d", start, end))
+	}
+
+	dims := append([]int{}, t.Shape[:start]...)
+	dims = append(dims, mul(t.Shape[start:end+1]))
+	dims = append(dims, t.Shape[end+1:]...)
+	return t.Reshape(dims...)
+}
+
+// Permute reorders the dimensions, the i-th dim of the result is the dims[i]-th dim of t
+func (t Tensor) Permute(dims ...int) Tensor {
+	if len(dims) != t.Dim() {
+		panic(fmt.Sprintf("permute: %v doesn't match the shape %v", dims, t.Shape))
+	}
+
+	seen := make([]bool, t.Dim())
+	strides := t.stride()
+	shape := make(Shape, len(dims))
+	newStrides := make([]int, len(dims))
+	for i, d := range dims {
+		d = normDim(d, t.Dim())
+		if seen[d] {
+			panic(fmt.Sprintf("permute: repeated dim in %v", dims))
+		}
+		seen[d] = true
+		shape[i], newStrides[i] = t.Shape[d], strides[d]
+	}
+	return t.view(shape, newStrides, t.offset)
+}
+
+// Transpose swaps the dimension d0 and d1
+func (t Tensor) Transpose(d0, d1 int) Tensor {
+	dims := nrange(t.Dim())
+	d0, d1 = normDim(d0, t.Dim()), normDim(d1, t.Dim())
+	dims[d0], dims[d1] = dims[d1], dims[d0]
+	return t.Permute(dims...)
+}
+
+// T reverses the dimensions, which is the transpose for a matrix
+func (t Tensor) T() Tensor {
+	dims := make([]int, t.Dim())
+	for i := range dims {
+		dims[i] = t.Dim() - 1 - i
+	}
+	return t.Permute(dims...)
+}
+
+// Squeeze removes the given dims of size 1, or all the dims of size 1 if no dim is given
+func (t Tensor) Squeeze(dims ...int) Tensor {
+	drop := make([]bool, t.Dim())
+	for i := range t.Shape {
+		drop[i] = len(dims) == 0 && t.Shape[i] == 1
+	}
+	for _, d := range dims {
+		d = normDim(d, t.Dim())
+		drop[d] = t.Shape[d] == 1
+	}
+
+	var shape Shape = []int{}
+	var strides []int
+	for i, s := range t.stride() {
+		if !drop[i] {
+			shape = append(shape, t.Shape[i])
+			strides = append(strides, s)
+		}
+	}
+	return t.view(shape, strides, t.offset)
+}
+
+// Unsqueeze inserts a dim of size 1 at dim, which can be t.Dim() to append one at the end
+func (t Tensor) Unsqueeze(dim int) Tensor {
+	dim = normDim(dim, t.Dim()+1)
+	strides := t.stride()
+
+	shape := append(append(append(Shape{}, t.Shape[:dim]...), 1), t.Shape[dim:]...)
+	newStrides := append(append(append([]int{}, strides[:dim]...), 1), strides[dim:]...)
+	return t.view(shape, newStrides, t.offset)
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReshape(t *testing.T) {
+	a := NewTensor(d2{{1, 2, 3}, {4, 5, 6}})
+
+	b := a.View(3, 2)
+	assert.Equal(t, Shape{3, 2}, b.Shape)
+	assert.True(t, b.Equal(NewTensor(d2{{1, 2}, {3, 4}, {5, 6}})))
+
+	// shared storage
+	a.Data()[0] = 10
+	assert.Equal(t, 10., b.Loc([]int{0, 0}))
+
+	assert.Equal(t, Shape{6}, a.Reshape(-1).Shape)
+	assert.Equal(t, Shape{1, 2, 3}, a.Reshape(1, -1, 3).Shape)
+	assert.Panics(t, func() { a.Reshape(4, -1) })
+	assert.Panics(t, func() { a.T().View(6) })
+
+	// reshape copies the non-contiguous tensor
+	c := a.T().Reshape(6)
+	assert.True(t, c.Equal(NewTensor(d1{10, 4, 2, 5, 3, 6})))
+
+	images := Zeros(64, 784)
+	assert.Equal(t, Shape{64, 1, 28, 28}, images.Reshape(64, 1, 28, 28).Shape)
+	assert.Equal(t, Shape{64, 784}, images.Reshape(64, 1, 28, 28).Flatten(1, -1).Shape)
+	assert.Equal(t, Shape{64 * 784}, images.Flatten(0, -1).Shape)
+}
+
+func TestTranspose(t *testing.T) {
+	a := NewTensor(d2{{1, 2, 3}, {4, 5, 6}})
+	b := a.T()
+	assert.Equal(t, Shape{3, 2}, b.Shape)
+	assert.False(t, b.IsContiguous())
+	assert.True(t, b.Equal(NewTensor(d2{{1, 4}, {2, 5}, {3, 6}})))
+	assert.Equal(t, []float64{1, 4, 2, 5, 3, 6}, b.Data())
+	assert.True(t, b.Contiguous().IsContiguous())
+	assert.True(t, b.T().IsContiguous())
+
+	c := NewTensor(d3{{{1, 2}, {3, 4}}, {{5, 6}, {7, 8}}})
+	assert.True(t, c.Transpose(0, 2).Equal(NewTensor(d3{{{1, 5}, {3, 7}}, {{2, 6}, {4, 8}}})))
+	assert.True(t, c.Permute(1, 0, 2).Equal(NewTensor(d3{{{1, 2}, {5, 6}}, {{3, 4}, {7, 8}}})))
+	assert.True(t, c.Permute(1, 0, 2).Permute(1, 0, 2).Equal(c))
+	assert.Panics(t, func() { c.Permute(0, 0, 1) })
+}
+
+func TestSqueeze(t *testing.T) {
+	a := Ones(2, 1, 3, 1)
+	assert.Equal(t, Shape{2, 3}, a.Squeeze().Shape)
+	assert.Equal(t, Shape{2, 3, 1}, a.Squeeze(1).Shape)
+	assert.Equal(t, Shape{2, 1, 3}, a.Squeeze(-1).Shape)
+	assert.Equal(t, Shape{2, 1, 3, 1}, a.Squeeze(0).Shape)
+	assert.Equal(t, Shape{}, Ones(1, 1).Squeeze().Shape)
+
+	b := NewTensor(d1{1, 2, 3})
+	assert.Equal(t, Shape{1, 3}, b.Unsqueeze(0).Shape)
+	assert.Equal(t, Shape{3, 1}, b.Unsqueeze(1).Shape)
+	assert.Equal(t, Shape{3, 1}, b.Unsqueeze(-1).Shape)
+	assert.True(t, b.Unsqueeze(1).Equal(NewTensor(d2{{1}, {2}, {3}})))
+
+	// unsqueeze of a transposed view
+	c := NewTensor(d2{{1, 2, 3}, {4, 5, 6}}).T().Unsqueeze(1)
+	assert.True(t, c.Equal(NewTensor(d3{{{1, 4}}, {{2, 5}}, {{3, 6}}})))
+}
+
+func TestSliceView(t *testing.T) {
+	a := NewTensor(d2{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}})
+
+	// a range of rows is still contiguous
+	rows := a.Slice(S{1, 3})
+	assert.True(t, rows.IsContiguous())
+	rows.Data()[0] = 40
+	assert.Equal(t, 40., a.Loc([]int{1, 0}))
+
+	b := a.T().Slice(S{1, 3}, S{0, 2})
+	assert.True(t, b.Equal(NewTensor(d2{{2, 5}, {3, 6}})))
+}
+
+func TestViewBackward(t *testing.T) {
+	w := Randn(3, 4).SetRequiresGrad(true)
+	x := Randn(3, 5)
+
+	// the weight gradient of a linear layer: x^T @ grad
+	fn := func(...Tensor) Tensor {
+		return x.T().Matmul(w).Reshape(-1).Pow(2).Add(w.T().Slice(S{1, 3}).Flatten(0, 1).Unsqueeze(1))
+	}
+	assert.Nil(t, GradCheck(fn, []Tensor{w}, GradCheckOptions{Atol: 1e-5, Rtol: 1e-9}))
+
+	// the gradient of a view is the gradient of the viewed elements
+	w.ZeroGrad()
+	v := w.Slice(S{1, 2}, S{1, 3})
+	v.MulS(3).Backward()
+	assert.Equal(t, []float64{3, 3}, v.Grad())
+	assert.Equal(t, []float64{0, 0, 0, 0, 0, 3, 3, 0, 0, 0, 0, 0}, w.Grad())
+
+	// back propagate from a view
+	w.ZeroGrad()
+	w.MulS(2).T().Slice(S{0, 1}).Backward()
+	assert.Equal(t, []float64{2, 0, 0, 0, 2, 0, 0, 0, 2, 0, 0, 0}, w.Grad())
+
+	w.T().ZeroGrad()
+	assert.Equal(t, make([]float64, 12), w.Grad())
+}
@@ -0,0 +1,75 @@
+package examples
+
+import (
+	"dexianta/tgnn/core"
+	"dexianta/tgnn/loss"
+	"dexianta/tgnn/nn"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// a character-level language model: a LSTM reads a text one character at a time and predicts the next one
+func TestCharLM(t *testing.T) {
+	text := strings.Repeat("hello world, the quick brown fox jumps over the lazy dog. ", 20)
+
+	var vocab []rune
+	index := map[rune]int{}
+	for _, c := range text {
+		if _, ok := index[c]; !ok {
+			index[c] = len(vocab)
+			vocab = append(vocab, c)
+		}
+	}
+	chars := []rune(text)
+
+	// a batch of windows starting at random positions, the inputs are one-hot (seq, batch, vocab) and the
+	// targets are the next characters (seq*batch)
+	const seqLen, batchSize, hidden = 16, 8, 32
+	batch := func() (core.Tensor, core.Tensor) {
+		x := core.Zeros(seqLen, batchSize, len(vocab))
+		y := make([]float64, seqLen*batchSize)
+		for b := 0; b < batchSize; b++ {
+			start := rand.Intn(len(chars) - seqLen - 1)
+			for s := 0; s < seqLen; s++ {
+				x.Data()[(s*batchSize+b)*len(vocab)+index[chars[start+s]]] = 1
+				y[s*batchSize+b] = float64(index[chars[start+s+1]])
+			}
+		}
+		return x, core.NewTensor(y)
+	}
+
+	lstm := nn.NewLSTM(len(vocab), hidden)
+	head := nn.NewLinear(hidden, len(vocab))
+	params := append(lstm.Parameters(), head.Parameters()...)
+
+	lr := 1.
+	var first, last float64
+	for step := 0; step < 200; step++ {
+		x, y := batch()
+		out := head.Forward(lstm.Forward(x)) // (seq, batch, vocab)
+		l := loss.CrossEntropyLoss(out.View(-1, len(vocab)), y)
+		l.Backward()
+
+		for _, p := range params {
+			data, grad := p.Data(), p.Grad()
+			for j := range data {
+				data[j] -= lr * grad[j]
+			}
+		}
+		nn.ZeroGrad(params)
+
+		if step == 0 {
+			first = l.Data()[0]
+		}
+		last = l.Data()[0]
+		if step%25 == 0 {
+			fmt.Printf("step %d, loss: %f\n", step, last)
+		}
+	}
+	fmt.Printf("loss: %f -> %f\n", first, last)
+	if last >= first/2 {
+		t.Errorf("the loss didn't decrease enough: %f -> %f", first, last)
+	}
+}
@@ -0,0 +1,62 @@
+package examples
+
+import (
+	"dexianta/tgnn/core"
+	"dexianta/tgnn/data"
+	"dexianta/tgnn/loss"
+	"dexianta/tgnn/nn"
+	"fmt"
+	"testing"
+)
+
+// a LeNet-5 style convolutional network, the images are kept as (1, 28, 28) instead of flat 784-vectors
+func TestLeNetMnist(t *testing.T) {
+	model := nn.Sequential{
+		nn.NewConv2d(1, 6, 5, nn.WithPadding(2)), // (N, 6, 28, 28)
+		&nn.ReLU{},
+		&nn.MaxPool2d{Kernel: 2}, // (N, 6, 14, 14)
+		nn.NewConv2d(6, 16, 5),   // (N, 16, 10, 10)
+		&nn.ReLU{},
+		&nn.MaxPool2d{Kernel: 2}, // (N, 16, 5, 5)
+		&nn.Flatten{},            // (N, 400)
+		nn.NewLinear(400, 120),
+		&nn.ReLU{},
+		nn.NewLinear(120, 84),
+		&nn.ReLU{},
+		nn.NewLinear(84, 10),
+	}
+
+	train, test := data.MnistLoader()
+	trainX, trainY := train.Tensors()
+	trainX = trainX.DivS(255).View(-1, 1, 28, 28)
+	testX, testY := test.Tensors()
+	testX = testX.DivS(255).View(-1, 1, 28, 28)
+
+	// a fraction of an epoch keeps the example fast
+	lr := 0.1
+	batchSize := 64
+	batches := 200
+	for b := 0; b < batches; b++ {
+		i := b * batchSize
+		out := model.Forward(trainX.Slice(core.S{i, i + batchSize}))
+		l := loss.CrossEntropyLoss(out, trainY.Slice(core.S{i, i + batchSize}))
+		l.Backward()
+
+		for _, p := range model.Parameters() {
+			data, grad := p.Data(), p.Grad()
+			for j := range data {
+				data[j] -= lr * grad[j]
+			}
+		}
+		model.ZeroGrad()
+
+		if b%20 == 0 {
+			fmt.Printf("batch %d, loss: %f\n", b, l.Data()[0])
+		}
+	}
+	acc := accuracy(model.Forward(testX.Slice(core.S{0, 1000})), testY.Slice(core.S{0, 1000}))
+	fmt.Printf("test accuracy: %f\n", acc)
+	if acc < 0.9 {
+		t.Errorf("the test accuracy is too low: %f", acc)
+	}
+}
@@ -0,0 +1,62 @@
+package examples
+
+import (
+	"dexianta/tgnn/core"
+	"dexianta/tgnn/data"
+	"dexianta/tgnn/loss"
+	"dexianta/tgnn/nn"
+	"fmt"
+	"testing"
+)
+
+// a deep MLP with batch norm after every hidden layer, which keeps the activations in range so a large learning rate
+// doesn't diverge
+func TestDeepMnistBatchNorm(t *testing.T) {
+	model := nn.Sequential{nn.NewLinear(784, 128, nn.WithoutBias()), nn.NewBatchNorm1d(128), &nn.ReLU{}}
+	for i := 0; i < 4; i++ {
+		model = append(model, nn.NewLinear(128, 128, nn.WithoutBias()), nn.NewBatchNorm1d(128), &nn.ReLU{})
+	}
+	model = append(model, nn.NewLinear(128, 10))
+
+	train, test := data.MnistLoader()
+	trainX, trainY := train.Tensors()
+	trainX = trainX.DivS(255)
+	testX, testY := test.Tensors()
+	testX = testX.DivS(255)
+
+	lr := 0.5
+	batchSize := 64
+	batches := 100
+	var first, last float64
+	for b := 0; b < batches; b++ {
+		i := b * batchSize
+		out := model.Forward(trainX.Slice(core.S{i, i + batchSize}))
+		l := loss.CrossEntropyLoss(out, trainY.Slice(core.S{i, i + batchSize}))
+		l.Backward()
+
+		for _, p := range model.Parameters() {
+			data, grad := p.Data(), p.Grad()
+			for j := range data {
+				data[j] -= lr * grad[j]
+			}
+		}
+		model.ZeroGrad()
+
+		if b == 0 {
+			first = l.Data()[0]
+		}
+		last = l.Data()[0]
+		if b%20 == 0 {
+			fmt.Printf("batch %d, loss: %f\n", b, l.Data()[0])
+		}
+	}
+
+	// the running stats are used for the evaluation
+	model.Eval()
+	acc := accuracy(model.Forward(testX.Slice(core.S{0, 1000})), testY.Slice(core.S{0, 1000}))
+	fmt.Printf("loss: %f -> %f, test accuracy: %f\n", first, last, acc)
+	// a NaN loss fails the first check
+	if !(last < first/2) || acc < 0.85 {
+		t.Errorf("the deep MLP didn't train: loss %f -> %f, test accuracy %f", first, last, acc)
+	}
+}
@@ -3,56 +3,57 @@ package examples
 import (
 	"dexianta/tgnn/core"
 	"dexianta/tgnn/data"
+	"dexianta/tgnn/loss"
+	"dexianta/tgnn/nn"
 	"fmt"
-	"math"
 	"testing"
 )
 
 // this example roughly follow the example given here:
 // https://pytorch.org/tutorials/beginner/nn_tutorial.html
 func TestBasicMnist(t *testing.T) {
-	weights := core.Randn(784, 10).DivS(math.Sqrt(784))
-	bias := core.Zeros(10)
+	linear := nn.NewLinear(784, 10)
 
-	train, _ := data.MnistLoader()
+	train, test := data.MnistLoader()
 	trainX, trainY := train.Tensors()
-	//testX, testY := test.Tensors()
+	trainX = trainX.DivS(255) // pixel values into [0, 1]
+	testX, testY := test.Tensors()
+	testX = testX.DivS(255)
 
 	// the input batch has the size of (64 (batch size), 10)
 	// after the log softmax, the highest value will be approaching 0
 	model := func(input core.Tensor) core.Tensor {
-		matmul := input.Matmul(weights).Add(bias)
-		return core.LogSoftmax(matmul, 1) // the max of log_softmax is 0
+		return core.LogSoftmax(linear.Forward(input), 1) // the max of log_softmax is 0
 	}
 
 	// input shape: [batch size, 10]
 	// target shape: [batch size], each element is 0 to 9
-	// why this loss function works:
-	// for one input:
-	// [-20, -30, -40, -24, ... , -10] (size 10, for 10 digits)
-	// target:
-	//    5
-	// mean([input[idx][target[i]] for i in range(batch_size)]) * -1
-	// we are optimizing so that the probability of input[idx][target[idx]]
-	// to be the highest, the reason for multiply by -1 is log_softmax has all number to be negative
-	lossFunc := func(input, target core.Tensor) *core.V {
-		var pos = make([]core.Pos, input.Shape[0])
-		for i := range pos {
-			pos[i] = make([]int, 2) // input and target are both dim 2 tensor
-			pos[i][0] = i
-			pos[i][1] = int(target.GetV(core.Pos{i}).Data)
-		}
-
-		return core.Mean(input.GetVs(pos)).Mul(core.Vx(-1))
+	// the negative log likelihood is the mean of -input[i][target[i]], minimizing it maximizes the (log) probability
+	// of the target digits. it is the same as loss.CrossEntropyLoss over the logits before the log softmax
+	lossFunc := func(input, target core.Tensor) core.Tensor {
+		return loss.NLLLoss(input, target)
 	}
 
-	//TODO:
-	//accuracy := func(out, yb core.Tensor) float64 {
-	//	return 0.
-	//}
+	lr := 0.5
+	batchSize := 64
+	for i := 0; i+batchSize <= trainX.Shape[0]; i += batchSize {
+		preds := model(trainX.Slice(core.S{i, i + batchSize}))
+		target := trainY.Slice(core.S{i, i + batchSize})
+		l := lossFunc(preds, target)
+		l.Backward()
+
+		// plain gradient descent
+		for _, p := range linear.Parameters() {
+			data, grad := p.Data(), p.Grad()
+			for j := range data {
+				data[j] -= lr * grad[j]
+			}
+		}
+		linear.ZeroGrad()
 
-	preds := model(trainX.Slice(core.S{0, 64}))
-	target := trainY.Slice(core.S{0, 64})
-	loss := lossFunc(preds, target)
-	fmt.Println(loss)
+		if i%(batchSize*100) == 0 {
+			fmt.Printf("batch %d, loss: %f\n", i/batchSize, l.Data()[0])
+		}
+	}
+	fmt.Printf("test accuracy: %f\n", accuracy(model(testX), testY))
 }
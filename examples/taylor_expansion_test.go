@@ -2,6 +2,7 @@ package examples
 
 import (
 	"dexianta/tgnn/core"
+	"dexianta/tgnn/optim"
 	"fmt"
 	"math"
 	"math/rand"
@@ -63,3 +64,33 @@ func TestTaylorWithV(t *testing.T) {
 		mop.ZeroGrad()
 	}
 }
+
+// the same fit with tensors, where Adam with a one cycle schedule can start with a large lr and still end on a fine fit,
+// when the fixed lr above has to stay small enough for the first steps
+func TestTaylorWithScheduler(t *testing.T) {
+	var powers, y [][]float64
+	for _, x := range core.Range(-3, 3, 0.5) {
+		powers = append(powers, []float64{x * x, x * x * x, x * x * x * x, x * x * x * x * x})
+		y = append(y, []float64{math.Exp(x) - 1 - x})
+	}
+	xs, ys := core.NewTensor(powers), core.NewTensor(y)
+	coefs := core.Zeros(4, 1).SetRequiresGrad(true) // true val: (0.5, 0.1666.., 0.0416666.., 0.0083333..)
+
+	opt := optim.NewAdam([]core.Tensor{coefs}, 0.05)
+	sched := optim.NewOneCycle(opt, 500)
+	var mse float64
+	for i := 0; i < 500; i++ {
+		loss := xs.Matmul(coefs).Sub(ys).Pow(2).MeanAll()
+		loss.Backward()
+		opt.Step()
+		opt.ZeroGrad()
+		sched.Step()
+		mse = loss.Data()[0]
+		if i%50 == 0 {
+			fmt.Printf("==== (%d) ===\nlr: %f, mse: %f, (a, b, c, d): %v\n", i, sched.LR()[0], mse, coefs.Data())
+		}
+	}
+	if mse > 0.001 {
+		t.Errorf("the fit didn't converge, mse: %f", mse)
+	}
+}
@@ -0,0 +1,74 @@
+package examples
+
+import (
+	"dexianta/tgnn/core"
+	"dexianta/tgnn/loss"
+	"dexianta/tgnn/nn"
+	"dexianta/tgnn/optim"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// a tiny transformer learns to copy a sequence: the first half of the input holds random tokens, the second half is
+// blank (token 0) and has to be filled with the first half. every output position has to find the input position
+// half a sequence before it, which only attention combined with the positional encoding can do
+func TestTransformerCopy(t *testing.T) {
+	const vocab, half, embed, batchSize = 6, 4, 16, 16
+	rng := rand.New(rand.NewSource(1))
+
+	// the inputs and the targets are (seq, batch), only the second half of the targets is learned
+	batch := func() (core.Tensor, core.Tensor) {
+		x := core.Zeros(2*half, batchSize)
+		y := core.Zeros(half, batchSize)
+		xd, yd := x.Data(), y.Data()
+		for b := 0; b < batchSize; b++ {
+			for i := 0; i < half; i++ {
+				token := float64(1 + rng.Intn(vocab-1))
+				xd[i*batchSize+b] = token
+				yd[i*batchSize+b] = token
+			}
+		}
+		return x, y
+	}
+
+	embedding := nn.NewEmbedding(vocab, embed)
+	positions := nn.NewLearnedPositionalEncoding(2*half, embed)
+	encoder := nn.NewTransformerEncoderLayer(embed, 2, 32, nn.WithDropout(0), nn.WithNormFirst())
+	head := nn.NewLinear(embed, vocab)
+	model := func(x core.Tensor) core.Tensor {
+		h := encoder.Forward(positions.Forward(embedding.Forward(x)))
+		return head.Forward(h.SliceStep(0, half, 2*half, 1)) // (half, batch, vocab)
+	}
+
+	var params []core.Tensor
+	for _, m := range []nn.Module{embedding, positions, encoder, head} {
+		params = append(params, m.Parameters()...)
+	}
+	opt := optim.NewSGD(params, 0.05, optim.WithMomentum(0.9))
+
+	var first, last float64
+	for step := 0; step < 150; step++ {
+		x, y := batch()
+		out := model(x)
+		l := loss.CrossEntropyLoss(out.Reshape(-1, vocab), y.Reshape(-1))
+		l.Backward()
+		opt.Step()
+		opt.ZeroGrad()
+
+		if step == 0 {
+			first = l.Data()[0]
+		}
+		last = l.Data()[0]
+		if step%25 == 0 {
+			fmt.Printf("step %d, loss: %f, accuracy: %f\n", step, last, accuracy(out, y))
+		}
+	}
+
+	x, y := batch()
+	acc := accuracy(model(x), y)
+	fmt.Printf("loss: %f -> %f, accuracy: %f\n", first, last, acc)
+	if last >= first/2 || acc < 0.5 {
+		t.Errorf("the transformer didn't learn to copy: loss %f -> %f, accuracy %f", first, last, acc)
+	}
+}
@@ -0,0 +1,15 @@
+package examples
+
+import "dexianta/tgnn/core"
+
+// accuracy is the fraction of the predictions (the argmax of the last dim of out) equal to the target y
+func accuracy(out, y core.Tensor) float64 {
+	preds, target := out.ArgMax(-1, false).Data(), y.Data()
+	var correct float64
+	for i := range preds {
+		if preds[i] == target[i] {
+			correct++
+		}
+	}
+	return correct / float64(len(preds))
+}
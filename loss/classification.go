@@ -0,0 +1,167 @@
+package loss
+
+import (
+	"dexianta/tgnn/core"
+	"dexianta/tgnn/util"
+	"fmt"
+	"math"
+)
+
+// NLLLoss is the negative log likelihood loss, input is the log probabilities of shape (N, C) or (N, C, d1, d2, ...),
+// e.g. the output of core.LogSoftmax(x, 1), and target is the class indices of shape (N) or (N, d1, d2, ...)
+//
+// it supports the options WithReduction, WithWeight, WithIgnoreIndex and WithLabelSmoothing, the loss of a sample is
+//
+//	-(1 - eps) * w[y] * input[y] - eps / C * sum(w[c] * input[c])
+//
+// and Mean divides the sum by the sum of w[y] over the samples which are not ignored, same as pytorch
+func NLLLoss(input, target core.Tensor, opts ...Option) core.Tensor {
+	return classification("nll_loss", input, target, newConfig(opts), false)
+}
+
+// CrossEntropyLoss is NLLLoss over core.LogSoftmax(input, 1), so input is the unnormalized logits
+// it is a single operation, the gradient of the logits is computed directly as softmax - smoothed one-hot (for the
+// default options), which is faster and more stable than going through LogSoftmax
+func CrossEntropyLoss(input, target core.Tensor, opts ...Option) core.Tensor {
+	return classification("cross_entropy", input, target, newConfig(opts), true)
+}
+
+// classification computes NLLLoss, over the log softmax of input if logits
+func classification(op core.Op, input, target core.Tensor, c config, logits bool) core.Tensor {
+	if input.Dim() < 2 {
+		panic(fmt.Sprintf("%s expects an input of shape (N, C, ...), got %v", op, input.Shape))
+	}
+	expected := append(core.Shape{input.Shape[0]}, input.Shape[2:]...)
+	if !target.Shape.Equal(expected) {
+		panic(fmt.Sprintf("%s: target shape %v doesn't match input shape %v", op, target.Shape, input.Shape))
+	}
+	if c.reduction == BatchMean {
+		panic(fmt.Sprintf("%s doesn't support reduction %s", op, c.reduction))
+	}
+
+	// sample (o, in) is made of the elements (o*classes + k)*inner + in, for k in [0, classes)
+	batch, classes := input.Shape[0], input.Shape[1]
+	inner := target.Shape.Cap() / util.Imax(batch, 1)
+	var weight []float64
+	if c.weight == nil {
+		weight = make([]float64, classes)
+		for i := range weight {
+			weight[i] = 1
+		}
+	} else {
+		if !c.weight.Shape.Equal(core.Shape{classes}) {
+			panic(fmt.Sprintf("%s: class weights of shape %v for %d classes", op, c.weight.Shape, classes))
+		}
+		weight = c.weight.Contiguous().Data()
+	}
+
+	xs := input.Data()
+	ys := target.Data()
+	labels := make([]int, len(ys))
+	for i, y := range ys {
+		labels[i] = int(y)
+		if y != math.Trunc(y) || (labels[i] != c.ignoreIndex && (labels[i] < 0 || labels[i] >= classes)) {
+			panic(fmt.Sprintf("%s: target %v is out of range [0, %d)", op, y, classes))
+		}
+	}
+
+	// logp[i] is the log probabilities of the i-th sample, which are the log softmax of the logits
+	logp := make([][]float64, len(labels))
+	probs := make([][]float64, len(labels))
+	for i := range logp {
+		o, in := i/inner, i%inner
+		logp[i] = make([]float64, classes)
+		for k := range logp[i] {
+			logp[i][k] = xs[(o*classes+k)*inner+in]
+		}
+		if logits {
+			probs[i] = logSoftmax(logp[i])
+		}
+	}
+
+	eps := c.labelSmoothing
+	losses := make([]float64, len(labels))
+	var total float64 // the total weight for Mean
+	for i, y := range labels {
+		if y == c.ignoreIndex {
+			continue
+		}
+		var smooth float64
+		for k := range logp[i] {
+			smooth -= weight[k] * logp[i][k]
+		}
+		losses[i] = -(1-eps)*weight[y]*logp[i][y] + eps/float64(classes)*smooth
+		total += weight[y]
+	}
+
+	var data []float64
+	shape := core.Shape{}
+	switch c.reduction {
+	case None:
+		data, shape = losses, target.Shape
+	case Sum:
+		data = []float64{util.Sum(losses)}
+	case Mean:
+		data = []float64{util.Sum(losses) / total}
+	default:
+		panic(fmt.Sprintf("invalid reduction: %s", c.reduction))
+	}
+
+	return core.Function(op, shape, data, func(grad []float64) [][]float64 {
+		dx := make([]float64, len(xs))
+		dlogp := make([]float64, classes)
+		for i, y := range labels {
+			if y == c.ignoreIndex {
+				continue
+			}
+			var g float64
+			switch c.reduction {
+			case None:
+				g = grad[i]
+			case Sum:
+				g = grad[0]
+			case Mean:
+				g = grad[0] / total
+			}
+
+			var s float64
+			for k := range dlogp {
+				dlogp[k] = -eps / float64(classes) * weight[k] * g
+				if k == y {
+					dlogp[k] -= (1 - eps) * weight[y] * g
+				}
+				s += dlogp[k]
+			}
+			// through log softmax: dx = dlogp - softmax * sum(dlogp)
+			o, in := i/inner, i%inner
+			for k := range dlogp {
+				d := dlogp[k]
+				if logits {
+					d -= probs[i][k] * s
+				}
+				dx[(o*classes+k)*inner+in] = d
+			}
+		}
+		return [][]float64{dx}
+	}, input)
+}
+
+// logSoftmax replaces xs with its log softmax, and returns the softmax
+func logSoftmax(xs []float64) []float64 {
+	m := math.Inf(-1)
+	for _, x := range xs {
+		m = math.Max(m, x)
+	}
+	var s float64
+	for _, x := range xs {
+		s += math.Exp(x - m)
+	}
+	lse := m + math.Log(s)
+
+	probs := make([]float64, len(xs))
+	for k := range xs {
+		xs[k] -= lse
+		probs[k] = math.Exp(xs[k])
+	}
+	return probs
+}
@@ -0,0 +1,177 @@
+// Package loss implements the loss functions over core.Tensor, following the semantic of torch.nn.functional.
+// every loss function is a single node in the computation graph, with its gradient computed analytically.
+package loss
+
+import (
+	"dexianta/tgnn/core"
+	"dexianta/tgnn/util"
+	"fmt"
+)
+
+type Reduction string
+
+const (
+	Mean Reduction = "mean" // the mean over the elements (or the weighted mean for classification)
+	Sum  Reduction = "sum"
+	None Reduction = "none" // the loss of every element
+	// BatchMean is the sum divided by the batch size, only for KLDivLoss, which is the actual KL divergence
+	BatchMean Reduction = "batchmean"
+)
+
+// DefaultIgnoreIndex is the target value ignored by default, same as pytorch
+const DefaultIgnoreIndex = -100
+
+type config struct {
+	reduction      Reduction
+	weight         *core.Tensor
+	posWeight      *core.Tensor
+	ignoreIndex    int
+	labelSmoothing float64
+	delta          float64
+	logTarget      bool
+}
+
+type Option func(*config)
+
+func newConfig(opts []Option) config {
+	c := config{
+		reduction:   Mean,
+		ignoreIndex: DefaultIgnoreIndex,
+		delta:       1,
+	}
+	for _, o := range opts {
+		o(&c)
+	}
+	return c
+}
+
+// WithReduction sets how the losses of the elements are reduced, Mean by default
+func WithReduction(r Reduction) Option {
+	return func(c *config) {
+		c.reduction = r
+	}
+}
+
+// WithWeight sets the weight of each class for NLLLoss and CrossEntropyLoss,
+// or the weight of each element for BCEWithLogitsLoss, broadcast to the input like the arithmetic of core.Tensor, e.g.
+// a weight of shape (N, 1) weights the samples of an input of shape (N, C)
+func WithWeight(w core.Tensor) Option {
+	return func(c *config) {
+		c.weight = &w
+	}
+}
+
+// WithPosWeight sets the weight of the positive examples of BCEWithLogitsLoss, broadcast to the input like WithWeight,
+// e.g. one per class (the last dim)
+func WithPosWeight(w core.Tensor) Option {
+	return func(c *config) {
+		c.posWeight = &w
+	}
+}
+
+// WithIgnoreIndex sets the target value which doesn't contribute to the loss nor the gradient, e.g. a padding token
+func WithIgnoreIndex(i int) Option {
+	return func(c *config) {
+		c.ignoreIndex = i
+	}
+}
+
+// WithLabelSmoothing mixes the one-hot target with the uniform distribution: (1 - eps) * onehot + eps / classes
+func WithLabelSmoothing(eps float64) Option {
+	return func(c *config) {
+		if eps < 0 || eps > 1 {
+			panic(fmt.Sprintf("label smoothing must be in [0, 1], got %v", eps))
+		}
+		c.labelSmoothing = eps
+	}
+}
+
+// WithDelta sets the threshold between the quadratic and linear part of HuberLoss, 1 by default
+func WithDelta(delta float64) Option {
+	return func(c *config) {
+		if delta <= 0 {
+			panic(fmt.Sprintf("huber delta must be positive, got %v", delta))
+		}
+		c.delta = delta
+	}
+}
+
+// WithLogTarget tells KLDivLoss that the target is given as log probabilities
+func WithLogTarget() Option {
+	return func(c *config) {
+		c.logTarget = true
+	}
+}
+
+// reduce the element-wise losses, and returns the factor applied to each element, which is needed for the gradient
+// batch is the size of the first dimension, used by BatchMean
+func (c config) reduce(op core.Op, losses []float64, shape core.Shape, batch int) (data []float64,
+	outShape core.Shape, scale func(grad []float64, i int) float64) {
+	switch c.reduction {
+	case None:
+		return losses, shape, func(grad []float64, i int) float64 {
+			return grad[i]
+		}
+	case Sum, Mean, BatchMean:
+		n := 1.
+		switch c.reduction {
+		case Mean:
+			n = float64(len(losses))
+		case BatchMean:
+			if op != "kl_div" {
+				panic(fmt.Sprintf("%s doesn't support reduction %s", op, c.reduction))
+			}
+			n = float64(batch)
+		}
+		return []float64{util.Sum(losses) / n}, core.Shape{}, func(grad []float64, i int) float64 {
+			return grad[0] / n
+		}
+	default:
+		panic(fmt.Sprintf("invalid reduction: %s", c.reduction))
+	}
+}
+
+func checkSameShape(op core.Op, input, target core.Tensor) {
+	if !input.Shape.Equal(target.Shape) {
+		panic(fmt.Errorf("%s: input shape %v doesn't match target shape %v", op, input.Shape, target.Shape))
+	}
+}
+
+// elementwise builds a loss between input and target of the same shape,
+// fn gives the loss of an element and its derivatives with respect to x (input) and y (target)
+func elementwise(op core.Op, input, target core.Tensor, c config,
+	fn func(i int, x, y float64) (l, dx, dy float64)) core.Tensor {
+	checkSameShape(op, input, target)
+	xs, ys := input.Data(), target.Data()
+	batch := 1
+	if input.Dim() > 0 {
+		batch = input.Shape[0]
+	}
+
+	losses := make([]float64, len(xs))
+	for i := range xs {
+		losses[i], _, _ = fn(i, xs[i], ys[i])
+	}
+
+	data, shape, scale := c.reduce(op, losses, input.Shape, batch)
+	return core.Function(op, shape, data, func(grad []float64) [][]float64 {
+		var dInput, dTarget []float64
+		if input.RequiresGrad() {
+			dInput = make([]float64, len(xs))
+		}
+		if target.RequiresGrad() {
+			dTarget = make([]float64, len(ys))
+		}
+		for i := range xs {
+			_, dx, dy := fn(i, xs[i], ys[i])
+			g := scale(grad, i)
+			if dInput != nil {
+				dInput[i] = dx * g
+			}
+			if dTarget != nil {
+				dTarget[i] = dy * g
+			}
+		}
+		return [][]float64{dInput, dTarget}
+	}, input, target)
+}
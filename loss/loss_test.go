@@ -0,0 +1,188 @@
+package loss
+
+import (
+	"dexianta/tgnn/core"
+	"dexianta/tgnn/util"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrossEntropyLoss(t *testing.T) {
+	logits := core.NewTensor([][]float64{{1, 2, 3}, {1, 2, 3}})
+	target := core.NewTensor([]float64{2, 0})
+
+	cases := []struct {
+		name     string
+		opts     []Option
+		expected []float64
+	}{
+		{"mean", nil, []float64{(0.407606 + 2.407606) / 2}},
+		{"sum", []Option{WithReduction(Sum)}, []float64{0.407606 + 2.407606}},
+		{"none", []Option{WithReduction(None)}, []float64{0.407606, 2.407606}},
+		{"weight", []Option{WithWeight(core.NewTensor([]float64{2, 1, 1}))}, []float64{(0.407606 + 2*2.407606) / 3}},
+		{"ignore", []Option{WithIgnoreIndex(0)}, []float64{0.407606}},
+		{"smoothing", []Option{WithLabelSmoothing(0.3), WithReduction(None)},
+			[]float64{0.7*0.407606 + 0.1*4.222818, 0.7*2.407606 + 0.1*4.222818}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ret := CrossEntropyLoss(logits, target, c.opts...)
+			assert.Nil(t, core.EqualFloatArray(ret.Data(), c.expected, 1e-5))
+		})
+	}
+}
+
+func TestCrossEntropyMatchesNLL(t *testing.T) {
+	// (N, C, d) with every option, the fused gradient has to match going through LogSoftmax
+	opts := []Option{
+		WithWeight(core.NewTensor([]float64{0.5, 1, 2})),
+		WithIgnoreIndex(1),
+		WithLabelSmoothing(0.2),
+	}
+	target := core.NewTensor([][]float64{{0, 1, 2, 2}, {1, 0, 2, 0}})
+	x1 := core.Randn(2, 3, 4).SetRequiresGrad(true)
+	x2 := core.NewTensor(x1.Data()).Reshape(2, 3, 4).Detach().SetRequiresGrad(true)
+
+	for _, r := range []Reduction{Mean, Sum, None} {
+		x1.ZeroGrad()
+		x2.ZeroGrad()
+		ce := CrossEntropyLoss(x1, target, append(opts, WithReduction(r))...)
+		nll := NLLLoss(core.LogSoftmax(x2, 1), target, append(opts, WithReduction(r))...)
+		assert.Nil(t, core.EqualFloatArray(ce.Data(), nll.Data(), 1e-9), r)
+
+		ce.Backward()
+		nll.Backward()
+		assert.Nil(t, core.EqualFloatArray(x1.Grad(), x2.Grad(), 1e-9), r)
+	}
+}
+
+func TestNLLLoss(t *testing.T) {
+	// same as picking the target log probabilities
+	logp := core.LogSoftmax(core.Randn(5, 4), 1)
+	target := core.NewTensor([]float64{3, 0, 1, 1, 2})
+	expected := logp.Gather(1, target.Unsqueeze(1)).MeanAll().Neg()
+	assert.True(t, NLLLoss(logp, target).Equal(expected))
+
+	assert.Panics(t, func() { NLLLoss(logp, core.NewTensor([]float64{3, 0, 1, 1, 4})) })
+	assert.Panics(t, func() { NLLLoss(logp, core.NewTensor([]float64{3, 0, 1, 1})) })
+	assert.Panics(t, func() { NLLLoss(logp, target, WithWeight(core.Ones(3))) })
+}
+
+func TestClassificationGrad(t *testing.T) {
+	x := core.RandnRNG(rand.New(rand.NewSource(1)), 3, 4, 2).SetRequiresGrad(true)
+	target := core.NewTensor([][]float64{{0, 3}, {-100, 1}, {2, 2}})
+	opts := []Option{WithWeight(core.NewTensor([]float64{1, 2, 3, 4})), WithLabelSmoothing(0.1)}
+
+	for _, r := range []Reduction{Mean, Sum, None} {
+		opts := append(opts, WithReduction(r))
+		for name, fn := range map[string]func(...core.Tensor) core.Tensor{
+			"cross entropy": func(...core.Tensor) core.Tensor { return CrossEntropyLoss(x, target, opts...) },
+			"nll":           func(...core.Tensor) core.Tensor { return NLLLoss(x, target, opts...) },
+		} {
+			assert.Nil(t, core.GradCheck(fn, []core.Tensor{x}, core.GradCheckOptions{}), "%s, reduction %v", name, r)
+		}
+	}
+}
+
+func TestRegressionLoss(t *testing.T) {
+	x := core.NewTensor([]float64{1, 2, 3})
+	y := core.NewTensor([]float64{1, 0, 0})
+
+	assert.Nil(t, core.EqualFloatArray(MSELoss(x, y).Data(), []float64{13. / 3}, 1e-9))
+	assert.Nil(t, core.EqualFloatArray(MSELoss(x, y, WithReduction(Sum)).Data(), []float64{13}, 1e-9))
+	assert.Nil(t, core.EqualFloatArray(L1Loss(x, y, WithReduction(None)).Data(), []float64{0, 2, 3}, 1e-9))
+	assert.Nil(t, core.EqualFloatArray(HuberLoss(x, y, WithReduction(None)).Data(), []float64{0, 1.5, 2.5}, 1e-9))
+	assert.Nil(t, core.EqualFloatArray(HuberLoss(x, y, WithDelta(2), WithReduction(None)).Data(),
+		[]float64{0, 2, 4}, 1e-9))
+
+	assert.Panics(t, func() { MSELoss(x, core.Ones(2)) })
+	assert.Panics(t, func() { MSELoss(x, y, WithReduction(BatchMean)) })
+}
+
+func TestBCEWithLogitsLoss(t *testing.T) {
+	x := core.NewTensor([]float64{0, 2, -1000})
+	y := core.NewTensor([]float64{1, 0, 0})
+
+	ret := BCEWithLogitsLoss(x, y, WithReduction(None))
+	assert.Nil(t, core.EqualFloatArray(ret.Data(), []float64{math.Log(2), 2 + math.Log1p(math.Exp(-2)), 0}, 1e-9))
+
+	// the pos weight only scales the positive term
+	ret = BCEWithLogitsLoss(x, y, WithReduction(None), WithPosWeight(core.NewTensor([]float64{3})))
+	assert.Nil(t, core.EqualFloatArray(ret.Data(), []float64{3 * math.Log(2), 2 + math.Log1p(math.Exp(-2)), 0}, 1e-9))
+
+	// a weight per sample (N, 1) broadcast over the classes of an (N, C) input, not taken element by element
+	logits := core.NewTensor([][]float64{{0, 2}, {-1, 1}, {3, 0}}).SetRequiresGrad(true)
+	targets := core.NewTensor([][]float64{{1, 0}, {0, 1}, {1, 1}})
+	unweighted := BCEWithLogitsLoss(logits, targets, WithReduction(None)).Data()
+	ret = BCEWithLogitsLoss(logits, targets, WithReduction(None),
+		WithWeight(core.NewTensor([][]float64{{1}, {2}, {3}})))
+	expected := make([]float64, 6)
+	for i := range expected {
+		expected[i] = float64(i/2+1) * unweighted[i]
+	}
+	assert.Nil(t, core.EqualFloatArray(ret.Data(), expected, 1e-12))
+	ret.Backward()
+	// d/dx = w * (sigmoid(x) - y)
+	assert.InDelta(t, 3*(1/(1+math.Exp(-3))-1), logits.Grad()[4], 1e-12)
+	assert.Panics(t, func() { BCEWithLogitsLoss(logits, targets, WithWeight(core.Ones(2, 1))) })
+	assert.Panics(t, func() { BCEWithLogitsLoss(logits, targets, WithPosWeight(core.Ones(3))) })
+	assert.Panics(t, func() { BCEWithLogitsLoss(logits, targets, WithWeight(core.Ones(2, 3, 2))) })
+
+	// same as the binary cross entropy over sigmoid
+	ret = BCEWithLogitsLoss(core.NewTensor([]float64{0.5}), core.NewTensor([]float64{0.3}))
+	p := 1 / (1 + math.Exp(-0.5))
+	assert.Nil(t, core.EqualFloatArray(ret.Data(), []float64{-0.3*math.Log(p) - 0.7*math.Log(1-p)}, 1e-9))
+}
+
+func TestKLDivLoss(t *testing.T) {
+	input := core.NewTensor([][]float64{{math.Log(0.25), math.Log(0.75)}})
+	target := core.NewTensor([][]float64{{0.5, 0.5}})
+	expected := 0.5*math.Log(2) + 0.5*math.Log(0.5/0.75)
+
+	assert.Nil(t, core.EqualFloatArray(KLDivLoss(input, target, WithReduction(BatchMean)).Data(),
+		[]float64{expected}, 1e-9))
+	assert.Nil(t, core.EqualFloatArray(KLDivLoss(input, target).Data(), []float64{expected / 2}, 1e-9))
+	assert.Nil(t, core.EqualFloatArray(
+		KLDivLoss(input, core.NewTensor([][]float64{{math.Log(0.5), math.Log(0.5)}}), WithReduction(BatchMean),
+			WithLogTarget()).Data(), []float64{expected}, 1e-9))
+
+	// 0 * log(0) is 0
+	ret := KLDivLoss(input, core.NewTensor([][]float64{{0, 1}}), WithReduction(None))
+	assert.Nil(t, core.EqualFloatArray(ret.Data(), []float64{0, -math.Log(0.75)}, 1e-9))
+}
+
+func TestElementwiseGrad(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	x, y := core.RandnRNG(rng, 3, 4).SetRequiresGrad(true), core.RandnRNG(rng, 3, 4).SetRequiresGrad(true)
+	// probabilities for BCE and KLDiv
+	p := core.RandnRNG(rng, 3, 4).Exp()
+	p = p.DivS(util.Sum(p.Data())).Detach().SetRequiresGrad(true)
+
+	for _, r := range []Reduction{Mean, Sum, None} {
+		specs := []struct {
+			name   string
+			fn     func(...core.Tensor) core.Tensor
+			inputs []core.Tensor
+		}{
+			{"mse", func(...core.Tensor) core.Tensor { return MSELoss(x, y, WithReduction(r)) }, []core.Tensor{x, y}},
+			{"l1", func(...core.Tensor) core.Tensor { return L1Loss(x, y, WithReduction(r)) }, []core.Tensor{x, y}},
+			{"huber", func(...core.Tensor) core.Tensor {
+				return HuberLoss(x, y, WithReduction(r), WithDelta(0.5))
+			}, []core.Tensor{x, y}},
+			{"bce with logits", func(...core.Tensor) core.Tensor {
+				return BCEWithLogitsLoss(x, p, WithReduction(r), WithLabelSmoothing(0.1),
+					WithWeight(core.NewTensor([]float64{1, 2, 3, 4})), WithPosWeight(core.NewTensor([]float64{2, 1, 1, 0.5})))
+			}, []core.Tensor{x, p}},
+			{"kl div", func(...core.Tensor) core.Tensor { return KLDivLoss(x, p, WithReduction(r)) }, []core.Tensor{x, p}},
+			{"kl div log target", func(...core.Tensor) core.Tensor {
+				return KLDivLoss(x, y, WithReduction(r), WithLogTarget())
+			}, []core.Tensor{x, y}},
+		}
+		for _, spec := range specs {
+			assert.Nil(t, core.GradCheck(spec.fn, spec.inputs, core.GradCheckOptions{}), "%s, reduction %v", spec.name, r)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package loss
+
+import (
+	"dexianta/tgnn/core"
+	"dexianta/tgnn/util"
+	"fmt"
+	"math"
+)
+
+// MSELoss is the squared error (input - target)^2, input and target have the same shape
+func MSELoss(input, target core.Tensor, opts ...Option) core.Tensor {
+	return elementwise("mse_loss", input, target, newConfig(opts), func(i int, x, y float64) (l, dx, dy float64) {
+		d := x - y
+		return d * d, 2 * d, -2 * d
+	})
+}
+
+// L1Loss is the absolute error |input - target|, input and target have the same shape
+func L1Loss(input, target core.Tensor, opts ...Option) core.Tensor {
+	return elementwise("l1_loss", input, target, newConfig(opts), func(i int, x, y float64) (l, dx, dy float64) {
+		d := x - y
+		s := util.Sign(d)
+		return math.Abs(d), s, -s
+	})
+}
+
+// HuberLoss is quadratic for the errors smaller than delta (WithDelta, 1 by default), and linear beyond it:
+//
+//	0.5 * d^2                   if |d| <= delta
+//	delta * (|d| - 0.5 * delta) otherwise
+//
+// where d = input - target, so it is less sensitive to outliers than MSELoss
+func HuberLoss(input, target core.Tensor, opts ...Option) core.Tensor {
+	c := newConfig(opts)
+	return elementwise("huber_loss", input, target, c, func(i int, x, y float64) (l, dx, dy float64) {
+		d := x - y
+		if math.Abs(d) <= c.delta {
+			return 0.5 * d * d, d, -d
+		}
+		g := c.delta * util.Sign(d)
+		return c.delta * (math.Abs(d) - 0.5*c.delta), g, -g
+	})
+}
+
+// BCEWithLogitsLoss is the binary cross entropy over sigmoid(input), target is the probability of the positive class
+// it is computed from the logits directly, which is stable for large logits:
+//
+//	w * ((1 - y) * x + (1 + (pw - 1) * y) * log(1 + exp(-x)))
+//
+// the weight w (WithWeight) and pos weight pw (WithPosWeight, e.g. one per class) are broadcast to the shape of input
+// with WithLabelSmoothing(eps) the target is smoothed into y * (1 - eps) + eps / 2
+func BCEWithLogitsLoss(input, target core.Tensor, opts ...Option) core.Tensor {
+	c := newConfig(opts)
+	weightAt := func(w *core.Tensor) func(i int) float64 {
+		if w == nil {
+			return func(int) float64 { return 1 }
+		}
+		// materialized in the shape of input, which also checks the broadcasting
+		b := core.Zeros(input.Shape...).Add(*w)
+		if !b.Shape.Equal(input.Shape) {
+			panic(fmt.Sprintf("bce_with_logits: weight of shape %v cannot be broadcast to shape %v", w.Shape,
+				input.Shape))
+		}
+		data := b.Data()
+		return func(i int) float64 { return data[i] }
+	}
+	weight, posWeight := weightAt(c.weight), weightAt(c.posWeight)
+
+	eps := c.labelSmoothing
+	return elementwise("bce_with_logits", input, target, c, func(i int, x, y float64) (l, dx, dy float64) {
+		w, pw := weight(i), posWeight(i)
+		y = y*(1-eps) + eps/2
+		// log(1 + exp(-x)) = max(-x, 0) + log(1 + exp(-|x|))
+		softplus := math.Max(-x, 0) + math.Log1p(math.Exp(-math.Abs(x)))
+		k := 1 + (pw-1)*y
+		l = w * ((1-y)*x + k*softplus)
+		// d(log(1 + exp(-x)))/dx = -sigmoid(-x)
+		dx = w * ((1 - y) - k*util.Sigmoid(-x))
+		dy = w * (1 - eps) * (-x + (pw-1)*softplus)
+		return
+	})
+}
+
+// KLDivLoss is the Kullback-Leibler divergence between target and the distribution of input, as pytorch, input is the
+// log probabilities and target the probabilities (or the log probabilities WithLogTarget), the loss of an element is
+//
+//	target * (log(target) - input)
+//
+// the reduction BatchMean gives the actual KL divergence, Mean averages over all the elements instead
+func KLDivLoss(input, target core.Tensor, opts ...Option) core.Tensor {
+	c := newConfig(opts)
+	return elementwise("kl_div", input, target, c, func(i int, x, y float64) (l, dx, dy float64) {
+		if c.logTarget {
+			p := math.Exp(y)
+			return p * (y - x), -p, p * (y - x + 1)
+		}
+		if y <= 0 {
+			// 0 * log(0) is taken as 0
+			return 0, -y, 0
+		}
+		return y * (math.Log(y) - x), -y, math.Log(y) - x + 1
+	})
+}
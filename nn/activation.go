@@ -0,0 +1,118 @@
+package nn
+
+import (
+	"dexianta/tgnn/core"
+	"fmt"
+)
+
+// the modules without parameters, wrapping the functions of core so they can be chained in a Sequential, e.g.
+// &nn.ReLU{} or &nn.LeakyReLU{Slope: 0.01}
+
+// noParams implements the parameter related methods of Module for the modules without parameters
+type noParams struct{}
+
+func (noParams) Parameters() []core.Tensor         { return nil }
+func (noParams) NamedParameters() []NamedParameter { return nil }
+func (noParams) ZeroGrad()                         {}
+
+type ReLU struct {
+	mode
+	noParams
+}
+
+func (*ReLU) Forward(x core.Tensor) core.Tensor { return x.ReLu() }
+
+type LeakyReLU struct {
+	mode
+	noParams
+	Slope float64 // the slope of the negative part, pytorch uses 0.01
+}
+
+func (l *LeakyReLU) Forward(x core.Tensor) core.Tensor { return x.LeakyReLU(l.Slope) }
+func (l *LeakyReLU) String() string                    { return fmt.Sprintf("LeakyReLU(slope: %v)", l.Slope) }
+
+type ELU struct {
+	mode
+	noParams
+	Alpha float64 // pytorch uses 1
+}
+
+func (e *ELU) Forward(x core.Tensor) core.Tensor { return x.ELU(e.Alpha) }
+func (e *ELU) String() string                    { return fmt.Sprintf("ELU(alpha: %v)", e.Alpha) }
+
+type GELU struct {
+	mode
+	noParams
+}
+
+func (*GELU) Forward(x core.Tensor) core.Tensor { return x.GELU() }
+
+type SiLU struct {
+	mode
+	noParams
+}
+
+func (*SiLU) Forward(x core.Tensor) core.Tensor { return x.SiLU() }
+
+type Sigmoid struct {
+	mode
+	noParams
+}
+
+func (*Sigmoid) Forward(x core.Tensor) core.Tensor { return x.Sigmoid() }
+
+type Tanh struct {
+	mode
+	noParams
+}
+
+func (*Tanh) Forward(x core.Tensor) core.Tensor { return x.Tanh() }
+
+type Softplus struct {
+	mode
+	noParams
+}
+
+func (*Softplus) Forward(x core.Tensor) core.Tensor { return x.Softplus() }
+
+type Softsign struct {
+	mode
+	noParams
+}
+
+func (*Softsign) Forward(x core.Tensor) core.Tensor { return x.Softsign() }
+
+type HardTanh struct {
+	mode
+	noParams
+	Min, Max float64 // pytorch uses [-1, 1]
+}
+
+func (h *HardTanh) Forward(x core.Tensor) core.Tensor { return x.HardTanh(h.Min, h.Max) }
+func (h *HardTanh) String() string                    { return fmt.Sprintf("HardTanh(min: %v, max: %v)", h.Min, h.Max) }
+
+type Softmax struct {
+	mode
+	noParams
+	Dim int
+}
+
+func (s *Softmax) Forward(x core.Tensor) core.Tensor { return core.Softmax(x, s.Dim) }
+func (s *Softmax) String() string                    { return fmt.Sprintf("Softmax(dim: %d)", s.Dim) }
+
+type LogSoftmax struct {
+	mode
+	noParams
+	Dim int
+}
+
+func (s *LogSoftmax) Forward(x core.Tensor) core.Tensor { return core.LogSoftmax(x, s.Dim) }
+func (s *LogSoftmax) String() string                    { return fmt.Sprintf("LogSoftmax(dim: %d)", s.Dim) }
+
+// Flatten merges all the dims but the first one (the batch), e.g. (N, C, H, W) -> (N, C*H*W)
+type Flatten struct {
+	mode
+	noParams
+}
+
+func (*Flatten) Forward(x core.Tensor) core.Tensor { return x.Flatten(1, -1) }
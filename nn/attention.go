@@ -0,0 +1,324 @@
+package nn
+
+import (
+	"dexianta/tgnn/core"
+	"fmt"
+	"math"
+)
+
+// the attention layers run over sequences laid out as (seq, batch, embed) like the recurrent layers
+
+// Mask restricts the keys a query attends to, the zero value attends to all of them
+type Mask struct {
+	// Causal stops the i-th query from attending to the keys after i, for autoregressive models
+	Causal bool
+	// KeyPadding (batch, keys) marks the padded keys of every sequence with a non 0 value, they are ignored
+	KeyPadding core.Tensor
+}
+
+// additive turns the mask into a (batch, 1, queries, keys) tensor of 0 and -Inf, which is added to the attention
+// scores before the softmax, or into a zero tensor if nothing is masked
+// a query that can't attend to any key ends up with NaN weights, same as pytorch
+func (m Mask) additive(batch, queries, keys int) core.Tensor {
+	if !m.Causal && m.KeyPadding.Dim() == 0 {
+		return core.Tensor{}
+	}
+	var pad []float64
+	if m.KeyPadding.Dim() != 0 {
+		if !m.KeyPadding.Shape.Equal(core.Shape{batch, keys}) {
+			panic(fmt.Sprintf("attention: key padding mask shape %v doesn't match (%d, %d)", m.KeyPadding.Shape,
+				batch, keys))
+		}
+		pad = m.KeyPadding.Data()
+	}
+
+	ret := core.Zeros(batch, 1, queries, keys)
+	data := ret.Data()
+	for b := 0; b < batch; b++ {
+		for i := 0; i < queries; i++ {
+			for j := 0; j < keys; j++ {
+				if (m.Causal && j > i) || (pad != nil && pad[b*keys+j] != 0) {
+					data[(b*queries+i)*keys+j] = math.Inf(-1)
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// ScaledDotProductAttention computes softmax(q @ k^T / sqrt(d) + mask) @ v over the batched heads q (..., L, d),
+// k (..., S, d) and v (..., S, dv), mask is added to the scores of shape (..., L, S) and can be Tensor{} for none.
+// it returns the output (..., L, dv) and the attention weights (..., L, S)
+func ScaledDotProductAttention(q, k, v, mask core.Tensor) (out, weights core.Tensor) {
+	scores := q.Matmul(k.Transpose(-2, -1)).DivS(math.Sqrt(float64(q.Shape[q.Dim()-1])))
+	if mask.Dim() != 0 {
+		scores = scores.Add(mask)
+	}
+	weights = core.Softmax(scores, -1)
+	return weights.Matmul(v), weights
+}
+
+// MultiheadAttention projects the queries, keys and values into Heads heads of Embed/Heads features, attends with
+// each of them separately (see ScaledDotProductAttention), and projects the concatenated heads back into Embed
+type MultiheadAttention struct {
+	Embed, Heads int
+
+	Q, K, V, Out *Linear
+}
+
+// NewMultiheadAttention creates an attention layer, heads has to divide embed, it supports the options WithoutBias
+// and WithInit (XavierUniform by default) for the projections
+func NewMultiheadAttention(embed, heads int, opts ...Option) *MultiheadAttention {
+	opts = append([]Option{WithInit(XavierUniform)}, opts...)
+	if heads <= 0 || embed%heads != 0 {
+		panic(fmt.Sprintf("multihead attention: %d heads don't divide %d features", heads, embed))
+	}
+	return &MultiheadAttention{
+		Embed: embed,
+		Heads: heads,
+		Q:     NewLinear(embed, embed, opts...),
+		K:     NewLinear(embed, embed, opts...),
+		V:     NewLinear(embed, embed, opts...),
+		Out:   NewLinear(embed, embed, opts...),
+	}
+}
+
+// Forward is the self-attention of x (seq, batch, embed) without mask
+func (a *MultiheadAttention) Forward(x core.Tensor) core.Tensor {
+	out, _ := a.Attend(x, x, x, Mask{})
+	return out
+}
+
+// Attend attends the queries q (L, batch, embed) to the keys k (S, batch, embed) and the values v (S, batch, embed),
+// and returns the output (L, batch, embed) along with the attention weights averaged over the heads (batch, L, S)
+func (a *MultiheadAttention) Attend(q, k, v core.Tensor, mask Mask) (out, weights core.Tensor) {
+	for _, t := range []core.Tensor{q, k, v} {
+		if t.Dim() != 3 || t.Shape[2] != a.Embed {
+			panic(fmt.Sprintf("multihead attention: input shape %v doesn't match (seq, batch, %d)", t.Shape,
+				a.Embed))
+		}
+	}
+	if !k.Shape.Equal(v.Shape) || k.Shape[1] != q.Shape[1] {
+		panic(fmt.Sprintf("multihead attention: shapes of query %v, key %v and value %v don't match", q.Shape,
+			k.Shape, v.Shape))
+	}
+	l, batch, s := q.Shape[0], q.Shape[1], k.Shape[0]
+	d := a.Embed / a.Heads
+
+	// (seq, batch, embed) -> (batch, heads, seq, d)
+	heads := func(x core.Tensor, n int) core.Tensor {
+		return x.View(n, batch, a.Heads, d).Permute(1, 2, 0, 3)
+	}
+	out, weights = ScaledDotProductAttention(heads(a.Q.Forward(q), l), heads(a.K.Forward(k), s),
+		heads(a.V.Forward(v), s), mask.additive(batch, l, s))
+	// (batch, heads, L, d) -> (L, batch, embed)
+	out = out.Permute(2, 0, 1, 3).Reshape(l, batch, a.Embed)
+	return a.Out.Forward(out), weights.Mean(1, false)
+}
+
+func (a *MultiheadAttention) Children() []NamedModule {
+	return []NamedModule{{"q_proj", a.Q}, {"k_proj", a.K}, {"v_proj", a.V}, {"out_proj", a.Out}}
+}
+
+func (a *MultiheadAttention) Parameters() []core.Tensor { return Parameters(a.NamedParameters()) }
+func (a *MultiheadAttention) NamedParameters() []NamedParameter {
+	return NamedParametersOf(a.Children()...)
+}
+func (a *MultiheadAttention) Train()         { modulesOf(a.Children()).Train() }
+func (a *MultiheadAttention) Eval()          { modulesOf(a.Children()).Eval() }
+func (a *MultiheadAttention) Training() bool { return modulesOf(a.Children()).Training() }
+func (a *MultiheadAttention) ZeroGrad()      { ZeroGrad(a.Parameters()) }
+
+func (a *MultiheadAttention) String() string {
+	return fmt.Sprintf("MultiheadAttention(embed: %d, heads: %d)", a.Embed, a.Heads)
+}
+
+// modulesOf strips the names of children
+func modulesOf(children []NamedModule) ModuleList {
+	ret := make(ModuleList, len(children))
+	for i, c := range children {
+		ret[i] = c.Module
+	}
+	return ret
+}
+
+// WithDropout sets the dropout probability of TransformerEncoderLayer, 0.1 by default
+func WithDropout(p float64) Option {
+	return func(c *config) {
+		c.dropout = p
+	}
+}
+
+// WithNormFirst applies the layer norms of TransformerEncoderLayer before the attention and the feed forward
+// (pre-norm) instead of after the residual connections, which usually trains more stably
+func WithNormFirst() Option {
+	return func(c *config) {
+		c.normFirst = true
+	}
+}
+
+// TransformerEncoderLayer is a self-attention followed by a 2-layer feed forward network with relu, each of them
+// wrapped into a residual connection and a layer norm:
+//
+//	x = norm1(x + dropout(attn(x)))
+//	x = norm2(x + dropout(linear2(dropout(relu(linear1(x))))))
+//
+// with WithNormFirst the norms are applied on the input of each block instead: x = x + dropout(attn(norm1(x)))
+type TransformerEncoderLayer struct {
+	NormFirst bool
+
+	SelfAttn                    *MultiheadAttention
+	Linear1, Linear2            *Linear
+	Norm1, Norm2                *LayerNorm
+	Dropout, Dropout1, Dropout2 *Dropout
+}
+
+// NewTransformerEncoderLayer creates an encoder layer over embed features with a feed forward network of ff hidden
+// features, it supports the options WithDropout, WithNormFirst, WithSeed (for the dropouts) and WithEps (for the
+// norms)
+func NewTransformerEncoderLayer(embed, heads, ff int, opts ...Option) *TransformerEncoderLayer {
+	c := newConfig(opts)
+	dropout := func(k int64) *Dropout {
+		if c.seeded {
+			return NewDropout(c.dropout, WithSeed(c.seed+k))
+		}
+		return NewDropout(c.dropout)
+	}
+	return &TransformerEncoderLayer{
+		NormFirst: c.normFirst,
+		SelfAttn:  NewMultiheadAttention(embed, heads),
+		Linear1:   NewLinear(embed, ff),
+		Linear2:   NewLinear(ff, embed),
+		Norm1:     NewLayerNorm([]int{embed}, WithEps(c.eps)),
+		Norm2:     NewLayerNorm([]int{embed}, WithEps(c.eps)),
+		Dropout:   dropout(0),
+		Dropout1:  dropout(1),
+		Dropout2:  dropout(2),
+	}
+}
+
+func (e *TransformerEncoderLayer) Forward(x core.Tensor) core.Tensor {
+	return e.ForwardMask(x, Mask{})
+}
+
+// ForwardMask runs over x (seq, batch, embed) with the self-attention restricted by mask
+func (e *TransformerEncoderLayer) ForwardMask(x core.Tensor, mask Mask) core.Tensor {
+	attn := func(x core.Tensor) core.Tensor {
+		out, _ := e.SelfAttn.Attend(x, x, x, mask)
+		return e.Dropout1.Forward(out)
+	}
+	ff := func(x core.Tensor) core.Tensor {
+		return e.Dropout2.Forward(e.Linear2.Forward(e.Dropout.Forward(e.Linear1.Forward(x).ReLu())))
+	}
+	if e.NormFirst {
+		x = x.Add(attn(e.Norm1.Forward(x)))
+		return x.Add(ff(e.Norm2.Forward(x)))
+	}
+	x = e.Norm1.Forward(x.Add(attn(x)))
+	return e.Norm2.Forward(x.Add(ff(x)))
+}
+
+func (e *TransformerEncoderLayer) Children() []NamedModule {
+	return []NamedModule{
+		{"self_attn", e.SelfAttn},
+		{"linear1", e.Linear1},
+		{"dropout", e.Dropout},
+		{"linear2", e.Linear2},
+		{"norm1", e.Norm1},
+		{"norm2", e.Norm2},
+		{"dropout1", e.Dropout1},
+		{"dropout2", e.Dropout2},
+	}
+}
+
+func (e *TransformerEncoderLayer) Parameters() []core.Tensor { return Parameters(e.NamedParameters()) }
+func (e *TransformerEncoderLayer) NamedParameters() []NamedParameter {
+	return NamedParametersOf(e.Children()...)
+}
+func (e *TransformerEncoderLayer) Train()         { modulesOf(e.Children()).Train() }
+func (e *TransformerEncoderLayer) Eval()          { modulesOf(e.Children()).Eval() }
+func (e *TransformerEncoderLayer) Training() bool { return modulesOf(e.Children()).Training() }
+func (e *TransformerEncoderLayer) ZeroGrad()      { ZeroGrad(e.Parameters()) }
+
+func (e *TransformerEncoderLayer) String() string {
+	return containerString("TransformerEncoderLayer", modulesOf(e.Children()))
+}
+
+// SinusoidalPositionalEncoding adds the fixed encoding of "Attention Is All You Need" to x (seq, batch, Dim):
+//
+//	pe[pos][2i] = sin(pos / 10000^(2i/Dim)), pe[pos][2i+1] = cos(pos / 10000^(2i/Dim))
+//
+// the sequences can be up to MaxLen long
+type SinusoidalPositionalEncoding struct {
+	mode
+	noParams
+	MaxLen, Dim int
+
+	table core.Tensor // (MaxLen, 1, Dim)
+}
+
+func NewSinusoidalPositionalEncoding(maxLen, dim int) *SinusoidalPositionalEncoding {
+	table := core.Zeros(maxLen, 1, dim)
+	data := table.Data()
+	for pos := 0; pos < maxLen; pos++ {
+		for i := 0; i < dim; i += 2 {
+			angle := float64(pos) / math.Pow(10000, float64(i)/float64(dim))
+			data[pos*dim+i] = math.Sin(angle)
+			if i+1 < dim {
+				data[pos*dim+i+1] = math.Cos(angle)
+			}
+		}
+	}
+	return &SinusoidalPositionalEncoding{MaxLen: maxLen, Dim: dim, table: table}
+}
+
+func (p *SinusoidalPositionalEncoding) Forward(x core.Tensor) core.Tensor {
+	checkPositions("sinusoidal positional encoding", x, p.MaxLen, p.Dim)
+	return x.Add(p.table.SliceStep(0, 0, x.Shape[0], 1))
+}
+
+func (p *SinusoidalPositionalEncoding) String() string {
+	return fmt.Sprintf("SinusoidalPositionalEncoding(max len: %d, dim: %d)", p.MaxLen, p.Dim)
+}
+
+// LearnedPositionalEncoding adds a trained vector per position to x (seq, batch, Dim), the sequences can be up to
+// MaxLen long
+type LearnedPositionalEncoding struct {
+	mode
+	MaxLen, Dim int
+
+	Weight core.Tensor // (MaxLen, Dim), initialized from N(0, 1)
+}
+
+func NewLearnedPositionalEncoding(maxLen, dim int) *LearnedPositionalEncoding {
+	p := &LearnedPositionalEncoding{MaxLen: maxLen, Dim: dim, Weight: core.Zeros(maxLen, dim).SetRequiresGrad(true)}
+	Normal(p.Weight, 0, 1)
+	return p
+}
+
+func (p *LearnedPositionalEncoding) Forward(x core.Tensor) core.Tensor {
+	checkPositions("learned positional encoding", x, p.MaxLen, p.Dim)
+	return x.Add(p.Weight.SliceStep(0, 0, x.Shape[0], 1).Unsqueeze(1))
+}
+
+func (p *LearnedPositionalEncoding) Parameters() []core.Tensor {
+	return Parameters(p.NamedParameters())
+}
+
+func (p *LearnedPositionalEncoding) NamedParameters() []NamedParameter {
+	return []NamedParameter{{"weight", p.Weight}}
+}
+
+func (p *LearnedPositionalEncoding) ZeroGrad() {
+	ZeroGrad(p.Parameters())
+}
+
+func (p *LearnedPositionalEncoding) String() string {
+	return fmt.Sprintf("LearnedPositionalEncoding(max len: %d, dim: %d)", p.MaxLen, p.Dim)
+}
+
+func checkPositions(name string, x core.Tensor, maxLen, dim int) {
+	if x.Dim() != 3 || x.Shape[2] != dim || x.Shape[0] > maxLen {
+		panic(fmt.Sprintf("%s: input shape %v doesn't match (seq <= %d, batch, %d)", name, x.Shape, maxLen, dim))
+	}
+}
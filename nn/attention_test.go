@@ -0,0 +1,125 @@
+package nn
+
+import (
+	"dexianta/tgnn/core"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScaledDotProductAttention(t *testing.T) {
+	// the query matches the second key
+	q := core.NewTensor([][]float64{{0, 10}})
+	k := core.NewTensor([][]float64{{1, 0}, {0, 1}})
+	v := core.NewTensor([][]float64{{1, 2}, {3, 4}})
+	out, weights := ScaledDotProductAttention(q, k, v, core.Tensor{})
+	w := 1 / (1 + math.Exp(10/math.Sqrt(2)))
+	assert.Nil(t, core.EqualFloatArray(weights.Data(), []float64{w, 1 - w}, 1e-12))
+	assert.Nil(t, core.EqualFloatArray(out.Data(), []float64{w + 3*(1-w), 2*w + 4*(1-w)}, 1e-12))
+
+	// masking the second key leaves the first one only
+	mask := core.NewTensor([][]float64{{0, math.Inf(-1)}})
+	out, _ = ScaledDotProductAttention(q, k, v, mask)
+	assert.Nil(t, core.EqualFloatArray(out.Data(), []float64{1, 2}, 1e-12))
+}
+
+func TestMultiheadAttention(t *testing.T) {
+	a := NewMultiheadAttention(8, 2)
+	x := core.Randn(5, 3, 8)
+
+	out, weights := a.Attend(x, x, x, Mask{Causal: true})
+	assert.Equal(t, core.Shape{5, 3, 8}, out.Shape)
+	assert.Equal(t, core.Shape{3, 5, 5}, weights.Shape)
+	for _, s := range weights.Sum(-1, false).Data() {
+		assert.InDelta(t, 1, s, 1e-12)
+	}
+	// a query doesn't see the keys after it
+	assert.Equal(t, 0., weights.Index(0, 1).Index(0, 1).Data()[2])
+	changed := x.Detach().Contiguous()
+	changed.Data()[4*3*8] = 100 // the last step of the first sequence
+	other, _ := a.Attend(changed, changed, changed, Mask{Causal: true})
+	assert.True(t, out.SliceStep(0, 0, 4, 1).Equal(other.SliceStep(0, 0, 4, 1)))
+	assert.False(t, out.Equal(other))
+
+	// the padded keys are ignored, here the last 2 steps of the second sequence
+	pad := core.Zeros(3, 5)
+	copy(pad.Data()[5:], []float64{0, 0, 0, 1, 1})
+	out, weights = a.Attend(x, x, x, Mask{KeyPadding: pad})
+	assert.Nil(t, core.EqualFloatArray(weights.Index(0, 1).SliceStep(-1, 3, 5, 1).Contiguous().Data(),
+		make([]float64, 10), 0))
+	// cross attention: 2 queries over 5 keys
+	out, weights = a.Attend(x.SliceStep(0, 0, 2, 1), x, x, Mask{KeyPadding: pad})
+	assert.Equal(t, core.Shape{2, 3, 8}, out.Shape)
+	assert.Equal(t, core.Shape{3, 2, 5}, weights.Shape)
+
+	assert.Equal(t, []string{"q_proj.weight", "q_proj.bias", "k_proj.weight", "k_proj.bias", "v_proj.weight",
+		"v_proj.bias", "out_proj.weight", "out_proj.bias"}, names(a.NamedParameters()))
+	assert.Panics(t, func() { NewMultiheadAttention(8, 3) })
+	assert.Panics(t, func() { a.Forward(core.Ones(5, 3, 4)) })
+	assert.Panics(t, func() { a.Attend(x, x, x, Mask{KeyPadding: core.Zeros(5, 3)}) })
+
+	// gradients through the masks
+	xg := core.Randn(4, 2, 8).SetRequiresGrad(true)
+	c := core.Randn(4, 2, 8)
+	pad = core.NewTensor([][]float64{{0, 0, 0, 1}, {0, 0, 0, 0}})
+	fn := func(...core.Tensor) core.Tensor {
+		out, _ := a.Attend(xg, xg, xg, Mask{Causal: true, KeyPadding: pad})
+		return out.Mul(c)
+	}
+	assert.Nil(t, core.GradCheck(fn, append(a.Parameters(), xg), core.GradCheckOptions{}))
+}
+
+func TestTransformerEncoderLayer(t *testing.T) {
+	for _, normFirst := range []bool{false, true} {
+		opts := []Option{WithSeed(1)}
+		if normFirst {
+			opts = append(opts, WithNormFirst())
+		}
+		e := NewTransformerEncoderLayer(8, 2, 16, opts...)
+		x := core.Randn(5, 3, 8).SetRequiresGrad(true)
+
+		out := e.ForwardMask(x, Mask{Causal: true})
+		assert.Equal(t, core.Shape{5, 3, 8}, out.Shape)
+		out.SumAll().Backward()
+		for _, p := range e.NamedParameters() {
+			assert.NotEqual(t, make([]float64, p.Param.Shape.Cap()), p.Param.Grad(), p.Name)
+		}
+
+		// the dropouts are only active in training
+		assert.False(t, e.Forward(x).Equal(e.Forward(x)))
+		e.Eval()
+		assert.False(t, e.Dropout1.Training())
+		assert.True(t, e.Forward(x).Equal(e.Forward(x)))
+
+		c := core.Randn(5, 3, 8)
+		fn := func(...core.Tensor) core.Tensor { return e.ForwardMask(x, Mask{Causal: true}).Mul(c) }
+		assert.Nil(t, core.GradCheck(fn, append(e.Parameters()[:4], x), core.GradCheckOptions{}))
+	}
+
+	e := NewTransformerEncoderLayer(8, 2, 16)
+	assert.Len(t, e.Parameters(), 16)
+	assert.Equal(t, "self_attn.q_proj.weight", e.NamedParameters()[0].Name)
+	assert.Equal(t, "norm2.bias", e.NamedParameters()[15].Name)
+}
+
+func TestPositionalEncoding(t *testing.T) {
+	sin := NewSinusoidalPositionalEncoding(10, 4)
+	out := sin.Forward(core.Zeros(3, 2, 4))
+	assert.Equal(t, core.Shape{3, 2, 4}, out.Shape)
+	// every sequence of the batch gets the same encoding
+	assert.True(t, out.Index(1, 0).Equal(out.Index(1, 1)))
+	assert.Nil(t, core.EqualFloatArray(out.Index(0, 1).Index(0, 0).Data(),
+		[]float64{math.Sin(1), math.Cos(1), math.Sin(0.01), math.Cos(0.01)}, 1e-12))
+	assert.Empty(t, sin.Parameters())
+	assert.Panics(t, func() { sin.Forward(core.Zeros(11, 2, 4)) })
+
+	learned := NewLearnedPositionalEncoding(10, 4)
+	out = learned.Forward(core.Zeros(3, 2, 4))
+	assert.True(t, learned.Weight.SliceStep(0, 0, 3, 1).Equal(out.Index(1, 1)))
+	out.SumAll().Backward()
+	grad := learned.Weight.Grad()
+	assert.Nil(t, core.EqualFloatArray(grad[:12], []float64{2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2}, 0))
+	assert.Nil(t, core.EqualFloatArray(grad[12:], make([]float64, 28), 0))
+	assert.Panics(t, func() { learned.Forward(core.Zeros(3, 2, 5)) })
+}
@@ -0,0 +1,168 @@
+package nn
+
+import (
+	"dexianta/tgnn/core"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Container is a module made of submodules, which is how Walk finds them
+type Container interface {
+	Module
+	Children() []NamedModule
+}
+
+type NamedModule struct {
+	Name   string
+	Module Module
+}
+
+// Walk visits m and all of its submodules (depth first, parents before children) with their hierarchical names,
+// the name of m itself is "", e.g. switching off the bias gradient of all the linear layers:
+//
+//	nn.Walk(model, func(name string, m nn.Module) {
+//		if l, ok := m.(*nn.Linear); ok { ... }
+//	})
+func Walk(m Module, visit func(name string, m Module)) {
+	walk("", m, visit)
+}
+
+func walk(name string, m Module, visit func(name string, m Module)) {
+	visit(name, m)
+	c, ok := m.(Container)
+	if !ok {
+		return
+	}
+	for _, child := range c.Children() {
+		walk(joinName(name, child.Name), child.Module, visit)
+	}
+}
+
+func joinName(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// NamedParametersOf collects the parameters of children, prefixed with their names
+// it implements NamedParameters for a module made of submodules, e.g.
+//
+//	func (m *MLP) NamedParameters() []nn.NamedParameter {
+//		return nn.NamedParametersOf(m.Children()...)
+//	}
+func NamedParametersOf(children ...NamedModule) []NamedParameter {
+	var ret []NamedParameter
+	for _, c := range children {
+		for _, p := range c.Module.NamedParameters() {
+			ret = append(ret, NamedParameter{joinName(c.Name, p.Name), p.Param})
+		}
+	}
+	return ret
+}
+
+// ModuleList holds submodules named by their index, it is a Module itself so its parameters are visible to the
+// parent module. Forward chains the modules like Sequential, but a ModuleList is usually applied in a custom way,
+// e.g. the layers of an RNN
+type ModuleList []Module
+
+func (l ModuleList) Forward(x core.Tensor) core.Tensor {
+	for _, m := range l {
+		x = m.Forward(x)
+	}
+	return x
+}
+
+func (l ModuleList) Children() []NamedModule {
+	ret := make([]NamedModule, len(l))
+	for i, m := range l {
+		ret[i] = NamedModule{strconv.Itoa(i), m}
+	}
+	return ret
+}
+
+func (l ModuleList) Parameters() []core.Tensor {
+	return Parameters(l.NamedParameters())
+}
+
+func (l ModuleList) NamedParameters() []NamedParameter {
+	return NamedParametersOf(l.Children()...)
+}
+
+func (l ModuleList) Train() {
+	for _, m := range l {
+		m.Train()
+	}
+}
+
+func (l ModuleList) Eval() {
+	for _, m := range l {
+		m.Eval()
+	}
+}
+
+// Training tells if the modules are in training mode, an empty list is always in training mode
+func (l ModuleList) Training() bool {
+	for _, m := range l {
+		if !m.Training() {
+			return false
+		}
+	}
+	return true
+}
+
+func (l ModuleList) ZeroGrad() {
+	for _, m := range l {
+		m.ZeroGrad()
+	}
+}
+
+func (l ModuleList) String() string {
+	return containerString("ModuleList", l)
+}
+
+// Sequential chains the modules, the output of a module is the input of the next one, e.g. a MLP:
+//
+//	model := nn.Sequential{
+//		nn.NewLinear(784, 128),
+//		&nn.ReLU{},
+//		nn.NewLinear(128, 10),
+//	}
+//
+// the parameters are named by the index of the modules: "0.weight", "0.bias", "2.weight", "2.bias"
+type Sequential []Module
+
+func (s Sequential) Forward(x core.Tensor) core.Tensor { return ModuleList(s).Forward(x) }
+func (s Sequential) Children() []NamedModule           { return ModuleList(s).Children() }
+func (s Sequential) Parameters() []core.Tensor         { return ModuleList(s).Parameters() }
+func (s Sequential) NamedParameters() []NamedParameter { return ModuleList(s).NamedParameters() }
+func (s Sequential) Train()                            { ModuleList(s).Train() }
+func (s Sequential) Eval()                             { ModuleList(s).Eval() }
+func (s Sequential) Training() bool                    { return ModuleList(s).Training() }
+func (s Sequential) ZeroGrad()                         { ModuleList(s).ZeroGrad() }
+
+func (s Sequential) String() string {
+	return containerString("Sequential", s)
+}
+
+// containerString prints the submodules one per line, indented by their depth
+func containerString(name string, modules []Module) string {
+	var sb strings.Builder
+	sb.WriteString(name + "(\n")
+	for i, m := range modules {
+		child := moduleString(m)
+		sb.WriteString(fmt.Sprintf("  (%d): %s\n", i, strings.ReplaceAll(child, "\n", "\n  ")))
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+// moduleString is the String of m, or its type name (e.g. ReLU) if it isn't a fmt.Stringer
+func moduleString(m Module) string {
+	if s, ok := m.(fmt.Stringer); ok {
+		return s.String()
+	}
+	name := fmt.Sprintf("%T", m)
+	return name[strings.LastIndex(name, ".")+1:]
+}
@@ -0,0 +1,115 @@
+package nn
+
+import (
+	"dexianta/tgnn/core"
+	"dexianta/tgnn/loss"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mlp is a custom module made of submodules
+type mlp struct {
+	hidden *Linear
+	layers ModuleList
+}
+
+func newMLP() *mlp {
+	return &mlp{
+		hidden: NewLinear(2, 8),
+		layers: ModuleList{&Tanh{}, NewLinear(8, 1)},
+	}
+}
+
+func (m *mlp) Forward(x core.Tensor) core.Tensor { return m.layers.Forward(m.hidden.Forward(x)) }
+func (m *mlp) Children() []NamedModule {
+	return []NamedModule{{"hidden", m.hidden}, {"layers", m.layers}}
+}
+func (m *mlp) Parameters() []core.Tensor         { return Parameters(m.NamedParameters()) }
+func (m *mlp) NamedParameters() []NamedParameter { return NamedParametersOf(m.Children()...) }
+func (m *mlp) Train()                            { m.hidden.Train(); m.layers.Train() }
+func (m *mlp) Eval()                             { m.hidden.Eval(); m.layers.Eval() }
+func (m *mlp) Training() bool                    { return m.hidden.Training() }
+func (m *mlp) ZeroGrad()                         { ZeroGrad(m.Parameters()) }
+
+func names(ps []NamedParameter) (ret []string) {
+	for _, p := range ps {
+		ret = append(ret, p.Name)
+	}
+	return
+}
+
+func TestSequential(t *testing.T) {
+	model := Sequential{
+		NewLinear(4, 3),
+		&ReLU{},
+		NewLinear(3, 2, WithoutBias()),
+		Sequential{&Tanh{}, NewLinear(2, 2)},
+	}
+
+	assert.Equal(t, core.Shape{5, 2}, model.Forward(core.Randn(5, 4)).Shape)
+	assert.Equal(t, []string{"0.weight", "0.bias", "2.weight", "3.1.weight", "3.1.bias"},
+		names(model.NamedParameters()))
+	assert.Len(t, model.Parameters(), 5)
+
+	// the parameters are the ones of the layers
+	assert.Equal(t, &model[0].(*Linear).Weight.Data()[0], &model.Parameters()[0].Data()[0])
+
+	model.Eval()
+	assert.False(t, model.Training())
+	assert.False(t, model[3].(Sequential)[0].Training())
+	model.Train()
+	assert.True(t, model.Training())
+
+	assert.Equal(t, `Sequential(
+  (0): Linear(in: 4, out: 3, bias: true)
+  (1): ReLU
+  (2): Linear(in: 3, out: 2, bias: false)
+  (3): Sequential(
+    (0): Tanh
+    (1): Linear(in: 2, out: 2, bias: true)
+  )
+)`, model.String())
+}
+
+func TestWalk(t *testing.T) {
+	m := newMLP()
+	var visited []string
+	Walk(m, func(name string, m Module) {
+		visited = append(visited, name+":"+moduleString(m))
+	})
+	assert.Equal(t, []string{
+		":mlp",
+		"hidden:Linear(in: 2, out: 8, bias: true)",
+		"layers:ModuleList(\n  (0): Tanh\n  (1): Linear(in: 8, out: 1, bias: true)\n)",
+		"layers.0:Tanh",
+		"layers.1:Linear(in: 8, out: 1, bias: true)",
+	}, visited)
+	assert.Equal(t, []string{"hidden.weight", "hidden.bias", "layers.1.weight", "layers.1.bias"},
+		names(m.NamedParameters()))
+}
+
+func TestMLPXor(t *testing.T) {
+	var model Module = newMLP()
+	x := core.NewTensor([][]float64{{0, 0}, {0, 1}, {1, 0}, {1, 1}})
+	y := core.NewTensor([][]float64{{0}, {1}, {1}, {0}})
+
+	var first, last float64
+	for i := 0; i < 500; i++ {
+		l := loss.MSELoss(model.Forward(x), y)
+		l.Backward()
+		for _, p := range model.Parameters() {
+			data, grad := p.Data(), p.Grad()
+			for j := range data {
+				data[j] -= 0.1 * grad[j]
+			}
+		}
+		model.ZeroGrad()
+
+		if i == 0 {
+			first = l.Data()[0]
+		}
+		last = l.Data()[0]
+	}
+	assert.Less(t, last, first/10)
+}
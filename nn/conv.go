@@ -0,0 +1,164 @@
+package nn
+
+import (
+	"dexianta/tgnn/core"
+	"fmt"
+)
+
+// WithStride sets the stride of Conv2d, 1 by default
+func WithStride(s int) Option {
+	return func(c *config) {
+		c.stride = s
+	}
+}
+
+// WithPadding sets the zero padding on every side of the input of Conv2d, 0 by default
+func WithPadding(p int) Option {
+	return func(c *config) {
+		c.padding = p
+	}
+}
+
+// WithDilation sets the spacing between the elements of the kernel of Conv2d, 1 by default
+func WithDilation(d int) Option {
+	return func(c *config) {
+		c.dilation = d
+	}
+}
+
+// WithGroups splits the channels of Conv2d into groups convolved separately, 1 by default
+// e.g. groups == in channels is a depthwise convolution
+func WithGroups(g int) Option {
+	return func(c *config) {
+		c.groups = g
+	}
+}
+
+// Conv2d is the 2d convolution over NCHW images, see core.Conv2d
+type Conv2d struct {
+	mode
+	In, Out, Kernel           int
+	Stride, Padding, Dilation int
+	Groups                    int
+
+	Weight core.Tensor // (out, in/groups, kernel, kernel)
+	Bias   core.Tensor // (out), Dim() == 0 without bias
+}
+
+// NewConv2d creates a convolution with a square kernel, it supports the options WithStride, WithPadding,
+// WithDilation, WithGroups, WithoutBias and WithInit
+func NewConv2d(in, out, kernel int, opts ...Option) *Conv2d {
+	c := newConfig(opts)
+	if c.groups <= 0 || in%c.groups != 0 || out%c.groups != 0 {
+		panic(fmt.Sprintf("conv2d: %d groups don't divide %d in and %d out channels", c.groups, in, out))
+	}
+
+	conv := &Conv2d{
+		In:       in,
+		Out:      out,
+		Kernel:   kernel,
+		Stride:   c.stride,
+		Padding:  c.padding,
+		Dilation: c.dilation,
+		Groups:   c.groups,
+		Weight:   core.Zeros(out, in/c.groups, kernel, kernel).SetRequiresGrad(true),
+	}
+	fields := kernel * kernel
+	c.init(conv.Weight, in/c.groups*fields, out/c.groups*fields)
+	if !c.noBias {
+		conv.Bias = core.Zeros(out).SetRequiresGrad(true)
+	}
+	return conv
+}
+
+func (c *Conv2d) hasBias() bool {
+	return c.Bias.Dim() != 0
+}
+
+func (c *Conv2d) Forward(x core.Tensor) core.Tensor {
+	if x.Dim() != 4 || x.Shape[1] != c.In {
+		panic(fmt.Sprintf("conv2d: input shape %v doesn't match (N, %d, H, W)", x.Shape, c.In))
+	}
+	var bias core.Tensor
+	if c.hasBias() {
+		bias = c.Bias
+	}
+	return core.Conv2d(x, c.Weight, bias, [2]int{c.Stride, c.Stride}, [2]int{c.Padding, c.Padding},
+		[2]int{c.Dilation, c.Dilation}, c.Groups)
+}
+
+func (c *Conv2d) Parameters() []core.Tensor {
+	return Parameters(c.NamedParameters())
+}
+
+func (c *Conv2d) NamedParameters() []NamedParameter {
+	ret := []NamedParameter{{"weight", c.Weight}}
+	if c.hasBias() {
+		ret = append(ret, NamedParameter{"bias", c.Bias})
+	}
+	return ret
+}
+
+func (c *Conv2d) ZeroGrad() {
+	ZeroGrad(c.Parameters())
+}
+
+func (c *Conv2d) String() string {
+	return fmt.Sprintf("Conv2d(in: %d, out: %d, kernel: %d, stride: %d, padding: %d, dilation: %d, groups: %d, "+
+		"bias: %v)", c.In, c.Out, c.Kernel, c.Stride, c.Padding, c.Dilation, c.Groups, c.hasBias())
+}
+
+// poolArgs are the arguments of a square window for core, stride 0 means the same as the kernel (pytorch's default)
+func poolArgs(kernel, stride, padding int) ([2]int, [2]int, [2]int) {
+	if stride == 0 {
+		stride = kernel
+	}
+	return [2]int{kernel, kernel}, [2]int{stride, stride}, [2]int{padding, padding}
+}
+
+// MaxPool2d takes the max of the windows, e.g. &nn.MaxPool2d{Kernel: 2} halves the height and width
+type MaxPool2d struct {
+	mode
+	noParams
+	Kernel, Stride, Padding int // Stride is Kernel if 0
+}
+
+func (m *MaxPool2d) Forward(x core.Tensor) core.Tensor {
+	kernel, stride, padding := poolArgs(m.Kernel, m.Stride, m.Padding)
+	return core.MaxPool2d(x, kernel, stride, padding)
+}
+
+func (m *MaxPool2d) String() string {
+	return fmt.Sprintf("MaxPool2d(kernel: %d, stride: %d, padding: %d)", m.Kernel, m.Stride, m.Padding)
+}
+
+// AvgPool2d takes the mean of the windows
+type AvgPool2d struct {
+	mode
+	noParams
+	Kernel, Stride, Padding int // Stride is Kernel if 0
+}
+
+func (a *AvgPool2d) Forward(x core.Tensor) core.Tensor {
+	kernel, stride, padding := poolArgs(a.Kernel, a.Stride, a.Padding)
+	return core.AvgPool2d(x, kernel, stride, padding)
+}
+
+func (a *AvgPool2d) String() string {
+	return fmt.Sprintf("AvgPool2d(kernel: %d, stride: %d, padding: %d)", a.Kernel, a.Stride, a.Padding)
+}
+
+// AdaptiveAvgPool2d averages the input into (H, W) whatever its size is, e.g. {H: 1, W: 1} is a global average pool
+type AdaptiveAvgPool2d struct {
+	mode
+	noParams
+	H, W int
+}
+
+func (a *AdaptiveAvgPool2d) Forward(x core.Tensor) core.Tensor {
+	return core.AdaptiveAvgPool2d(x, a.H, a.W)
+}
+
+func (a *AdaptiveAvgPool2d) String() string {
+	return fmt.Sprintf("AdaptiveAvgPool2d(h: %d, w: %d)", a.H, a.W)
+}
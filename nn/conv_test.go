@@ -0,0 +1,49 @@
+package nn
+
+import (
+	"dexianta/tgnn/core"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConv2d(t *testing.T) {
+	conv := NewConv2d(4, 6, 3, WithStride(2), WithPadding(1), WithGroups(2))
+	assert.Equal(t, core.Shape{6, 2, 3, 3}, conv.Weight.Shape)
+	assert.Equal(t, []string{"weight", "bias"}, names(conv.NamedParameters()))
+	assert.Equal(t, core.Shape{2, 6, 4, 3}, conv.Forward(core.Randn(2, 4, 8, 5)).Shape)
+	assert.Panics(t, func() { conv.Forward(core.Randn(2, 3, 8, 5)) })
+	assert.Panics(t, func() { NewConv2d(4, 6, 3, WithGroups(4)) })
+
+	// the same as core.Conv2d
+	x := core.Randn(1, 4, 5, 5)
+	expected := core.Conv2d(x, conv.Weight, conv.Bias, [2]int{2, 2}, [2]int{1, 1}, [2]int{1, 1}, 2)
+	assert.True(t, expected.Equal(conv.Forward(x)))
+
+	noBias := NewConv2d(1, 2, 2, WithoutBias(), WithDilation(2))
+	assert.Len(t, noBias.Parameters(), 1)
+	assert.Equal(t, core.Shape{1, 2, 3, 3}, noBias.Forward(core.Ones(1, 1, 5, 5)).Shape)
+}
+
+func TestLeNet(t *testing.T) {
+	model := Sequential{
+		NewConv2d(1, 6, 5, WithPadding(2)), // (N, 6, 28, 28)
+		&ReLU{},
+		&MaxPool2d{Kernel: 2}, // (N, 6, 14, 14)
+		NewConv2d(6, 16, 5),   // (N, 16, 10, 10)
+		&ReLU{},
+		&AvgPool2d{Kernel: 2}, // (N, 16, 5, 5)
+		&AdaptiveAvgPool2d{H: 2, W: 2},
+		&Flatten{},
+		NewLinear(64, 10),
+	}
+	out := model.Forward(core.Randn(3, 1, 28, 28))
+	assert.Equal(t, core.Shape{3, 10}, out.Shape)
+
+	out.Backward()
+	for _, p := range model.NamedParameters() {
+		assert.NotEqual(t, make([]float64, p.Param.Shape.Cap()), p.Param.Grad(), p.Name)
+	}
+	assert.Equal(t, []string{"0.weight", "0.bias", "3.weight", "3.bias", "8.weight", "8.bias"},
+		names(model.NamedParameters()))
+}
@@ -0,0 +1,150 @@
+package nn
+
+import (
+	"dexianta/tgnn/core"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// WithSeed seeds the random generator of a stochastic layer, so that its masks are reproducible
+// without it the generator is seeded from the global math/rand
+func WithSeed(seed int64) Option {
+	return func(c *config) {
+		c.seed = seed
+		c.seeded = true
+	}
+}
+
+// dropout holds the drop probability and the random generator of the dropout layers
+// they're only active in training mode, in evaluation mode they return the input as is
+type dropout struct {
+	mode
+	noParams
+	name string
+	P    float64 // the probability of dropping an element
+	rng  *rand.Rand
+}
+
+func newDropout(name string, p float64, opts []Option) dropout {
+	if p < 0 || p > 1 {
+		panic(fmt.Sprintf("%s: probability %v is not in [0, 1]", name, p))
+	}
+	c := newConfig(opts)
+	seed := c.seed
+	if !c.seeded {
+		seed = rand.Int63()
+	}
+	return dropout{name: name, P: p, rng: rand.New(rand.NewSource(seed))}
+}
+
+// Seed resets the random generator, the following masks are the same as the ones of a layer created WithSeed(seed)
+func (d *dropout) Seed(seed int64) {
+	d.rng = rand.New(rand.NewSource(seed))
+}
+
+func (d *dropout) active() bool {
+	return d.Training() && d.P > 0
+}
+
+// mask draws a tensor of shape where every element is kept with the probability 1 - P, the kept elements are
+// set to keep and the dropped ones to drop
+func (d *dropout) mask(shape core.Shape, keep, drop float64) core.Tensor {
+	ret := core.Zeros(shape...)
+	data := ret.Data()
+	for i := range data {
+		if d.rng.Float64() < d.P {
+			data[i] = drop
+		} else {
+			data[i] = keep
+		}
+	}
+	return ret
+}
+
+// scale is the inverted scaling of the kept elements 1 / (1 - P), which keeps the expectation of the output the same
+// as the input, so nothing needs to be scaled in evaluation mode
+func (d *dropout) scale() float64 {
+	if d.P == 1 {
+		return 0
+	}
+	return 1 / (1 - d.P)
+}
+
+func (d *dropout) String() string {
+	return fmt.Sprintf("%s(p: %v)", d.name, d.P)
+}
+
+// Dropout zeroes every element of the input with the probability P in training mode, and scales the others by
+// 1 / (1 - P)
+type Dropout struct {
+	dropout
+}
+
+// NewDropout creates a dropout with the probability p, it supports the option WithSeed
+func NewDropout(p float64, opts ...Option) *Dropout {
+	return &Dropout{newDropout("Dropout", p, opts)}
+}
+
+func (d *Dropout) Forward(x core.Tensor) core.Tensor {
+	if !d.active() {
+		return x
+	}
+	return x.Mul(d.mask(x.Shape, d.scale(), 0))
+}
+
+// Dropout2d zeroes whole channels of (N, C, H, W) images with the probability P in training mode, and scales the
+// others by 1 / (1 - P). it suits convolutions, where the neighbouring elements of a channel are strongly correlated
+type Dropout2d struct {
+	dropout
+}
+
+// NewDropout2d creates a channel dropout with the probability p, it supports the option WithSeed
+func NewDropout2d(p float64, opts ...Option) *Dropout2d {
+	return &Dropout2d{newDropout("Dropout2d", p, opts)}
+}
+
+func (d *Dropout2d) Forward(x core.Tensor) core.Tensor {
+	if x.Dim() != 4 {
+		panic(fmt.Sprintf("dropout2d expects a NCHW input of 4 dims, got shape %v", x.Shape))
+	}
+	if !d.active() {
+		return x
+	}
+	return x.Mul(d.mask(core.Shape{x.Shape[0], x.Shape[1], 1, 1}, d.scale(), 0))
+}
+
+// selu's saturation value -scale * alpha, what the dropped elements of AlphaDropout are set to
+const seluSaturation = -1.0507009873554805 * 1.6732632423543772
+
+// AlphaDropout is the dropout of self-normalizing networks (selu activations): in training mode the dropped elements
+// are set to the negative saturation of selu instead of 0, then the output is shifted and scaled back to the mean and
+// variance of the input, assuming they're 0 and 1
+type AlphaDropout struct {
+	dropout
+}
+
+// NewAlphaDropout creates an alpha dropout with the probability p, it supports the option WithSeed
+func NewAlphaDropout(p float64, opts ...Option) *AlphaDropout {
+	return &AlphaDropout{newDropout("AlphaDropout", p, opts)}
+}
+
+func (d *AlphaDropout) Forward(x core.Tensor) core.Tensor {
+	if !d.active() {
+		return x
+	}
+	if d.P == 1 {
+		return x.MulS(0)
+	}
+	// out = a * (x * keep + saturation * (1 - keep)) + b
+	a := 1 / math.Sqrt((1-d.P)*(1+d.P*seluSaturation*seluSaturation))
+	b := -a * seluSaturation * d.P
+	keep := d.mask(x.Shape, 1, 0)
+	shift := core.Zeros(x.Shape...)
+	kd, sd := keep.Data(), shift.Data()
+	for i := range kd {
+		sd[i] = a*seluSaturation*(1-kd[i]) + b
+		kd[i] *= a
+	}
+	return x.Mul(keep).Add(shift)
+}
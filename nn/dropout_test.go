@@ -0,0 +1,79 @@
+package nn
+
+import (
+	"dexianta/tgnn/core"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDropout(t *testing.T) {
+	d := NewDropout(0.25, WithSeed(1))
+	x := core.Ones(100, 100).SetRequiresGrad(true)
+	out := d.Forward(x)
+
+	// the kept elements are scaled so the mean stays the same
+	var dropped int
+	for _, v := range out.Data() {
+		if v == 0 {
+			dropped++
+		} else {
+			assert.InDelta(t, 4./3, v, 1e-12)
+		}
+	}
+	assert.InDelta(t, 2500, dropped, 200)
+	assert.InDelta(t, 1, out.MeanAll().Data()[0], 0.05)
+
+	// the gradient goes through the kept elements only
+	out.SumAll().Backward()
+	assert.Equal(t, out.Data(), x.Grad())
+
+	// the same seed gives the same masks
+	assert.True(t, out.Equal(NewDropout(0.25, WithSeed(1)).Forward(x)))
+	assert.False(t, out.Equal(d.Forward(x)))
+	d.Seed(1)
+	assert.True(t, out.Equal(d.Forward(x)))
+
+	d.Eval()
+	assert.True(t, x.Equal(d.Forward(x)))
+	assert.True(t, core.Zeros(2, 2).Equal(NewDropout(1).Forward(core.Ones(2, 2))))
+	assert.Panics(t, func() { NewDropout(1.5) })
+	assert.Equal(t, "Dropout(p: 0.25)", d.String())
+}
+
+func TestDropout2d(t *testing.T) {
+	d := NewDropout2d(0.5, WithSeed(2))
+	out := d.Forward(core.Ones(8, 16, 3, 3))
+
+	// a channel is either dropped or kept as a whole
+	data := out.Data()
+	var dropped int
+	for c := 0; c < 8*16; c++ {
+		channel := data[c*9 : (c+1)*9]
+		for _, v := range channel {
+			assert.Equal(t, channel[0], v)
+		}
+		if channel[0] == 0 {
+			dropped++
+		} else {
+			assert.Equal(t, 2., channel[0])
+		}
+	}
+	assert.InDelta(t, 64, dropped, 20)
+	assert.Panics(t, func() { d.Forward(core.Ones(2, 3)) })
+}
+
+func TestAlphaDropout(t *testing.T) {
+	d := NewAlphaDropout(0.2, WithSeed(3))
+	x := core.RandnRNG(rand.New(rand.NewSource(1)), 200, 200)
+	out := d.Forward(x)
+
+	// the mean and the variance of a standard normal input are kept
+	assert.InDelta(t, 0, out.MeanAll().Data()[0], 0.03)
+	assert.InDelta(t, 1, out.Reshape(-1).Var(0, false, false).Data()[0], 0.03)
+	assert.True(t, out.Equal(NewAlphaDropout(0.2, WithSeed(3)).Forward(x)))
+
+	d.Eval()
+	assert.True(t, x.Equal(d.Forward(x)))
+}
@@ -0,0 +1,113 @@
+package nn
+
+import (
+	"dexianta/tgnn/core"
+	"fmt"
+	"math"
+)
+
+// WithPaddingIdx sets the padding entry of Embedding, its row is initialized to 0 and never trained, so padded
+// positions of a sequence are looked up as 0. a negative index counts from the end
+func WithPaddingIdx(i int) Option {
+	return func(c *config) {
+		c.paddingIdx = &i
+	}
+}
+
+// WithMaxNorm makes Embedding renormalize the rows it looks up to have at most the euclidean norm n
+func WithMaxNorm(n float64) Option {
+	return func(c *config) {
+		c.maxNorm = n
+	}
+}
+
+// Embedding is a lookup table of Num vectors of size Dim, its input is a tensor of integer indices of any shape,
+// e.g. (seq, batch) tokens are embedded into (seq, batch, dim)
+// the gradient of Weight is sparse (see core.Embedding), it only holds the rows looked up since the last ZeroGrad
+type Embedding struct {
+	mode
+	Num, Dim   int
+	PaddingIdx int     // -1 for none
+	MaxNorm    float64 // 0 for none
+
+	Weight core.Tensor // (num, dim), initialized from N(0, 1)
+}
+
+// NewEmbedding creates an embedding, it supports the options WithPaddingIdx, WithMaxNorm and WithInit
+// (the default is N(0, 1) rather than KaimingUniform)
+func NewEmbedding(num, dim int, opts ...Option) *Embedding {
+	c := newConfig(append([]Option{WithInit(func(t core.Tensor, fanIn, fanOut int) { Normal(t, 0, 1) })},
+		opts...))
+	e := &Embedding{
+		Num:        num,
+		Dim:        dim,
+		PaddingIdx: -1,
+		MaxNorm:    c.maxNorm,
+		Weight:     core.Zeros(num, dim).SetRequiresGrad(true),
+	}
+	c.init(e.Weight, num, dim)
+	if c.paddingIdx != nil {
+		e.PaddingIdx = *c.paddingIdx
+		if e.PaddingIdx < 0 {
+			e.PaddingIdx += num
+		}
+		if e.PaddingIdx < 0 || e.PaddingIdx >= num {
+			panic(fmt.Sprintf("embedding: padding index %d is out of range for %d entries", *c.paddingIdx, num))
+		}
+		row := e.Weight.Data()[e.PaddingIdx*dim : (e.PaddingIdx+1)*dim]
+		for i := range row {
+			row[i] = 0
+		}
+	}
+	return e
+}
+
+func (e *Embedding) Forward(x core.Tensor) core.Tensor {
+	if e.MaxNorm > 0 {
+		e.renorm(x)
+	}
+	return core.Embedding(e.Weight, x, e.PaddingIdx)
+}
+
+// renorm scales the rows looked up by x down to MaxNorm in place, it's not part of the computation graph
+func (e *Embedding) renorm(x core.Tensor) {
+	data := e.Weight.Data()
+	for _, v := range x.Data() {
+		i := int(v)
+		if i < 0 {
+			i += e.Num
+		}
+		if i < 0 || i >= e.Num {
+			continue // reported by the lookup
+		}
+		row := data[i*e.Dim : (i+1)*e.Dim]
+		var norm float64
+		for _, w := range row {
+			norm += w * w
+		}
+		if norm = math.Sqrt(norm); norm > e.MaxNorm {
+			// the same small margin as pytorch, so the norm ends up just under MaxNorm
+			scale := e.MaxNorm / (norm + 1e-7)
+			for j := range row {
+				row[j] *= scale
+			}
+		}
+	}
+}
+
+func (e *Embedding) Parameters() []core.Tensor {
+	return Parameters(e.NamedParameters())
+}
+
+func (e *Embedding) NamedParameters() []NamedParameter {
+	return []NamedParameter{{"weight", e.Weight}}
+}
+
+func (e *Embedding) ZeroGrad() {
+	ZeroGrad(e.Parameters())
+}
+
+func (e *Embedding) String() string {
+	return fmt.Sprintf("Embedding(num: %d, dim: %d, padding: %d, max norm: %v)", e.Num, e.Dim, e.PaddingIdx,
+		e.MaxNorm)
+}
@@ -0,0 +1,45 @@
+package nn
+
+import (
+	"dexianta/tgnn/core"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbedding(t *testing.T) {
+	e := NewEmbedding(10, 3, WithPaddingIdx(-1))
+	assert.Equal(t, 9, e.PaddingIdx)
+	tokens := core.NewTensor([][]float64{{1, 9}, {4, 1}, {9, 9}}) // (seq, batch)
+
+	out := e.Forward(tokens)
+	assert.Equal(t, core.Shape{3, 2, 3}, out.Shape)
+	assert.True(t, core.Zeros(3).Equal(out.Index(0, 0).Index(0, 1)))
+
+	// the padding gets no gradient, the gradient is sparse
+	out.Backward()
+	rows, ok := e.Weight.SparseGrad()
+	assert.True(t, ok)
+	assert.Equal(t, []int{1, 4}, rows)
+	assert.Nil(t, core.EqualFloatArray(e.Weight.Grad()[3:6], []float64{2, 2, 2}, 0))
+	assert.Nil(t, core.EqualFloatArray(e.Weight.Grad()[27:], []float64{0, 0, 0}, 0))
+
+	assert.Equal(t, []string{"weight"}, names(e.NamedParameters()))
+	assert.Panics(t, func() { e.Forward(core.NewTensor([]float64{10})) })
+	assert.Panics(t, func() { NewEmbedding(3, 2, WithPaddingIdx(3)) })
+	assert.Equal(t, "Embedding(num: 10, dim: 3, padding: 9, max norm: 0)", e.String())
+}
+
+func TestEmbeddingMaxNorm(t *testing.T) {
+	e := NewEmbedding(3, 2, WithMaxNorm(1), WithInit(func(w core.Tensor, fanIn, fanOut int) {
+		copy(w.Data(), []float64{3, 4, 0.3, 0.4, 6, 8})
+	}))
+
+	// the rows looked up are renormalized in place, the others are left as is
+	out := e.Forward(core.NewTensor([]float64{0, 1}))
+	assert.Nil(t, core.EqualFloatArray(out.Data(), []float64{0.6, 0.8, 0.3, 0.4}, 1e-6))
+	assert.Nil(t, core.EqualFloatArray(e.Weight.Data(), []float64{0.6, 0.8, 0.3, 0.4, 6, 8}, 1e-6))
+	row := e.Weight.Data()[:2]
+	assert.LessOrEqual(t, math.Hypot(row[0], row[1]), 1.)
+}
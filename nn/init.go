@@ -0,0 +1,59 @@
+package nn
+
+import (
+	"dexianta/tgnn/core"
+	"math"
+	"math/rand"
+)
+
+// Init fills a parameter in place, from the number of its inputs and outputs
+// e.g. a Linear(in, out) has fanIn = in and fanOut = out
+type Init func(t core.Tensor, fanIn, fanOut int)
+
+// KaimingUniform (He) initialization for relu networks, keeps the variance of the activations through the layers:
+// U(-bound, bound) with bound = sqrt(6 / fanIn)
+func KaimingUniform(t core.Tensor, fanIn, fanOut int) {
+	bound := math.Sqrt(6 / float64(fanIn))
+	Uniform(t, -bound, bound)
+}
+
+// KaimingNormal (He) initialization for relu networks: N(0, 2 / fanIn)
+func KaimingNormal(t core.Tensor, fanIn, fanOut int) {
+	Normal(t, 0, math.Sqrt(2/float64(fanIn)))
+}
+
+// XavierUniform (Glorot) initialization for tanh and sigmoid networks, keeps the variance of both the activations and
+// the gradients: U(-bound, bound) with bound = sqrt(6 / (fanIn + fanOut))
+func XavierUniform(t core.Tensor, fanIn, fanOut int) {
+	bound := math.Sqrt(6 / float64(fanIn+fanOut))
+	Uniform(t, -bound, bound)
+}
+
+// XavierNormal (Glorot) initialization: N(0, 2 / (fanIn + fanOut))
+func XavierNormal(t core.Tensor, fanIn, fanOut int) {
+	Normal(t, 0, math.Sqrt(2/float64(fanIn+fanOut)))
+}
+
+// Uniform fills t with values drawn from U(lo, hi)
+func Uniform(t core.Tensor, lo, hi float64) {
+	data := t.Data()
+	for i := range data {
+		data[i] = lo + rand.Float64()*(hi-lo)
+	}
+}
+
+// Normal fills t with values drawn from N(mean, std^2)
+func Normal(t core.Tensor, mean, std float64) {
+	data := t.Data()
+	for i := range data {
+		data[i] = mean + rand.NormFloat64()*std
+	}
+}
+
+// Constant fills t with v
+func Constant(t core.Tensor, v float64) {
+	data := t.Data()
+	for i := range data {
+		data[i] = v
+	}
+}
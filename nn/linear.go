@@ -0,0 +1,68 @@
+package nn
+
+import (
+	"dexianta/tgnn/core"
+	"fmt"
+)
+
+// Linear is the fully connected layer y = x @ Weight + Bias
+// Weight has the shape (in, out), so the input is multiplied without a transpose (unlike pytorch's (out, in)), and
+// x can be of any shape (..., in)
+type Linear struct {
+	mode
+	In, Out int
+
+	Weight core.Tensor
+	Bias   core.Tensor // a (out) tensor, Dim() == 0 without bias
+}
+
+// NewLinear creates a linear layer, it supports the options WithoutBias and WithInit
+func NewLinear(in, out int, opts ...Option) *Linear {
+	c := newConfig(opts)
+
+	l := &Linear{
+		In:     in,
+		Out:    out,
+		Weight: core.Zeros(in, out).SetRequiresGrad(true),
+	}
+	c.init(l.Weight, in, out)
+	if !c.noBias {
+		l.Bias = core.Zeros(out).SetRequiresGrad(true)
+	}
+	return l
+}
+
+func (l *Linear) hasBias() bool {
+	return l.Bias.Dim() != 0
+}
+
+func (l *Linear) Forward(x core.Tensor) core.Tensor {
+	if x.Dim() == 0 || x.Shape[x.Dim()-1] != l.In {
+		panic(fmt.Sprintf("linear: input shape %v doesn't match %d input features", x.Shape, l.In))
+	}
+	ret := x.Matmul(l.Weight)
+	if l.hasBias() {
+		ret = ret.Add(l.Bias)
+	}
+	return ret
+}
+
+func (l *Linear) Parameters() []core.Tensor {
+	return Parameters(l.NamedParameters())
+}
+
+func (l *Linear) NamedParameters() []NamedParameter {
+	ret := []NamedParameter{{"weight", l.Weight}}
+	if l.hasBias() {
+		ret = append(ret, NamedParameter{"bias", l.Bias})
+	}
+	return ret
+}
+
+func (l *Linear) ZeroGrad() {
+	ZeroGrad(l.Parameters())
+}
+
+func (l *Linear) String() string {
+	return fmt.Sprintf("Linear(in: %d, out: %d, bias: %v)", l.In, l.Out, l.hasBias())
+}
@@ -0,0 +1,73 @@
+package nn
+
+import (
+	"dexianta/tgnn/core"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinear(t *testing.T) {
+	var l Module = NewLinear(3, 2)
+	lin := l.(*Linear)
+	copy(lin.Weight.Data(), []float64{1, 2, 3, 4, 5, 6})
+	copy(lin.Bias.Data(), []float64{10, 20})
+
+	x := core.NewTensor([][]float64{{1, 0, 0}, {1, 1, 1}})
+	out := l.Forward(x)
+	assert.True(t, core.NewTensor([][]float64{{11, 22}, {19, 32}}).Equal(out))
+
+	// any leading dims
+	assert.Equal(t, core.Shape{4, 5, 2}, l.Forward(core.Ones(4, 5, 3)).Shape)
+	assert.Panics(t, func() { l.Forward(core.Ones(2, 4)) })
+
+	out.Backward()
+	assert.Nil(t, core.EqualFloatArray(lin.Weight.Grad(), []float64{2, 2, 1, 1, 1, 1}, 0))
+	assert.Nil(t, core.EqualFloatArray(lin.Bias.Grad(), []float64{2, 2}, 0))
+
+	l.ZeroGrad()
+	for _, p := range l.Parameters() {
+		assert.Nil(t, core.EqualFloatArray(p.Grad(), make([]float64, p.Shape.Cap()), 0))
+	}
+
+	assert.True(t, l.Training())
+	l.Eval()
+	assert.False(t, l.Training())
+	l.Train()
+	assert.True(t, l.Training())
+}
+
+func TestLinearWithoutBias(t *testing.T) {
+	l := NewLinear(3, 2, WithoutBias(), WithInit(func(w core.Tensor, fanIn, fanOut int) {
+		assert.Equal(t, 3, fanIn)
+		assert.Equal(t, 2, fanOut)
+		Constant(w, 1)
+	}))
+	assert.Len(t, l.Parameters(), 1)
+	assert.True(t, core.NewTensor([]float64{6, 6}).Equal(l.Forward(core.NewTensor([]float64{1, 2, 3}))))
+	assert.Equal(t, "Linear(in: 3, out: 2, bias: false)", l.String())
+}
+
+func TestInit(t *testing.T) {
+	const fanIn, fanOut = 400, 200
+	specs := []struct {
+		name string
+		init Init
+		std  float64
+	}{
+		{"kaiming uniform", KaimingUniform, math.Sqrt(2. / fanIn)},
+		{"kaiming normal", KaimingNormal, math.Sqrt(2. / fanIn)},
+		{"xavier uniform", XavierUniform, math.Sqrt(2. / (fanIn + fanOut))},
+		{"xavier normal", XavierNormal, math.Sqrt(2. / (fanIn + fanOut))},
+	}
+
+	for _, spec := range specs {
+		t.Run(spec.name, func(t *testing.T) {
+			w := core.Zeros(fanIn, fanOut)
+			spec.init(w, fanIn, fanOut)
+			std := w.Reshape(-1).Std(0, false, false).Data()[0]
+			assert.InDelta(t, spec.std, std, spec.std*0.05)
+		})
+	}
+}
@@ -1,47 +1,125 @@
+// Package nn contains the building blocks of neural networks over core.Tensor, following the semantic of torch.nn
 package nn
 
 import (
 	"dexianta/tgnn/core"
-	"math/rand"
 )
 
-// Neuron is smallest unit in a neural network, which can be represented as follows
-// `activation_function(sum(x1w1, x2w2, xnwn) + b)`
-// core activation_function are:
-// - sigmod
-// - relu
-// - etc
-type Neuron struct {
-	input int
-	ws    []*core.V
-	b     *core.V
-}
-
-func NewNeuron(ninput int) Neuron {
-	n := Neuron{
-		input: ninput,
-		ws:    make([]*core.V, ninput),
-		b:     core.Vx(0.),
+// Module is a layer (or a whole network) holding trainable parameters, e.g.
+//
+//	model := nn.NewLinear(784, 10)
+//	out := model.Forward(x)
+//	...
+//	for _, p := range model.Parameters() { /* update p.Data() with p.Grad() */ }
+//	model.ZeroGrad()
+type Module interface {
+	Forward(x core.Tensor) core.Tensor
+	// Parameters returns the trainable tensors, they share the storage with the module so updating their data in
+	// place updates the module
+	Parameters() []core.Tensor
+	// NamedParameters returns the same tensors as Parameters with their names, the parameters of a submodule are
+	// prefixed with the name of the submodule, e.g. "0.weight" is the weight of the first layer of a Sequential
+	NamedParameters() []NamedParameter
+
+	// Train and Eval switch the mode of the module, some layers behave differently in evaluation (e.g. dropout)
+	// a module is in training mode after being created
+	Train()
+	Eval()
+	Training() bool
+
+	// ZeroGrad resets the gradients of all the parameters
+	ZeroGrad()
+}
+
+// Option configures a layer, each layer documents the options it supports
+type Option func(*config)
+
+type config struct {
+	noBias   bool
+	init     Init
+	stride   int
+	padding  int
+	dilation int
+	groups   int
+
+	numLayers     int
+	bidirectional bool
+	relu          bool
+
+	eps      float64
+	momentum float64
+	noAffine bool
+
+	seed   int64
+	seeded bool
+
+	paddingIdx *int
+	maxNorm    float64
+
+	dropout   float64
+	normFirst bool
+}
+
+func newConfig(opts []Option) config {
+	c := config{
+		init:     KaimingUniform,
+		stride:   1,
+		dilation: 1,
+		groups:   1,
+
+		numLayers: 1,
+
+		eps:      1e-5,
+		momentum: 0.1,
+
+		dropout: 0.1,
+	}
+	for _, o := range opts {
+		o(&c)
+	}
+	return c
+}
+
+// WithoutBias creates a layer without the bias term, e.g. when it's followed by a normalization layer
+func WithoutBias() Option {
+	return func(c *config) {
+		c.noBias = true
 	}
+}
 
-	// initialize random weight value (-1, 1)
-	for i := range n.ws {
-		n.ws[i] = core.Vx(rand.Float64()*2. - 1.)
+// WithInit sets the initialization of the weight, KaimingUniform by default, the bias is always initialized to 0
+func WithInit(init Init) Option {
+	return func(c *config) {
+		c.init = init
 	}
-	return n
 }
 
-type Layer struct {
-	neurons []Neuron
+type NamedParameter struct {
+	Name  string
+	Param core.Tensor
+}
+
+// mode implements Train, Eval and Training for the modules without submodules
+type mode struct {
+	eval bool // the zero value is training mode
 }
 
-func NewLayer(inputSize, outputSize int) Layer {
-	var neurons = make([]Neuron, outputSize)
-	for i := 0; i < outputSize; i++ {
-		neurons[i] = NewNeuron(inputSize)
+func (m *mode) Train()         { m.eval = false }
+func (m *mode) Eval()          { m.eval = true }
+func (m *mode) Training() bool { return !m.eval }
+
+// ZeroGrad resets the gradients of params
+func ZeroGrad(params []core.Tensor) {
+	for _, p := range params {
+		p.ZeroGrad()
 	}
+}
 
-	return Layer{
-		neurons: neurons,
+// Parameters strips the names of named
+func Parameters(named []NamedParameter) []core.Tensor {
+	ret := make([]core.Tensor, len(named))
+	for i := range named {
+		ret[i] = named[i].Param
 	}
+	return ret
 }
@@ -0,0 +1,58 @@
+package nn
+
+import (
+	"dexianta/tgnn/core"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// every layer with its parameters and a seeded input, the inputs of the kinked activations and of max pool land on
+// their kinks (or ties) with probability 0
+func TestGradCheckLayers(t *testing.T) {
+	specs := []struct {
+		name  string
+		m     Module
+		input []int // the shape of the input, nil for the embedding which takes indices
+	}{
+		{"linear", NewLinear(3, 2), []int{4, 3}},
+		{"conv2d", NewConv2d(4, 2, 3, WithStride(2), WithPadding(1), WithDilation(1), WithGroups(2)),
+			[]int{2, 4, 5, 5}},
+		{"max pool", &MaxPool2d{Kernel: 2, Padding: 1}, []int{1, 2, 5, 5}},
+		{"avg pool", &AvgPool2d{Kernel: 3, Stride: 2}, []int{1, 2, 5, 5}},
+		{"adaptive avg pool", &AdaptiveAvgPool2d{H: 2, W: 3}, []int{1, 2, 5, 5}},
+		{"flatten", &Flatten{}, []int{2, 3, 2}},
+		{"relu", &ReLU{}, []int{3, 4}},
+		{"leaky relu", &LeakyReLU{Slope: 0.1}, []int{3, 4}},
+		{"elu", &ELU{Alpha: 1}, []int{3, 4}},
+		{"gelu", &GELU{}, []int{3, 4}},
+		{"silu", &SiLU{}, []int{3, 4}},
+		{"sigmoid", &Sigmoid{}, []int{3, 4}},
+		{"tanh", &Tanh{}, []int{3, 4}},
+		{"softplus", &Softplus{}, []int{3, 4}},
+		{"softsign", &Softsign{}, []int{3, 4}},
+		{"hard tanh", &HardTanh{Min: -0.5, Max: 0.5}, []int{3, 4}},
+		{"softmax", &Softmax{Dim: 1}, []int{3, 4}},
+		{"log softmax", &LogSoftmax{Dim: 0}, []int{3, 4}},
+		{"rnn cell", NewRNNCell(3, 4), []int{2, 3}},
+		{"lstm cell", NewLSTMCell(3, 4), []int{2, 3}},
+		{"gru cell", NewGRUCell(3, 4), []int{2, 3}},
+		{"rnn", NewRNN(3, 2, WithNumLayers(2), WithReLU()), []int{3, 2, 3}},
+		{"lstm", NewLSTM(3, 2, WithBidirectional()), []int{3, 2, 3}},
+		{"multihead attention", NewMultiheadAttention(4, 2), []int{3, 2, 4}},
+		{"sinusoidal positional encoding", NewSinusoidalPositionalEncoding(5, 4), []int{3, 2, 4}},
+		{"learned positional encoding", NewLearnedPositionalEncoding(5, 4), []int{3, 2, 4}},
+		{"embedding", NewEmbedding(5, 3), nil},
+	}
+	for _, spec := range specs {
+		t.Run(spec.name, func(t *testing.T) {
+			x := core.NewTensor([][]float64{{1, 4}, {0, 1}})
+			if spec.input != nil {
+				x = core.RandnRNG(rand.New(rand.NewSource(1)), spec.input...).SetRequiresGrad(true)
+			}
+			fn := func(...core.Tensor) core.Tensor { return spec.m.Forward(x) }
+			assert.Nil(t, core.GradCheck(fn, append(spec.m.Parameters(), x), core.GradCheckOptions{}))
+		})
+	}
+}
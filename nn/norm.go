@@ -0,0 +1,248 @@
+package nn
+
+import (
+	"dexianta/tgnn/core"
+	"fmt"
+)
+
+// the normalization layers standardize their input with core.Normalize, then scale and shift it with the learned
+// Weight and Bias (the affine params, initialized to 1 and 0)
+
+// WithEps sets the value added to the variance for numerical stability, 1e-5 by default
+func WithEps(eps float64) Option {
+	return func(c *config) {
+		c.eps = eps
+	}
+}
+
+// WithMomentum sets how fast the running stats of batch norm follow the stats of the batches, 0.1 by default:
+// running = (1 - momentum) * running + momentum * batch
+func WithMomentum(m float64) Option {
+	return func(c *config) {
+		c.momentum = m
+	}
+}
+
+// WithoutAffine creates a normalization layer without the learned Weight and Bias
+func WithoutAffine() Option {
+	return func(c *config) {
+		c.noAffine = true
+	}
+}
+
+// affine holds the learned scale and shift of the normalization layers
+type affine struct {
+	Weight core.Tensor // Dim() == 0 without affine
+	Bias   core.Tensor
+}
+
+func newAffine(c config, shape ...int) affine {
+	if c.noAffine {
+		return affine{}
+	}
+	return affine{
+		Weight: core.Ones(shape...).SetRequiresGrad(true),
+		Bias:   core.Zeros(shape...).SetRequiresGrad(true),
+	}
+}
+
+func (a *affine) hasAffine() bool {
+	return a.Weight.Dim() != 0
+}
+
+// apply scales and shifts x, the params are reshaped into shape to broadcast over x
+func (a *affine) apply(x core.Tensor, shape ...int) core.Tensor {
+	if !a.hasAffine() {
+		return x
+	}
+	return x.Mul(a.Weight.Reshape(shape...)).Add(a.Bias.Reshape(shape...))
+}
+
+func (a *affine) Parameters() []core.Tensor {
+	return Parameters(a.NamedParameters())
+}
+
+func (a *affine) NamedParameters() []NamedParameter {
+	if !a.hasAffine() {
+		return nil
+	}
+	return []NamedParameter{{"weight", a.Weight}, {"bias", a.Bias}}
+}
+
+func (a *affine) ZeroGrad() {
+	ZeroGrad(a.Parameters())
+}
+
+// channels is the shape (c, 1, ..., 1) of dims dims, which broadcasts a per channel tensor over the trailing dims
+func channels(c, dims int) []int {
+	ret := make([]int, dims)
+	for i := range ret {
+		ret[i] = 1
+	}
+	ret[0] = c
+	return ret
+}
+
+// batchNorm normalizes every channel (dim 1) over the batch and all the other dims
+// in training mode it uses the stats of the batch and updates the running stats, in evaluation mode it uses the
+// running stats, so the output of a sample doesn't depend on the rest of the batch
+type batchNorm struct {
+	mode
+	affine
+	name          string
+	dims          []int // the accepted number of dims of the input
+	Features      int
+	Eps, Momentum float64
+
+	// the running stats, they aren't trained so they're not in Parameters
+	RunningMean core.Tensor // (features), initialized to 0
+	RunningVar  core.Tensor // (features), initialized to 1, it's the unbiased variance like pytorch
+}
+
+func newBatchNorm(name string, dims []int, features int, opts []Option) batchNorm {
+	c := newConfig(opts)
+	return batchNorm{
+		affine:      newAffine(c, features),
+		name:        name,
+		dims:        dims,
+		Features:    features,
+		Eps:         c.eps,
+		Momentum:    c.momentum,
+		RunningMean: core.Zeros(features),
+		RunningVar:  core.Ones(features),
+	}
+}
+
+func (b *batchNorm) Forward(x core.Tensor) core.Tensor {
+	valid := false
+	for _, d := range b.dims {
+		valid = valid || x.Dim() == d
+	}
+	if !valid || x.Shape[1] != b.Features {
+		panic(fmt.Sprintf("%s: input shape %v doesn't match %d features with %v dims", b.name, x.Shape,
+			b.Features, b.dims))
+	}
+
+	// channels first: (C, N, ...)
+	xt := x.Transpose(0, 1)
+	shape := channels(b.Features, x.Dim())
+	var y core.Tensor
+	if b.Training() {
+		n := x.Shape.Cap() / b.Features
+		if n <= 1 {
+			panic(fmt.Sprintf("%s: expects more than 1 value per channel in training, got shape %v", b.name,
+				x.Shape))
+		}
+		var mean, variance core.Tensor
+		y, mean, variance = core.Normalize(xt, 1, b.Eps)
+
+		rm, rv := b.RunningMean.Data(), b.RunningVar.Data()
+		mv, vv := mean.Data(), variance.Data()
+		for i := range rm {
+			rm[i] = (1-b.Momentum)*rm[i] + b.Momentum*mv[i]
+			rv[i] = (1-b.Momentum)*rv[i] + b.Momentum*vv[i]*float64(n)/float64(n-1)
+		}
+	} else {
+		std := b.RunningVar.AddS(b.Eps).Sqrt()
+		y = xt.Sub(b.RunningMean.Reshape(shape...)).Div(std.Reshape(shape...))
+	}
+	return b.apply(y, shape...).Transpose(0, 1)
+}
+
+func (b *batchNorm) String() string {
+	return fmt.Sprintf("%s(features: %d, eps: %v, momentum: %v, affine: %v)", b.name, b.Features, b.Eps, b.Momentum,
+		b.hasAffine())
+}
+
+// BatchNorm1d is the batch norm over (N, C) or (N, C, L) inputs, the stats are per channel C
+type BatchNorm1d struct {
+	batchNorm
+}
+
+// NewBatchNorm1d creates a batch norm over features channels, it supports the options WithEps, WithMomentum and
+// WithoutAffine
+func NewBatchNorm1d(features int, opts ...Option) *BatchNorm1d {
+	return &BatchNorm1d{newBatchNorm("BatchNorm1d", []int{2, 3}, features, opts)}
+}
+
+// BatchNorm2d is the batch norm over (N, C, H, W) images, the stats are per channel C
+type BatchNorm2d struct {
+	batchNorm
+}
+
+// NewBatchNorm2d creates a batch norm over features channels, it supports the options WithEps, WithMomentum and
+// WithoutAffine
+func NewBatchNorm2d(features int, opts ...Option) *BatchNorm2d {
+	return &BatchNorm2d{newBatchNorm("BatchNorm2d", []int{4}, features, opts)}
+}
+
+// LayerNorm normalizes every sample over its trailing dims Shape, e.g. the embedding of every token of a
+// (seq, batch, embed) input with Shape (embed). the affine params have the shape Shape, so they're per element
+// it behaves the same in training and evaluation mode
+type LayerNorm struct {
+	mode
+	affine
+	Shape core.Shape
+	Eps   float64
+}
+
+// NewLayerNorm creates a layer norm over the trailing dims shape, it supports the options WithEps and WithoutAffine
+func NewLayerNorm(shape []int, opts ...Option) *LayerNorm {
+	c := newConfig(opts)
+	return &LayerNorm{
+		affine: newAffine(c, shape...),
+		Shape:  append(core.Shape{}, shape...),
+		Eps:    c.eps,
+	}
+}
+
+func (l *LayerNorm) Forward(x core.Tensor) core.Tensor {
+	start := x.Dim() - len(l.Shape)
+	if start < 0 || !x.Shape[start:].Equal(l.Shape) {
+		panic(fmt.Sprintf("layer norm: input shape %v doesn't end with %v", x.Shape, l.Shape))
+	}
+	y, _, _ := core.Normalize(x, start, l.Eps)
+	return l.apply(y, l.Shape...)
+}
+
+func (l *LayerNorm) String() string {
+	return fmt.Sprintf("LayerNorm(shape: %v, eps: %v, affine: %v)", l.Shape, l.Eps, l.hasAffine())
+}
+
+// GroupNorm splits the channels of a (N, C, ...) input into groups, and normalizes every group of every sample over
+// its channels and all the other dims. the affine params are per channel
+// it doesn't depend on the batch, so it works with small batches where batch norm doesn't
+type GroupNorm struct {
+	mode
+	affine
+	Groups, Channels int
+	Eps              float64
+}
+
+// NewGroupNorm creates a group norm, groups has to divide channels, it supports the options WithEps and
+// WithoutAffine
+func NewGroupNorm(groups, channels int, opts ...Option) *GroupNorm {
+	if groups <= 0 || channels%groups != 0 {
+		panic(fmt.Sprintf("group norm: %d groups don't divide %d channels", groups, channels))
+	}
+	c := newConfig(opts)
+	return &GroupNorm{
+		affine:   newAffine(c, channels),
+		Groups:   groups,
+		Channels: channels,
+		Eps:      c.eps,
+	}
+}
+
+func (g *GroupNorm) Forward(x core.Tensor) core.Tensor {
+	if x.Dim() < 2 || x.Shape[1] != g.Channels {
+		panic(fmt.Sprintf("group norm: input shape %v doesn't match (N, %d, ...)", x.Shape, g.Channels))
+	}
+	y, _, _ := core.Normalize(x.Reshape(x.Shape[0], g.Groups, -1), 2, g.Eps)
+	return g.apply(y.View(x.Shape...), channels(g.Channels, x.Dim()-1)...)
+}
+
+func (g *GroupNorm) String() string {
+	return fmt.Sprintf("GroupNorm(groups: %d, channels: %d, eps: %v, affine: %v)", g.Groups, g.Channels, g.Eps,
+		g.hasAffine())
+}
@@ -0,0 +1,91 @@
+package nn
+
+import (
+	"dexianta/tgnn/core"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchNorm(t *testing.T) {
+	bn := NewBatchNorm1d(2, WithEps(0))
+	x := core.NewTensor([][]float64{{1, 10}, {3, 10}, {5, 40}})
+	s := math.Sqrt(8. / 3)
+	out := bn.Forward(x)
+	assert.Nil(t, core.EqualFloatArray(out.Data(), []float64{-2 / s, -1 / math.Sqrt(2), 0, -1 / math.Sqrt(2),
+		2 / s, math.Sqrt(2)}, 1e-12))
+
+	// the running stats move towards the stats of the batch, the variance is unbiased
+	assert.Nil(t, core.EqualFloatArray(bn.RunningMean.Data(), []float64{0.3, 2}, 1e-12))
+	assert.Nil(t, core.EqualFloatArray(bn.RunningVar.Data(), []float64{0.9 + 0.1*4, 0.9 + 0.1*300}, 1e-12))
+
+	// evaluation uses the running stats
+	bn.Eval()
+	copy(bn.RunningMean.Data(), []float64{1, 2})
+	copy(bn.RunningVar.Data(), []float64{4, 16})
+	copy(bn.Weight.Data(), []float64{2, 1})
+	assert.Nil(t, core.EqualFloatArray(bn.Forward(x).Data(), []float64{0, 2, 2, 2, 4, 9.5}, 1e-12))
+	assert.Nil(t, core.EqualFloatArray(bn.RunningMean.Data(), []float64{1, 2}, 0))
+	// a single sample is fine in evaluation, but not in training
+	assert.Equal(t, core.Shape{1, 2}, bn.Forward(core.Ones(1, 2)).Shape)
+	bn.Train()
+	assert.Panics(t, func() { bn.Forward(core.Ones(1, 2)) })
+
+	assert.Equal(t, core.Shape{4, 2, 3}, bn.Forward(core.Randn(4, 2, 3)).Shape)
+	assert.Panics(t, func() { bn.Forward(core.Ones(4, 3)) })
+	assert.Panics(t, func() { bn.Forward(core.Ones(4, 2, 3, 3)) })
+	assert.Equal(t, []string{"weight", "bias"}, names(bn.NamedParameters()))
+	assert.Empty(t, NewBatchNorm2d(3, WithoutAffine()).Parameters())
+	assert.Equal(t, "BatchNorm2d(features: 3, eps: 1e-05, momentum: 0.1, affine: true)", NewBatchNorm2d(3).String())
+}
+
+func TestLayerGroupNorm(t *testing.T) {
+	ln := NewLayerNorm([]int{3}, WithEps(0))
+	x := core.NewTensor([][]float64{{1, 2, 3}, {0, 0, 6}})
+	s := math.Sqrt(2. / 3)
+	assert.Nil(t, core.EqualFloatArray(ln.Forward(x).Data(), []float64{-1 / s, 0, 1 / s, -1 / math.Sqrt(2),
+		-1 / math.Sqrt(2), math.Sqrt(2)}, 1e-12))
+	assert.Equal(t, core.Shape{3}, ln.Weight.Shape)
+	assert.Panics(t, func() { ln.Forward(core.Ones(3, 2)) })
+
+	// group norm with a group per channel normalizes every channel of every sample
+	gn := NewGroupNorm(2, 2, WithEps(0))
+	img := core.NewTensor([][][][]float64{{{{1, 3}}, {{0, 4}}}})
+	assert.Nil(t, core.EqualFloatArray(gn.Forward(img).Data(), []float64{-1, 1, -1, 1}, 1e-12))
+	// a single group normalizes the whole sample like a layer norm
+	gn = NewGroupNorm(1, 2, WithEps(0), WithoutAffine())
+	expected := NewLayerNorm([]int{2, 1, 2}, WithEps(0)).Forward(img)
+	assert.True(t, expected.Equal(gn.Forward(img)))
+	assert.Panics(t, func() { NewGroupNorm(3, 4) })
+	assert.Panics(t, func() { gn.Forward(core.Ones(1, 3, 2)) })
+}
+
+func TestNormGrad(t *testing.T) {
+	specs := []struct {
+		name  string
+		m     Module
+		shape []int
+	}{
+		{"batch norm 1d", NewBatchNorm1d(3), []int{4, 3}},
+		{"batch norm 1d with length", NewBatchNorm1d(2), []int{3, 2, 4}},
+		{"batch norm 2d", NewBatchNorm2d(2), []int{2, 2, 3, 3}},
+		{"layer norm", NewLayerNorm([]int{2, 3}), []int{4, 2, 3}},
+		{"group norm", NewGroupNorm(2, 4), []int{2, 4, 3}},
+	}
+	for _, spec := range specs {
+		t.Run(spec.name, func(t *testing.T) {
+			for _, p := range spec.m.Parameters() {
+				Normal(p, 1, 0.5)
+			}
+			x := core.Randn(spec.shape...).SetRequiresGrad(true)
+			// a random weighting, the gradient of the plain sum of a normalized tensor is 0
+			w := core.Randn(spec.shape...)
+			fn := func(...core.Tensor) core.Tensor { return spec.m.Forward(x).Mul(w).Pow(2) }
+			assert.Nil(t, core.GradCheck(fn, append(spec.m.Parameters(), x), core.GradCheckOptions{}))
+
+			spec.m.Eval()
+			assert.Nil(t, core.GradCheck(fn, append(spec.m.Parameters(), x), core.GradCheckOptions{}))
+		})
+	}
+}
@@ -0,0 +1,413 @@
+package nn
+
+import (
+	"dexianta/tgnn/core"
+	"fmt"
+	"math"
+)
+
+// the recurrent layers run over sequences laid out as (seq, batch, feature), same as pytorch's default
+// a cell computes a single time step, the multi-layer wrappers unroll the cells over the sequence, so the
+// backpropagation through time is done by the autograd of the unrolled graph
+
+// WithNumLayers stacks n recurrent layers, the output sequence of a layer is the input of the next one, 1 by default
+func WithNumLayers(n int) Option {
+	return func(c *config) {
+		c.numLayers = n
+	}
+}
+
+// WithBidirectional adds a layer running backward over the sequence to every layer, the outputs of both directions
+// are concatenated along the features
+func WithBidirectional() Option {
+	return func(c *config) {
+		c.bidirectional = true
+	}
+}
+
+// WithReLU uses relu instead of tanh as the nonlinearity of RNN and RNNCell
+func WithReLU() Option {
+	return func(c *config) {
+		c.relu = true
+	}
+}
+
+// State is the hidden state of a recurrent layer, C is the cell state of LSTM and unused by RNN and GRU
+// the zero value means a state of zeros
+type State struct {
+	H, C core.Tensor
+}
+
+// Cell computes a single time step of a recurrent layer
+type Cell interface {
+	Module
+	// Step takes the input x (batch, in) and the state of the previous step, and returns the next state
+	Step(x core.Tensor, s State) State
+}
+
+// cell holds the parameters shared by all the cells, the weights of the gates are concatenated along the columns
+// e.g. the (in, 4*hidden) WeightIH of LSTM holds the input, forget, cell and output gates
+type cell struct {
+	mode
+	In, Hidden int
+
+	WeightIH core.Tensor // (in, gates*hidden)
+	WeightHH core.Tensor // (hidden, gates*hidden)
+	BiasIH   core.Tensor // (gates*hidden), Dim() == 0 without bias
+	BiasHH   core.Tensor
+}
+
+// newCell initializes everything from U(-1/sqrt(hidden), 1/sqrt(hidden)) like pytorch
+func newCell(in, hidden, gates int, c config) cell {
+	if in <= 0 || hidden <= 0 {
+		panic(fmt.Sprintf("recurrent cell: invalid input size %d or hidden size %d", in, hidden))
+	}
+	ret := cell{
+		In:       in,
+		Hidden:   hidden,
+		WeightIH: core.Zeros(in, gates*hidden).SetRequiresGrad(true),
+		WeightHH: core.Zeros(hidden, gates*hidden).SetRequiresGrad(true),
+	}
+	if !c.noBias {
+		ret.BiasIH = core.Zeros(gates * hidden).SetRequiresGrad(true)
+		ret.BiasHH = core.Zeros(gates * hidden).SetRequiresGrad(true)
+	}
+	bound := 1 / math.Sqrt(float64(hidden))
+	for _, p := range ret.Parameters() {
+		Uniform(p, -bound, bound)
+	}
+	return ret
+}
+
+func (c *cell) hasBias() bool {
+	return c.BiasIH.Dim() != 0
+}
+
+// project returns x @ WeightIH + BiasIH and h @ WeightHH + BiasHH, a zero h is filled with zeros
+func (c *cell) project(op string, x, h core.Tensor) (core.Tensor, core.Tensor) {
+	if x.Dim() != 2 || x.Shape[1] != c.In {
+		panic(fmt.Sprintf("%s: input shape %v doesn't match (batch, %d)", op, x.Shape, c.In))
+	}
+	if h.Dim() == 0 {
+		h = core.Zeros(x.Shape[0], c.Hidden)
+	}
+	if !h.Shape.Equal(core.Shape{x.Shape[0], c.Hidden}) {
+		panic(fmt.Sprintf("%s: hidden shape %v doesn't match (%d, %d)", op, h.Shape, x.Shape[0], c.Hidden))
+	}
+	xs, hs := x.Matmul(c.WeightIH), h.Matmul(c.WeightHH)
+	if c.hasBias() {
+		xs, hs = xs.Add(c.BiasIH), hs.Add(c.BiasHH)
+	}
+	return xs, hs
+}
+
+func (c *cell) Parameters() []core.Tensor {
+	return Parameters(c.NamedParameters())
+}
+
+func (c *cell) NamedParameters() []NamedParameter {
+	ret := []NamedParameter{{"weight_ih", c.WeightIH}, {"weight_hh", c.WeightHH}}
+	if c.hasBias() {
+		ret = append(ret, NamedParameter{"bias_ih", c.BiasIH}, NamedParameter{"bias_hh", c.BiasHH})
+	}
+	return ret
+}
+
+func (c *cell) ZeroGrad() {
+	ZeroGrad(c.Parameters())
+}
+
+// RNNCell is the Elman cell h' = tanh(x @ WeightIH + BiasIH + h @ WeightHH + BiasHH)
+type RNNCell struct {
+	cell
+	ReLU bool // relu instead of tanh
+}
+
+// NewRNNCell creates a RNN cell, it supports the options WithReLU and WithoutBias
+func NewRNNCell(in, hidden int, opts ...Option) *RNNCell {
+	c := newConfig(opts)
+	return &RNNCell{cell: newCell(in, hidden, 1, c), ReLU: c.relu}
+}
+
+func (r *RNNCell) Step(x core.Tensor, s State) State {
+	xs, hs := r.project("rnn cell", x, s.H)
+	if r.ReLU {
+		return State{H: xs.Add(hs).ReLu()}
+	}
+	return State{H: xs.Add(hs).Tanh()}
+}
+
+// Forward is a step from a state of zeros, it returns the hidden state
+func (r *RNNCell) Forward(x core.Tensor) core.Tensor {
+	return r.Step(x, State{}).H
+}
+
+func (r *RNNCell) String() string {
+	return fmt.Sprintf("RNNCell(in: %d, hidden: %d, relu: %v, bias: %v)", r.In, r.Hidden, r.ReLU, r.hasBias())
+}
+
+// LSTMCell is the long short-term memory cell
+//
+//	i, f, g, o = sigmoid(x_i + h_i), sigmoid(x_f + h_f), tanh(x_g + h_g), sigmoid(x_o + h_o)
+//	c' = f * c + i * g
+//	h' = o * tanh(c')
+//
+// where x_* and h_* are the gates of x @ WeightIH + BiasIH and h @ WeightHH + BiasHH
+type LSTMCell struct {
+	cell
+}
+
+// NewLSTMCell creates a LSTM cell, it supports the option WithoutBias
+func NewLSTMCell(in, hidden int, opts ...Option) *LSTMCell {
+	return &LSTMCell{newCell(in, hidden, 4, newConfig(opts))}
+}
+
+func (l *LSTMCell) Step(x core.Tensor, s State) State {
+	xs, hs := l.project("lstm cell", x, s.H)
+	gates := xs.Add(hs).Chunk(4, -1)
+	i, f, g, o := gates[0].Sigmoid(), gates[1].Sigmoid(), gates[2].Tanh(), gates[3].Sigmoid()
+
+	c := i.Mul(g)
+	if s.C.Dim() != 0 {
+		if !s.C.Shape.Equal(c.Shape) {
+			panic(fmt.Sprintf("lstm cell: cell state shape %v doesn't match %v", s.C.Shape, c.Shape))
+		}
+		c = f.Mul(s.C).Add(c)
+	}
+	return State{H: o.Mul(c.Tanh()), C: c}
+}
+
+// Forward is a step from a state of zeros, it returns the hidden state
+func (l *LSTMCell) Forward(x core.Tensor) core.Tensor {
+	return l.Step(x, State{}).H
+}
+
+func (l *LSTMCell) String() string {
+	return fmt.Sprintf("LSTMCell(in: %d, hidden: %d, bias: %v)", l.In, l.Hidden, l.hasBias())
+}
+
+// GRUCell is the gated recurrent unit
+//
+//	r, z = sigmoid(x_r + h_r), sigmoid(x_z + h_z)
+//	n = tanh(x_n + r * h_n)
+//	h' = (1 - z) * n + z * h
+//
+// where x_* and h_* are the gates of x @ WeightIH + BiasIH and h @ WeightHH + BiasHH
+type GRUCell struct {
+	cell
+}
+
+// NewGRUCell creates a GRU cell, it supports the option WithoutBias
+func NewGRUCell(in, hidden int, opts ...Option) *GRUCell {
+	return &GRUCell{newCell(in, hidden, 3, newConfig(opts))}
+}
+
+func (g *GRUCell) Step(x core.Tensor, s State) State {
+	h := s.H
+	if h.Dim() == 0 {
+		h = core.Zeros(x.Shape[0], g.Hidden)
+	}
+	xs, hs := g.project("gru cell", x, h)
+	xg, hg := xs.Chunk(3, -1), hs.Chunk(3, -1)
+	r, z := xg[0].Add(hg[0]).Sigmoid(), xg[1].Add(hg[1]).Sigmoid()
+	n := xg[2].Add(r.Mul(hg[2])).Tanh()
+	// (1 - z) * n + z * h = n + z * (h - n)
+	return State{H: n.Add(z.Mul(h.Sub(n)))}
+}
+
+// Forward is a step from a state of zeros, it returns the hidden state
+func (g *GRUCell) Forward(x core.Tensor) core.Tensor {
+	return g.Step(x, State{}).H
+}
+
+func (g *GRUCell) String() string {
+	return fmt.Sprintf("GRUCell(in: %d, hidden: %d, bias: %v)", g.In, g.Hidden, g.hasBias())
+}
+
+// recurrent unrolls the cells of every layer and direction over a sequence
+type recurrent struct {
+	name                  string
+	In, Hidden, NumLayers int
+	Bidirectional         bool
+
+	// Cells[layer][direction], the direction 1 runs backward over the sequence
+	Cells [][]Cell
+}
+
+func newRecurrent(name string, in, hidden int, c config, newCell func(in int) Cell) recurrent {
+	if c.numLayers <= 0 {
+		panic(fmt.Sprintf("%s: invalid number of layers %d", name, c.numLayers))
+	}
+	r := recurrent{name: name, In: in, Hidden: hidden, NumLayers: c.numLayers, Bidirectional: c.bidirectional}
+	for l := 0; l < r.NumLayers; l++ {
+		// the layers above the first one take the outputs of all the directions
+		layerIn := in
+		if l > 0 {
+			layerIn = r.directions() * hidden
+		}
+		cells := make([]Cell, r.directions())
+		for d := range cells {
+			cells[d] = newCell(layerIn)
+		}
+		r.Cells = append(r.Cells, cells)
+	}
+	return r
+}
+
+func (r *recurrent) directions() int {
+	if r.Bidirectional {
+		return 2
+	}
+	return 1
+}
+
+// Forward runs over x (seq, batch, in) from a state of zeros, and returns the hidden states of the last layer at every
+// time step (seq, batch, directions*hidden)
+func (r *recurrent) Forward(x core.Tensor) core.Tensor {
+	out, _ := r.ForwardState(x, State{})
+	return out
+}
+
+// ForwardState runs over x (seq, batch, in) from the initial state s, and returns the output like Forward along with
+// the last state of every layer and direction. the tensors of the states have the shape
+// (layers*directions, batch, hidden), ordered as layer 0 forward, layer 0 backward, layer 1 forward, ...
+// the backward direction ends at the first time step. the zero value of s (or of s.C) is a state of zeros
+func (r *recurrent) ForwardState(x core.Tensor, s State) (core.Tensor, State) {
+	if x.Dim() != 3 || x.Shape[2] != r.In {
+		panic(fmt.Sprintf("%s: input shape %v doesn't match (seq, batch, %d)", r.name, x.Shape, r.In))
+	}
+	seq, batch := x.Shape[0], x.Shape[1]
+	stateShape := core.Shape{r.NumLayers * r.directions(), batch, r.Hidden}
+	for _, t := range []core.Tensor{s.H, s.C} {
+		if t.Dim() != 0 && !t.Shape.Equal(stateShape) {
+			panic(fmt.Sprintf("%s: state shape %v doesn't match %v", r.name, t.Shape, stateShape))
+		}
+	}
+	initial := func(t core.Tensor, k int) core.Tensor {
+		if t.Dim() == 0 {
+			return t
+		}
+		return t.Index(0, k)
+	}
+
+	var hn, cn []core.Tensor
+	for l, cells := range r.Cells {
+		outs := make([]core.Tensor, len(cells))
+		for d, c := range cells {
+			k := l*len(cells) + d
+			st := State{H: initial(s.H, k), C: initial(s.C, k)}
+			hs := make([]core.Tensor, seq)
+			for i := 0; i < seq; i++ {
+				step := i
+				if d == 1 {
+					step = seq - 1 - i
+				}
+				st = c.Step(x.Index(0, step), st)
+				hs[step] = st.H
+			}
+			outs[d] = core.Stack(hs, 0)
+			hn = append(hn, st.H)
+			if st.C.Dim() != 0 {
+				cn = append(cn, st.C)
+			}
+		}
+		x = outs[0]
+		if len(outs) > 1 {
+			x = core.Cat(outs, -1)
+		}
+	}
+
+	last := State{H: core.Stack(hn, 0)}
+	if len(cn) != 0 {
+		last.C = core.Stack(cn, 0)
+	}
+	return x, last
+}
+
+func (r *recurrent) Parameters() []core.Tensor {
+	return Parameters(r.NamedParameters())
+}
+
+// Children names the cells like their parameters, e.g. "cell_l1_reverse" is the backward direction of the second layer
+func (r *recurrent) Children() []NamedModule {
+	var ret []NamedModule
+	for l, cells := range r.Cells {
+		for d, c := range cells {
+			ret = append(ret, NamedModule{"cell" + cellSuffix(l, d), c})
+		}
+	}
+	return ret
+}
+
+// cellSuffix is the suffix of the parameters of the cell of the layer l and the direction d
+func cellSuffix(l, d int) string {
+	ret := fmt.Sprintf("_l%d", l)
+	if d == 1 {
+		ret += "_reverse"
+	}
+	return ret
+}
+
+// NamedParameters follows pytorch's names, e.g. "weight_ih_l1_reverse" is the input weight of the backward direction
+// of the second layer
+func (r *recurrent) NamedParameters() []NamedParameter {
+	var ret []NamedParameter
+	for l, cells := range r.Cells {
+		for d, c := range cells {
+			for _, p := range c.NamedParameters() {
+				ret = append(ret, NamedParameter{p.Name + cellSuffix(l, d), p.Param})
+			}
+		}
+	}
+	return ret
+}
+
+func (r *recurrent) Train()         { modulesOf(r.Children()).Train() }
+func (r *recurrent) Eval()          { modulesOf(r.Children()).Eval() }
+func (r *recurrent) Training() bool { return modulesOf(r.Children()).Training() }
+
+func (r *recurrent) ZeroGrad() {
+	ZeroGrad(r.Parameters())
+}
+
+func (r *recurrent) String() string {
+	return fmt.Sprintf("%s(in: %d, hidden: %d, layers: %d, bidirectional: %v)", r.name, r.In, r.Hidden,
+		r.NumLayers, r.Bidirectional)
+}
+
+// RNN is a multi-layer Elman RNN over (seq, batch, feature) sequences, see RNNCell
+type RNN struct {
+	recurrent
+}
+
+// NewRNN creates a RNN, it supports the options WithNumLayers, WithBidirectional, WithReLU and WithoutBias
+func NewRNN(in, hidden int, opts ...Option) *RNN {
+	return &RNN{newRecurrent("RNN", in, hidden, newConfig(opts), func(in int) Cell {
+		return NewRNNCell(in, hidden, opts...)
+	})}
+}
+
+// LSTM is a multi-layer LSTM over (seq, batch, feature) sequences, see LSTMCell
+// the state returned by ForwardState holds both the hidden and the cell states
+type LSTM struct {
+	recurrent
+}
+
+// NewLSTM creates a LSTM, it supports the options WithNumLayers, WithBidirectional and WithoutBias
+func NewLSTM(in, hidden int, opts ...Option) *LSTM {
+	return &LSTM{newRecurrent("LSTM", in, hidden, newConfig(opts), func(in int) Cell {
+		return NewLSTMCell(in, hidden, opts...)
+	})}
+}
+
+// GRU is a multi-layer GRU over (seq, batch, feature) sequences, see GRUCell
+type GRU struct {
+	recurrent
+}
+
+// NewGRU creates a GRU, it supports the options WithNumLayers, WithBidirectional and WithoutBias
+func NewGRU(in, hidden int, opts ...Option) *GRU {
+	return &GRU{newRecurrent("GRU", in, hidden, newConfig(opts), func(in int) Cell {
+		return NewGRUCell(in, hidden, opts...)
+	})}
+}
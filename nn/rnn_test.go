@@ -0,0 +1,132 @@
+package nn
+
+import (
+	"dexianta/tgnn/core"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sigmoid(x float64) float64 { return 1 / (1 + math.Exp(-x)) }
+
+// setParams fills every parameter of m with v
+func setParams(m Module, v float64) {
+	for _, p := range m.Parameters() {
+		Constant(p, v)
+	}
+}
+
+func TestCells(t *testing.T) {
+	x, h, c := 0.5, 0.25, 2.
+	xs := core.NewTensor([][]float64{{x}})
+	s := State{H: core.NewTensor([][]float64{{h}}), C: core.NewTensor([][]float64{{c}})}
+
+	rnn := NewRNNCell(1, 1)
+	setParams(rnn, 0.5)
+	assert.InDelta(t, math.Tanh(0.5*x+0.5*h+1), rnn.Step(xs, s).H.Data()[0], 1e-12)
+	assert.InDelta(t, math.Tanh(0.5*x+1), rnn.Forward(xs).Data()[0], 1e-12)
+	relu := NewRNNCell(1, 1, WithReLU(), WithoutBias())
+	setParams(relu, -1)
+	assert.Equal(t, 0., relu.Forward(xs).Data()[0])
+	assert.Len(t, relu.Parameters(), 2)
+
+	// every gate gets the same value as all the weights are the same
+	lstm := NewLSTMCell(1, 1)
+	setParams(lstm, 0.5)
+	gate := 0.5*x + 0.5*h + 1
+	next := sigmoid(gate)*c + sigmoid(gate)*math.Tanh(gate)
+	ret := lstm.Step(xs, s)
+	assert.InDelta(t, next, ret.C.Data()[0], 1e-12)
+	assert.InDelta(t, sigmoid(gate)*math.Tanh(next), ret.H.Data()[0], 1e-12)
+	assert.Equal(t, core.Shape{1, 4}, lstm.WeightIH.Shape)
+
+	gru := NewGRUCell(1, 1)
+	setParams(gru, 0.5)
+	r := sigmoid(0.5*x + 0.5*h + 1)
+	n := math.Tanh(0.5*x + 0.5 + r*(0.5*h+0.5))
+	assert.InDelta(t, (1-r)*n+r*h, gru.Step(xs, s).H.Data()[0], 1e-12)
+
+	assert.Equal(t, []string{"weight_ih", "weight_hh", "bias_ih", "bias_hh"}, names(gru.NamedParameters()))
+	assert.Panics(t, func() { gru.Forward(core.Ones(2, 3)) })
+	assert.Panics(t, func() { gru.Step(xs, State{H: core.Ones(2, 1)}) })
+}
+
+func TestRecurrent(t *testing.T) {
+	specs := []struct {
+		name  string
+		new   func(opts ...Option) Module
+		state bool // has a cell state
+	}{
+		{"rnn", func(opts ...Option) Module { return NewRNN(3, 4, opts...) }, false},
+		{"lstm", func(opts ...Option) Module { return NewLSTM(3, 4, opts...) }, true},
+		{"gru", func(opts ...Option) Module { return NewGRU(3, 4, opts...) }, false},
+	}
+	for _, spec := range specs {
+		t.Run(spec.name, func(t *testing.T) {
+			m := spec.new(WithNumLayers(2), WithBidirectional())
+			forward := m.(interface {
+				ForwardState(x core.Tensor, s State) (core.Tensor, State)
+			}).ForwardState
+
+			x := core.Randn(5, 2, 3).SetRequiresGrad(true)
+			out, last := forward(x, State{})
+			assert.Equal(t, core.Shape{5, 2, 8}, out.Shape)
+			assert.Equal(t, core.Shape{4, 2, 4}, last.H.Shape)
+			assert.Equal(t, spec.state, last.C.Dim() != 0)
+			assert.True(t, out.Equal(m.Forward(x)))
+
+			// the last state of the last layer is the output at the end of its direction
+			top := out.Index(1, 0)
+			assert.True(t, top.Index(0, -1).SliceStep(0, 0, 4, 1).Equal(last.H.Index(0, 2).Index(0, 0)))
+			assert.True(t, top.Index(0, 0).SliceStep(0, 4, 8, 1).Equal(last.H.Index(0, 3).Index(0, 0)))
+
+			// backpropagation through time reaches the parameters of every layer and the first input
+			out.SumAll().Backward()
+			for _, p := range m.NamedParameters() {
+				assert.NotEqual(t, make([]float64, p.Param.Shape.Cap()), p.Param.Grad(), p.Name)
+			}
+			assert.NotEqual(t, make([]float64, 6), x.Grad()[:6])
+
+			assert.Equal(t, "weight_ih_l1_reverse", m.NamedParameters()[len(m.NamedParameters())-4].Name)
+			assert.Panics(t, func() { m.Forward(core.Ones(5, 2, 4)) })
+			assert.Panics(t, func() { forward(x, State{H: core.Zeros(2, 2, 4)}) })
+
+			// running the second half of a sequence from the state of the first half is the same as a single run
+			uni := spec.new(WithNumLayers(2))
+			forward = uni.(interface {
+				ForwardState(x core.Tensor, s State) (core.Tensor, State)
+			}).ForwardState
+			full, _ := forward(x, State{})
+			_, half := forward(x.SliceStep(0, 0, 3, 1), State{})
+			rest, _ := forward(x.SliceStep(0, 3, 5, 1), half)
+			assert.Nil(t, core.EqualFloatArray(full.SliceStep(0, 3, 5, 1).Contiguous().Data(), rest.Data(), 1e-12))
+		})
+	}
+}
+
+func TestRecurrentGrad(t *testing.T) {
+	gru := NewGRU(2, 3, WithBidirectional())
+	x := core.Randn(4, 2, 2).SetRequiresGrad(true)
+	fn := func(...core.Tensor) core.Tensor { return gru.Forward(x).Pow(2) }
+	assert.Nil(t, core.GradCheck(fn, append(gru.Parameters(), x), core.GradCheckOptions{}))
+	assert.Equal(t, "GRU(in: 2, hidden: 3, layers: 1, bidirectional: true)", gru.String())
+}
+
+func TestRecurrentChildren(t *testing.T) {
+	lstm := NewLSTM(3, 4, WithNumLayers(2), WithBidirectional())
+	var visited []string
+	Walk(lstm, func(name string, m Module) {
+		visited = append(visited, name)
+	})
+	assert.Equal(t, []string{"", "cell_l0", "cell_l0_reverse", "cell_l1", "cell_l1_reverse"}, visited)
+
+	// the cells follow the mode of the layer
+	lstm.Eval()
+	assert.False(t, lstm.Training())
+	for _, c := range lstm.Children() {
+		assert.False(t, c.Module.Training(), c.Name)
+	}
+	lstm.Train()
+	assert.True(t, lstm.Cells[1][1].Training())
+}
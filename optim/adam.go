@@ -0,0 +1,88 @@
+package optim
+
+import (
+	"dexianta/tgnn/core"
+	"math"
+)
+
+// Adam keeps running averages of the gradients (m) and of their squares (v), and scales the step of every element by
+// the inverse of its root mean square gradient
+//
+//	m = beta1 * m + (1 - beta1) * grad
+//	v = beta2 * v + (1 - beta2) * grad^2
+//	p = p - lr * m' / (sqrt(v') + eps)
+//
+// where m' = m / (1 - beta1^t) and v' = v / (1 - beta2^t) correct the bias towards 0 of the first steps
+type Adam struct {
+	optimizer
+	Beta1, Beta2, Eps float64
+	decoupled         bool
+}
+
+// NewAdam creates an Adam, it supports the options WithBetas (0.9, 0.999 by default), WithEps (1e-8 by default),
+// WithWeightDecay and WithGroup
+func NewAdam(params []core.Tensor, lr float64, opts ...Option) *Adam {
+	c := newConfig(append([]Option{WithBetas(0.9, 0.999), WithEps(1e-8)}, opts...))
+	return &Adam{optimizer: newOptimizer(params, lr, c), Beta1: c.beta1, Beta2: c.beta2, Eps: c.eps}
+}
+
+func (a *Adam) Step() {
+	a.step(a.decoupled, func(g *Group, st *paramState, data, grad []float64, size, lo, hi int) {
+		m, v := st.buf("exp_avg", size)[lo:hi], st.buf("exp_avg_sq", size)[lo:hi]
+		c1, c2 := 1-math.Pow(a.Beta1, float64(st.step)), 1-math.Pow(a.Beta2, float64(st.step))
+		for j := range data {
+			m[j] = a.Beta1*m[j] + (1-a.Beta1)*grad[j]
+			v[j] = a.Beta2*v[j] + (1-a.Beta2)*grad[j]*grad[j]
+			data[j] -= g.LR * (m[j] / c1) / (math.Sqrt(v[j]/c2) + a.Eps)
+		}
+	})
+}
+
+// AdamW is Adam with a decoupled weight decay: the parameters are shrunk by p = p * (1 - lr * wd) before the update,
+// instead of adding the decay to the gradient, where it would be scaled by the adaptive step
+type AdamW struct {
+	Adam
+}
+
+// NewAdamW creates an AdamW, it supports the same options as Adam, the weight decay is 0.01 by default
+func NewAdamW(params []core.Tensor, lr float64, opts ...Option) *AdamW {
+	a := NewAdam(params, lr, append([]Option{WithWeightDecay(0.01)}, opts...)...)
+	a.decoupled = true
+	return &AdamW{*a}
+}
+
+// Lion (evolved sign momentum) only uses the sign of an interpolation of the momentum and the gradient, so every
+// element moves by lr. the weight decay is decoupled like AdamW, and a smaller lr than Adam's is usually needed
+//
+//	p = p - lr * sign(beta1 * m + (1 - beta1) * grad)
+//	m = beta2 * m + (1 - beta2) * grad
+type Lion struct {
+	optimizer
+	Beta1, Beta2 float64
+}
+
+// NewLion creates a Lion, it supports the options WithBetas (0.9, 0.99 by default), WithWeightDecay and WithGroup
+func NewLion(params []core.Tensor, lr float64, opts ...Option) *Lion {
+	c := newConfig(append([]Option{WithBetas(0.9, 0.99)}, opts...))
+	return &Lion{optimizer: newOptimizer(params, lr, c), Beta1: c.beta1, Beta2: c.beta2}
+}
+
+func (l *Lion) Step() {
+	l.step(true, func(g *Group, st *paramState, data, grad []float64, size, lo, hi int) {
+		m := st.buf("exp_avg", size)[lo:hi]
+		for j := range data {
+			data[j] -= g.LR * sign(l.Beta1*m[j]+(1-l.Beta1)*grad[j])
+			m[j] = l.Beta2*m[j] + (1-l.Beta2)*grad[j]
+		}
+	})
+}
+
+func sign(x float64) float64 {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
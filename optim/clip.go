@@ -0,0 +1,196 @@
+package optim
+
+import (
+	"dexianta/tgnn/core"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ClipGradNorm scales the gradients of params so their total norm, the normType norm of all their elements as a
+// single vector, is at most maxNorm, e.g. after the backward of a loss that blew up. normType is usually 2, and
+// math.Inf(1) gives the max of the absolute values
+//
+// it returns the total norm before clipping. when it's NaN or Inf, the gradients are left as is, so the caller can
+// skip the step:
+//
+//	if norm := optim.ClipGradNorm(params, 1, 2); math.IsNaN(norm) || math.IsInf(norm, 0) {
+//		opt.ZeroGrad()
+//		continue
+//	}
+//	opt.Step()
+func ClipGradNorm(params []core.Tensor, maxNorm, normType float64) float64 {
+	return clipGradNorm(tensorGrads(params), maxNorm, normType)
+}
+
+// ClipGradNormV is ClipGradNorm for the Vs of a scalar model, e.g. the ones of core.MomentumOptim
+func ClipGradNormV(vs []*core.V, maxNorm, normType float64) float64 {
+	grads := vGrads(vs)
+	total := clipGradNorm(grads, maxNorm, normType)
+	setVGrads(vs, grads)
+	return total
+}
+
+// tensorGrads returns the gradient buffers of params, nil for a parameter without gradient
+func tensorGrads(params []core.Tensor) [][]float64 {
+	ret := make([][]float64, len(params))
+	for i, p := range params {
+		ret[i] = p.RawGrad()
+	}
+	return ret
+}
+
+// vGrads returns the gradients of vs as buffers of a single element, which setVGrads writes back
+func vGrads(vs []*core.V) [][]float64 {
+	ret := make([][]float64, len(vs))
+	for i, v := range vs {
+		ret[i] = []float64{v.Grad}
+	}
+	return ret
+}
+
+func setVGrads(vs []*core.V, grads [][]float64) {
+	for i, v := range vs {
+		v.Grad = grads[i][0]
+	}
+}
+
+func clipGradNorm(grads [][]float64, maxNorm, normType float64) float64 {
+	if normType <= 0 {
+		panic(fmt.Sprintf("invalid norm type %v, it must be > 0", normType))
+	}
+	var total float64
+	for _, grad := range grads {
+		for _, g := range grad {
+			if math.IsInf(normType, 1) {
+				total = math.Max(total, math.Abs(g))
+			} else {
+				total += math.Pow(math.Abs(g), normType)
+			}
+			if math.IsNaN(g) {
+				total = math.NaN()
+			}
+		}
+	}
+	if !math.IsInf(normType, 1) {
+		total = math.Pow(total, 1/normType)
+	}
+	if math.IsNaN(total) || math.IsInf(total, 0) {
+		return total
+	}
+
+	// the epsilon of pytorch, which keeps the clipped norm slightly under maxNorm
+	if coef := maxNorm / (total + 1e-6); coef < 1 {
+		for _, grad := range grads {
+			for i := range grad {
+				grad[i] *= coef
+			}
+		}
+	}
+	return total
+}
+
+// ClipGradValue clamps every element of the gradients of params into [-clip, clip], NaNs are left as is
+func ClipGradValue(params []core.Tensor, clip float64) {
+	clipGradValue(tensorGrads(params), clip)
+}
+
+// ClipGradValueV is ClipGradValue for the Vs of a scalar model
+func ClipGradValueV(vs []*core.V, clip float64) {
+	grads := vGrads(vs)
+	clipGradValue(grads, clip)
+	setVGrads(vs, grads)
+}
+
+func clipGradValue(grads [][]float64, clip float64) {
+	for _, grad := range grads {
+		for i, g := range grad {
+			grad[i] = math.Max(-clip, math.Min(clip, g))
+			if math.IsNaN(g) {
+				grad[i] = g
+			}
+		}
+	}
+}
+
+// GradStats is a report of the health of the gradients of a set of parameters
+type GradStats struct {
+	Params []ParamGradStats // in the order of the parameters
+	Norm   float64          // the L2 norm of all the gradients as a single vector
+}
+
+// ParamGradStats is the report of the gradient of a parameter, a parameter without gradient counts as all zeros
+type ParamGradStats struct {
+	Shape        core.Shape
+	HasGrad      bool
+	Norm         float64 // the L2 norm, NaN if any element is NaN
+	NaN, Inf     int     // the number of NaN and infinite elements
+	ZeroFraction float64 // the fraction of the elements equal to 0, e.g. from dead ReLUs or unused embeddings
+}
+
+// NewGradStats reports the gradients of params, to be called after the backward and before the step of the optimizer
+func NewGradStats(params []core.Tensor) GradStats {
+	shapes := make([]core.Shape, len(params))
+	for i, p := range params {
+		shapes[i] = p.Shape
+	}
+	return newGradStats(shapes, tensorGrads(params))
+}
+
+// NewGradStatsV reports the gradients of the Vs of a scalar model, as parameters of the shape [] which always have
+// a gradient
+func NewGradStatsV(vs []*core.V) GradStats {
+	return newGradStats(make([]core.Shape, len(vs)), vGrads(vs))
+}
+
+func newGradStats(shapes []core.Shape, grads [][]float64) GradStats {
+	var ret GradStats
+	for i, grad := range grads {
+		s := ParamGradStats{Shape: shapes[i], HasGrad: grad != nil, ZeroFraction: 1}
+		var zeros int
+		for _, g := range grad {
+			switch {
+			case math.IsNaN(g):
+				s.NaN++
+			case math.IsInf(g, 0):
+				s.Inf++
+			case g == 0:
+				zeros++
+			}
+			s.Norm += g * g
+		}
+		ret.Norm += s.Norm
+		s.Norm = math.Sqrt(s.Norm)
+		if len(grad) > 0 {
+			s.ZeroFraction = float64(zeros) / float64(len(grad))
+		}
+		ret.Params = append(ret.Params, s)
+	}
+	ret.Norm = math.Sqrt(ret.Norm)
+	return ret
+}
+
+// Finite is true when no gradient holds NaN or Inf
+func (s GradStats) Finite() bool {
+	for _, p := range s.Params {
+		if p.NaN > 0 || p.Inf > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns a line per parameter followed by the total norm
+func (s GradStats) String() string {
+	var b strings.Builder
+	for i, p := range s.Params {
+		if !p.HasGrad {
+			fmt.Fprintf(&b, "%d %v: no grad\n", i, p.Shape)
+			continue
+		}
+		fmt.Fprintf(&b, "%d %v: norm %.4g, nan %d, inf %d, zeros %.1f%%\n", i, p.Shape, p.Norm, p.NaN, p.Inf,
+			100*p.ZeroFraction)
+	}
+	fmt.Fprintf(&b, "total norm %.4g", s.Norm)
+	return b.String()
+}
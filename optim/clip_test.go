@@ -0,0 +1,99 @@
+package optim
+
+import (
+	"dexianta/tgnn/core"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// withGrad returns a parameter holding the gradient grad
+func withGrad(grad ...float64) core.Tensor {
+	p := core.Zeros(len(grad)).SetRequiresGrad(true)
+	p.Mul(core.NewTensor(grad)).SumAll().Backward()
+	return p
+}
+
+func TestClipGradNorm(t *testing.T) {
+	a, b := withGrad(3, 0), withGrad(0, 4)
+	norm := ClipGradNorm([]core.Tensor{a, b}, 1, 2)
+	assert.InDelta(t, 5, norm, 1e-12)
+	assert.Nil(t, core.EqualFloatArray(append(a.Grad(), b.Grad()...), []float64{0.6, 0, 0, 0.8}, 1e-6))
+
+	// under the max norm, the gradients are left as is
+	a = withGrad(3, 0)
+	assert.InDelta(t, 3, ClipGradNorm([]core.Tensor{a, core.Zeros(1).SetRequiresGrad(true)}, 10, 2), 1e-12)
+	assert.Equal(t, []float64{3, 0}, a.Grad())
+
+	a, b = withGrad(1, -2), withGrad(3, 0)
+	assert.InDelta(t, 6, ClipGradNorm([]core.Tensor{a, b}, 3, 1), 1e-12)
+	assert.Nil(t, core.EqualFloatArray(append(a.Grad(), b.Grad()...), []float64{0.5, -1, 1.5, 0}, 1e-6))
+	a, b = withGrad(1, -2), withGrad(3, 0)
+	assert.Equal(t, 3., ClipGradNorm([]core.Tensor{a, b}, 1, math.Inf(1)))
+	assert.Nil(t, core.EqualFloatArray(append(a.Grad(), b.Grad()...), []float64{1. / 3, -2. / 3, 1, 0}, 1e-6))
+
+	// a non-finite norm leaves the gradients as is
+	a = withGrad(math.Inf(1), 1)
+	assert.True(t, math.IsInf(ClipGradNorm([]core.Tensor{a}, 1, 2), 1))
+	assert.Equal(t, 1., a.Grad()[1])
+	assert.True(t, math.IsNaN(ClipGradNorm([]core.Tensor{withGrad(1, math.NaN())}, 1, 2)))
+	assert.Panics(t, func() { ClipGradNorm([]core.Tensor{a}, 1, 0) })
+}
+
+func TestClipGradValue(t *testing.T) {
+	a := withGrad(-3, 0.5, 2, math.NaN())
+	ClipGradValue([]core.Tensor{a}, 1)
+	grad := a.Grad()
+	assert.Equal(t, []float64{-1, 0.5, 1}, grad[:3])
+	assert.True(t, math.IsNaN(grad[3]))
+}
+
+func TestGradStats(t *testing.T) {
+	// exp overflowing, like a softmax over large logits
+	x := core.NewTensor([]float64{1000, 1e308, 0}).SetRequiresGrad(true)
+	x.Exp().SumAll().Backward()
+	w := withGrad(0, 0, 3, 4)
+	none := core.Zeros(2, 2).SetRequiresGrad(true)
+
+	s := NewGradStats([]core.Tensor{w, none})
+	assert.True(t, s.Finite())
+	assert.Equal(t, ParamGradStats{Shape: core.Shape{4}, HasGrad: true, Norm: 5, ZeroFraction: 0.5}, s.Params[0])
+	assert.Equal(t, ParamGradStats{Shape: core.Shape{2, 2}, ZeroFraction: 1}, s.Params[1])
+	assert.Equal(t, 5., s.Norm)
+	assert.Equal(t, "0 [4]: norm 5, nan 0, inf 0, zeros 50.0%\n1 [2 2]: no grad\ntotal norm 5", s.String())
+
+	s = NewGradStats([]core.Tensor{w, x})
+	assert.False(t, s.Finite())
+	assert.Equal(t, 2, s.Params[1].Inf)
+	assert.Equal(t, 0., s.Params[1].ZeroFraction)
+	assert.True(t, math.IsInf(s.Norm, 1))
+}
+
+func TestClipGradV(t *testing.T) {
+	a, b := core.Vx(1), core.Vx(2)
+	vs := []*core.V{a, b}
+	opt := core.NewMomentumOptim(vs, 1, 0)
+	// the gradients of 3a + 4b
+	a.Mul(core.Vx(3)).Add(b.Mul(core.Vx(4))).Backward()
+
+	s := NewGradStatsV(vs)
+	assert.True(t, s.Finite())
+	assert.Equal(t, ParamGradStats{HasGrad: true, Norm: 3}, s.Params[0])
+	assert.Equal(t, 5., s.Norm)
+	assert.Equal(t, "0 []: norm 3, nan 0, inf 0, zeros 0.0%\n1 []: norm 4, nan 0, inf 0, zeros 0.0%\ntotal norm 5",
+		s.String())
+
+	assert.InDelta(t, 5, ClipGradNormV(vs, 1, 2), 1e-12)
+	assert.InDelta(t, 0.6, a.Grad, 1e-6)
+	assert.InDelta(t, 0.8, b.Grad, 1e-6)
+	opt.Step()
+	assert.InDelta(t, 0.4, a.Data, 1e-6)
+	assert.InDelta(t, 1.2, b.Data, 1e-6)
+
+	a.Grad, b.Grad = -3, math.NaN()
+	ClipGradValueV(vs, 1)
+	assert.Equal(t, -1., a.Grad)
+	assert.True(t, math.IsNaN(b.Grad))
+	assert.False(t, NewGradStatsV(vs).Finite())
+}
@@ -0,0 +1,343 @@
+// Package optim contains the optimizers updating the parameters of a model from their gradients, following the
+// semantic of torch.optim, e.g.
+//
+//	opt := optim.NewAdam(model.Parameters(), 1e-3)
+//	for ... {
+//		loss(model.Forward(x), y).Backward()
+//		opt.Step()
+//		opt.ZeroGrad()
+//	}
+//
+// the parameters can be split into groups with their own learning rate and weight decay with WithGroup
+package optim
+
+import (
+	"dexianta/tgnn/core"
+	"fmt"
+)
+
+// Optimizer updates a set of parameters from their gradients
+type Optimizer interface {
+	// Step updates the parameters with their current gradients, the parameters without gradient are skipped
+	Step()
+	// ZeroGrad resets the gradients of all the parameters
+	ZeroGrad()
+	// Groups returns the param groups, their LR and WeightDecay can be changed between steps, e.g. by a scheduler
+	Groups() []*Group
+	// StateDict returns a copy of the state (the hyper parameters of the groups and the buffers of the parameters),
+	// which LoadStateDict restores into an optimizer of the same type over the same parameters, e.g. to resume a
+	// training from a checkpoint
+	StateDict() StateDict
+	LoadStateDict(s StateDict)
+}
+
+// Group is a set of parameters sharing the same hyper parameters
+type Group struct {
+	Params      []core.Tensor
+	LR          float64
+	WeightDecay float64
+}
+
+// StateDict is the state of an optimizer, made of plain values so it can be saved with encoding/json or gob
+type StateDict struct {
+	Groups []GroupState
+	Params []ParamState // in the order of the parameters of the groups
+}
+
+type GroupState struct {
+	LR, WeightDecay float64
+	Params          int // the number of parameters in the group
+}
+
+type ParamState struct {
+	Step    int                  // the number of updates of the parameter
+	Buffers map[string][]float64 // e.g. the moments of Adam, "exp_avg" and "exp_avg_sq"
+}
+
+// Option configures an optimizer or a scheduler, each of them documents the options it supports
+type Option func(*config)
+
+type config struct {
+	weightDecay  float64
+	groups       []Group
+	momentum     float64
+	nesterov     bool
+	beta1, beta2 float64
+	eps          float64
+	alpha        float64
+
+	// schedulers
+	minLR                     float64
+	pctStart                  float64
+	divFactor, finalDivFactor float64
+	threshold                 float64
+	cooldown                  int
+	maximize                  bool
+}
+
+func newConfig(opts []Option) config {
+	var c config
+	for _, o := range opts {
+		o(&c)
+	}
+	return c
+}
+
+// WithWeightDecay sets the weight decay of the parameters given to the constructor, 0 by default (except AdamW)
+func WithWeightDecay(wd float64) Option {
+	return func(c *config) {
+		c.weightDecay = wd
+	}
+}
+
+// WithGroup adds a group of parameters with their own learning rate and weight decay, e.g. no weight decay for the
+// biases and the norms
+func WithGroup(params []core.Tensor, lr, weightDecay float64) Option {
+	return func(c *config) {
+		c.groups = append(c.groups, Group{Params: params, LR: lr, WeightDecay: weightDecay})
+	}
+}
+
+// WithMomentum sets the momentum of SGD and RMSprop, 0 by default
+func WithMomentum(m float64) Option {
+	return func(c *config) {
+		c.momentum = m
+	}
+}
+
+// WithNesterov uses the Nesterov momentum in SGD
+func WithNesterov() Option {
+	return func(c *config) {
+		c.nesterov = true
+	}
+}
+
+// WithBetas sets the decay rates of the moments of Adam, AdamW and Lion
+func WithBetas(beta1, beta2 float64) Option {
+	return func(c *config) {
+		c.beta1, c.beta2 = beta1, beta2
+	}
+}
+
+// WithEps sets the value added to the denominators for numerical stability
+func WithEps(eps float64) Option {
+	return func(c *config) {
+		c.eps = eps
+	}
+}
+
+// WithAlpha sets the decay rate of the average of the squared gradients of RMSprop, 0.99 by default
+func WithAlpha(alpha float64) Option {
+	return func(c *config) {
+		c.alpha = alpha
+	}
+}
+
+// WithMinLR sets the lower bound of the LR of CosineAnnealingWarmRestarts and ReduceLROnPlateau, 0 by default
+func WithMinLR(lr float64) Option {
+	return func(c *config) {
+		c.minLR = lr
+	}
+}
+
+// WithPctStart sets the fraction of the steps of OneCycle spent increasing the LR, 0.3 by default
+func WithPctStart(pct float64) Option {
+	return func(c *config) {
+		c.pctStart = pct
+	}
+}
+
+// WithDivFactors sets the initial LR of OneCycle to max / div, and its final LR to max / (div * finalDiv), 25 and
+// 1e4 by default
+func WithDivFactors(div, finalDiv float64) Option {
+	return func(c *config) {
+		c.divFactor, c.finalDivFactor = div, finalDiv
+	}
+}
+
+// WithThreshold sets the relative improvement of the metric under which ReduceLROnPlateau counts an epoch as bad,
+// 1e-4 by default
+func WithThreshold(threshold float64) Option {
+	return func(c *config) {
+		c.threshold = threshold
+	}
+}
+
+// WithCooldown sets the number of epochs ReduceLROnPlateau waits after a reduction before counting the bad epochs
+// again, 0 by default
+func WithCooldown(epochs int) Option {
+	return func(c *config) {
+		c.cooldown = epochs
+	}
+}
+
+// WithMaximize makes ReduceLROnPlateau look for an increase of the metric (e.g. an accuracy) instead of a decrease
+func WithMaximize() Option {
+	return func(c *config) {
+		c.maximize = true
+	}
+}
+
+// paramState is the state of a parameter during the training
+type paramState struct {
+	step int
+	bufs map[string][]float64
+}
+
+// buf returns the buffer name of the size of the parameter, allocated with zeros on first use
+func (s *paramState) buf(name string, size int) []float64 {
+	if s.bufs[name] == nil {
+		s.bufs[name] = make([]float64, size)
+	}
+	return s.bufs[name]
+}
+
+// optimizer holds the groups and the state of the parameters, and implements everything but Step
+type optimizer struct {
+	groups []*Group
+	state  []*paramState // in the order of the parameters of the groups
+}
+
+// newOptimizer builds the groups: the parameters given to the constructor with lr and the weight decay of c, followed
+// by the groups of WithGroup. the first group is dropped when it's empty and there are others, so all the parameters
+// can be given by WithGroup
+func newOptimizer(params []core.Tensor, lr float64, c config) optimizer {
+	o := optimizer{}
+	groups := []Group{{Params: params, LR: lr, WeightDecay: c.weightDecay}}
+	if len(params) == 0 && len(c.groups) > 0 {
+		groups = nil
+	}
+	for _, g := range append(groups, c.groups...) {
+		g := g
+		o.groups = append(o.groups, &g)
+		for range g.Params {
+			o.state = append(o.state, &paramState{bufs: map[string][]float64{}})
+		}
+	}
+	return o
+}
+
+// update is the update rule of an optimizer over the elements [lo, hi) of a parameter: data and grad are these
+// elements, and st.buf(name, size)[lo:hi] the ones of a buffer
+type update func(g *Group, st *paramState, data, grad []float64, size, lo, hi int)
+
+// step applies fn to every parameter with a gradient. the weight decay is added to the gradient (L2 penalty:
+// grad + wd * p) unless decoupled, where the parameter is shrunk directly (p = p * (1 - lr * wd)) as in AdamW
+// a sparse gradient (see core.Tensor.SparseGrad) only updates the rows holding it, the buffers of the other rows are
+// kept as is until they get a gradient again (a lazy update)
+func (o *optimizer) step(decoupled bool, fn update) {
+	k := 0
+	for _, g := range o.groups {
+		for _, p := range g.Params {
+			st := o.state[k]
+			k++
+			grad := p.RawGrad()
+			if grad == nil {
+				continue
+			}
+			// a sparse gradient without any row (e.g. an embedding not looked up since the ZeroGrad) isn't a step
+			sps := spans(p)
+			if len(sps) == 0 {
+				continue
+			}
+			st.step++
+			data := p.Data()
+			var buf []float64
+			for _, sp := range sps {
+				buf = append(buf[:0], grad[sp.lo:sp.hi]...)
+				d := data[sp.lo:sp.hi]
+				if g.WeightDecay != 0 {
+					for j := range d {
+						if decoupled {
+							d[j] *= 1 - g.LR*g.WeightDecay
+						} else {
+							buf[j] += g.WeightDecay * d[j]
+						}
+					}
+				}
+				fn(g, st, d, buf, len(data), sp.lo, sp.hi)
+			}
+		}
+	}
+}
+
+func (o *optimizer) ZeroGrad() {
+	for _, g := range o.groups {
+		for _, p := range g.Params {
+			p.ZeroGrad()
+		}
+	}
+}
+
+func (o *optimizer) Groups() []*Group {
+	return o.groups
+}
+
+func (o *optimizer) StateDict() StateDict {
+	var ret StateDict
+	for _, g := range o.groups {
+		ret.Groups = append(ret.Groups, GroupState{LR: g.LR, WeightDecay: g.WeightDecay, Params: len(g.Params)})
+	}
+	for _, st := range o.state {
+		bufs := map[string][]float64{}
+		for name, b := range st.bufs {
+			bufs[name] = append([]float64{}, b...)
+		}
+		ret.Params = append(ret.Params, ParamState{Step: st.step, Buffers: bufs})
+	}
+	return ret
+}
+
+// LoadStateDict panics if s doesn't match the groups and the parameters, the optimizer is left as is in that case
+func (o *optimizer) LoadStateDict(s StateDict) {
+	if len(s.Groups) != len(o.groups) || len(s.Params) != len(o.state) {
+		panic(fmt.Sprintf("optimizer state of %d groups and %d params doesn't match %d groups and %d params",
+			len(s.Groups), len(s.Params), len(o.groups), len(o.state)))
+	}
+	k := 0
+	for i, g := range o.groups {
+		if s.Groups[i].Params != len(g.Params) {
+			panic(fmt.Sprintf("optimizer state of %d params doesn't match the %d params of group %d",
+				s.Groups[i].Params, len(g.Params), i))
+		}
+		for _, p := range g.Params {
+			for name, b := range s.Params[k].Buffers {
+				if len(b) != p.Shape.Cap() {
+					panic(fmt.Sprintf("optimizer state %q of size %d doesn't match param %d of shape %v", name,
+						len(b), k, p.Shape))
+				}
+			}
+			k++
+		}
+	}
+
+	for i, g := range o.groups {
+		g.LR, g.WeightDecay = s.Groups[i].LR, s.Groups[i].WeightDecay
+	}
+	for k, st := range o.state {
+		st.step = s.Params[k].Step
+		st.bufs = map[string][]float64{}
+		for name, b := range s.Params[k].Buffers {
+			st.bufs[name] = append([]float64{}, b...)
+		}
+	}
+}
+
+// span is a range [lo, hi) of the elements of a parameter
+type span struct{ lo, hi int }
+
+// spans returns the ranges of the elements of p holding a gradient: the rows of a sparse gradient (see
+// core.Tensor.SparseGrad), all the elements otherwise, so the optimizers only update the rows of an embedding looked
+// up by the batch
+func spans(p core.Tensor) []span {
+	rows, ok := p.SparseGrad()
+	if !ok {
+		return []span{{0, p.Shape.Cap()}}
+	}
+	ret := make([]span, len(rows))
+	size := p.Shape.Cap() / p.Shape[0]
+	for i, r := range rows {
+		ret[i] = span{r * size, (r + 1) * size}
+	}
+	return ret
+}
@@ -0,0 +1,290 @@
+package optim
+
+import (
+	"bytes"
+	"dexianta/tgnn/core"
+	"encoding/gob"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// taylorLoss is the mean squared error of the fit of e^x ~ 1 + x + a*x^2 + b*x^3 + c*x^4 + d*x^5 over x in [-3, 3),
+// like the taylor expansion example, with the params (a, b) and (c, d) in two param groups
+func taylorLoss(ab, cd core.Tensor) core.Tensor {
+	var low, high, base, y [][]float64
+	for _, x := range core.Range(-3, 3, 0.5) {
+		low = append(low, []float64{x * x, x * x * x})
+		high = append(high, []float64{x * x * x * x, x * x * x * x * x})
+		base = append(base, []float64{1 + x})
+		y = append(y, []float64{math.Exp(x)})
+	}
+	pred := core.NewTensor(low).Matmul(ab).Add(core.NewTensor(high).Matmul(cd)).Add(core.NewTensor(base))
+	return pred.Sub(core.NewTensor(y)).Pow(2).MeanAll()
+}
+
+func params(data ...float64) core.Tensor {
+	return core.NewTensor(data).View(2, 1).SetRequiresGrad(true)
+}
+
+// train runs steps updates of opt over the taylor problem
+func train(opt Optimizer, ab, cd core.Tensor, steps int) {
+	for step := 0; step < steps; step++ {
+		taylorLoss(ab, cd).Backward()
+		opt.Step()
+		opt.ZeroGrad()
+	}
+}
+
+// the optimizers under test, over the params ab and cd in two groups with their own lr and weight decay
+var optimizers = []struct {
+	name string
+	new  func(ab, cd core.Tensor) Optimizer
+}{
+	{"sgd nesterov", func(ab, cd core.Tensor) Optimizer {
+		return NewSGD([]core.Tensor{ab}, 1e-4, WithWeightDecay(0.01), WithMomentum(0.9), WithNesterov(),
+			WithGroup([]core.Tensor{cd}, 1e-5, 0))
+	}},
+	{"adam", func(ab, cd core.Tensor) Optimizer {
+		return NewAdam([]core.Tensor{ab}, 0.01, WithGroup([]core.Tensor{cd}, 0.001, 0.1))
+	}},
+	{"adamw", func(ab, cd core.Tensor) Optimizer {
+		return NewAdamW([]core.Tensor{ab}, 0.01, WithGroup([]core.Tensor{cd}, 0.001, 0.1))
+	}},
+	{"rmsprop", func(ab, cd core.Tensor) Optimizer {
+		return NewRMSprop([]core.Tensor{ab}, 0.01, WithMomentum(0.5), WithGroup([]core.Tensor{cd}, 0.001, 0.1))
+	}},
+	{"adagrad", func(ab, cd core.Tensor) Optimizer {
+		return NewAdagrad([]core.Tensor{ab}, 0.1, WithGroup([]core.Tensor{cd}, 0.01, 0.1))
+	}},
+	{"lion", func(ab, cd core.Tensor) Optimizer {
+		return NewLion([]core.Tensor{ab}, 0.001, WithGroup([]core.Tensor{cd}, 0.0001, 0.1))
+	}},
+}
+
+// the first steps of every optimizer over the quadratic loss (|ab|^2 + |cd|^2) / 2, whose gradient is the params
+// themselves, against the update rules unrolled by hand. the lrs are small enough for no element to cross 0
+func TestUpdateRules(t *testing.T) {
+	sign := func(x float64) float64 { return math.Copysign(1, x) }
+	// adam unrolls Adam (0.9, 0.999, 1e-8) from p0 for two steps, with the weight decay coupled (L2) or decoupled
+	adam := func(decoupled bool) func(p0, lr, wd float64) []float64 {
+		return func(p0, lr, wd float64) []float64 {
+			// decay returns the param shrunk by the decoupled weight decay, and the gradient with the L2 penalty
+			decay := func(p float64) (float64, float64) {
+				if decoupled {
+					return p * (1 - lr*wd), p
+				}
+				return p, p + wd*p
+			}
+			// m' = g0 and v' = g0^2 after the bias correction
+			p, g0 := decay(p0)
+			p1 := p - lr*g0/(math.Abs(g0)+1e-8)
+			p, g1 := decay(p1)
+			m := (0.9*0.1*g0 + 0.1*g1) / (1 - 0.9*0.9)
+			v := (0.999*0.001*g0*g0 + 0.001*g1*g1) / (1 - 0.999*0.999)
+			p2 := p - lr*m/(math.Sqrt(v)+1e-8)
+			return []float64{p1, p2}
+		}
+	}
+	rules := map[string]func(p0, lr, wd float64) []float64{
+		// v1 = g0, v2 = 0.9 g0 + g1, v3 = 0.81 g0 + 0.9 g1 + g2 and p = p - lr * (g + 0.9 v), with the L2 penalty
+		"sgd nesterov": func(p0, lr, wd float64) []float64 {
+			g0 := (1 + wd) * p0
+			p1 := p0 - lr*(g0+0.9*g0)
+			g1 := (1 + wd) * p1
+			p2 := p1 - lr*(g1+0.9*(0.9*g0+g1))
+			g2 := (1 + wd) * p2
+			p3 := p2 - lr*(g2+0.9*(0.81*g0+0.9*g1+g2))
+			return []float64{p1, p2, p3}
+		},
+		"adam":  adam(false),
+		"adamw": adam(true),
+		// v1 = 0.01 g0^2, v2 = 0.99 v1 + 0.01 g1^2 (alpha 0.99), the velocity b2 = 0.5 b1 + g1 / (sqrt(v2) + eps)
+		"rmsprop": func(p0, lr, wd float64) []float64 {
+			g0 := (1 + wd) * p0
+			v1 := 0.01 * g0 * g0
+			b1 := g0 / (math.Sqrt(v1) + 1e-8)
+			p1 := p0 - lr*b1
+			g1 := (1 + wd) * p1
+			v2 := 0.99*v1 + 0.01*g1*g1
+			p2 := p1 - lr*(0.5*b1+g1/(math.Sqrt(v2)+1e-8))
+			return []float64{p1, p2}
+		},
+		// the sums of squares are g0^2 and g0^2 + g1^2
+		"adagrad": func(p0, lr, wd float64) []float64 {
+			g0 := (1 + wd) * p0
+			p1 := p0 - lr*g0/(math.Abs(g0)+1e-10)
+			g1 := (1 + wd) * p1
+			p2 := p1 - lr*g1/(math.Sqrt(g0*g0+g1*g1)+1e-10)
+			return []float64{p1, p2}
+		},
+		// the interpolations 0.1 g0, 0.9 * 0.01 g0 + 0.1 g1, ... all have the sign of p0, so every step is the
+		// decoupled decay followed by a move of lr towards 0
+		"lion": func(p0, lr, wd float64) []float64 {
+			p1 := p0*(1-lr*wd) - lr*sign(p0)
+			p2 := p1*(1-lr*wd) - lr*sign(p0)
+			p3 := p2*(1-lr*wd) - lr*sign(p0)
+			return []float64{p1, p2, p3}
+		},
+	}
+
+	for _, o := range optimizers {
+		t.Run(o.name, func(t *testing.T) {
+			ab, cd := params(1, -2), params(2, -1)
+			opt := o.new(ab, cd)
+			// the expected trajectory of every element, unrolled with the lr and the weight decay of its group
+			var expected [][]float64
+			for i, p := range []core.Tensor{ab, cd} {
+				g := opt.Groups()[i]
+				for _, p0 := range p.Data() {
+					expected = append(expected, rules[o.name](p0, g.LR, g.WeightDecay))
+				}
+			}
+
+			for step := range expected[0] {
+				ab.Pow(2).SumAll().Add(cd.Pow(2).SumAll()).MulS(0.5).Backward()
+				opt.Step()
+				opt.ZeroGrad()
+				data := append(ab.Data(), cd.Data()...)
+				for i := range expected {
+					assert.InDelta(t, expected[i][step], data[i], 1e-12, "step %d, element %d", step+1, i)
+				}
+			}
+		})
+	}
+}
+
+// the trajectories (a, b, c, d) of the optimizers after the steps 1, 2, 3 and 50 over the taylor problem, regression
+// values recorded from this implementation (TestUpdateRules checks the rules themselves)
+func TestTrajectories(t *testing.T) {
+	trajectories := map[string][][]float64{
+		"sgd nesterov": {
+			{0.0035446110300857998, 0.0027307027445093719, 0.0021222315750492569, 0.00097954190857344457},
+			{0.0085742860938757947, 0.0063656074831837973, 0.0051453906736334872, 0.0021964487778783886},
+			{0.014901544888272333, 0.010635569557344359, 0.0089629540256259011, 0.003509074204154122},
+			{0.19423096111983215, 0.10270257267596698, 0.10846534941247059, 0.022777699533820424},
+		},
+		"adam": {
+			{0.0099999999946397515, 0.0099999999930420833, 0.00099999999991047159, 0.0009999999998060317},
+			{0.020002664473979814, 0.01985684185002061, 0.0020005937058272987, 0.001944715771969391},
+			{0.030009286569659354, 0.029413612242039144, 0.003002103122574977, 0.002733341443993377},
+			{0.40405987767149054, 0.28250130512558236, 0.040095789337658651, -0.011346145878199035},
+		},
+		"adamw": {
+			{0.0099999999946397515, 0.0099999999930420833, 0.00099999999991047159, 0.0009999999998060317},
+			{0.02000166447398035, 0.019855841850021306, 0.0020004937228804377, 0.001944616268307474},
+			{0.030006286064493324, 0.029410667017167949, 0.0030018030668997682, 0.0027330719537422376},
+			{0.40320609712401112, 0.28206668830873161, 0.040012090171088442, -0.011332421092665855},
+		},
+		"rmsprop": {
+			{0.099999999463975003, 0.099999999304208387, 0.0099999999910471548, 0.0099999999806031723},
+			{0.22441464388576274, 0.072160337218404674, 0.022856925561106255, 0.0053725226195727067},
+			{0.32274518002200842, 0.084629803566861228, 0.032730739549250987, 0.0038003480537008236},
+			{0.49713775167913249, 0.17862252457378272, 0.051375758017539935, 0.0073396100785203767},
+		},
+		"adagrad": {
+			{0.09999999999946399, 0.099999999999304215, 0.0099999999999910473, 0.0099999999999806043},
+			{0.17424749649545321, 0.022314808462804536, 0.017841783886372229, 0.00037607587438656317},
+			{0.20718838666765799, 0.092036544790904812, 0.020568163627763588, 0.0060484908611254983},
+			{0.50026253362561901, 0.19066132542037548, 0.049630786197478398, 0.005434890219427781},
+		},
+		"lion": {
+			{0.001, 0.001, 0.0001, 0.0001},
+			{0.002, 0.002, 0.00019999900000000002, 0.00019999900000000002},
+			{0.0030000000000000001, 0.0030000000000000001, 0.00029999700001000001, 0.00029999700001000001},
+			{0.050000000000000037, 0.050000000000000037, 0.0049987751959769781, 0.0017990151847773405},
+		},
+	}
+
+	for _, o := range optimizers {
+		t.Run(o.name, func(t *testing.T) {
+			ab, cd := params(0, 0), params(0, 0)
+			opt := o.new(ab, cd)
+			var trajectory [][]float64
+			for step := 1; step <= 50; step++ {
+				train(opt, ab, cd, 1)
+				if step <= 3 || step == 50 {
+					trajectory = append(trajectory, append(ab.Data(), cd.Data()...))
+				}
+			}
+			assert.Len(t, trajectories[o.name], len(trajectory))
+			for i, expected := range trajectories[o.name] {
+				assert.Nil(t, core.EqualFloatArray(trajectory[i], expected, 1e-10), "point %d", i)
+			}
+		})
+	}
+}
+
+func TestStateDict(t *testing.T) {
+	newAdam := func(ab, cd core.Tensor) Optimizer {
+		return NewAdam([]core.Tensor{ab}, 0.01, WithGroup([]core.Tensor{cd}, 0.001, 0.1))
+	}
+	ab, cd := params(0, 0), params(0, 0)
+	opt := newAdam(ab, cd)
+	train(opt, ab, cd, 5)
+
+	state := opt.StateDict()
+	assert.Equal(t, []GroupState{{LR: 0.01, Params: 1}, {LR: 0.001, WeightDecay: 0.1, Params: 1}}, state.Groups)
+	assert.Equal(t, 5, state.Params[0].Step)
+	assert.Len(t, state.Params[1].Buffers["exp_avg_sq"], 2)
+	// the state is a copy
+	state.Params[0].Buffers["exp_avg"][0] = 100
+	assert.NotEqual(t, 100., opt.StateDict().Params[0].Buffers["exp_avg"][0])
+	state = opt.StateDict()
+
+	// through gob, like a checkpoint on disk
+	var buf bytes.Buffer
+	assert.Nil(t, gob.NewEncoder(&buf).Encode(state))
+	var loaded StateDict
+	assert.Nil(t, gob.NewDecoder(&buf).Decode(&loaded))
+
+	// resuming from the checkpoint gives the same trajectory as an uninterrupted training
+	ab2, cd2 := params(ab.Data()...), params(cd.Data()...)
+	resumed := NewAdam([]core.Tensor{ab2}, 0.5, WithGroup([]core.Tensor{cd2}, 0.5, 0))
+	resumed.LoadStateDict(loaded)
+	assert.Equal(t, 0.01, resumed.Groups()[0].LR)
+	train(opt, ab, cd, 5)
+	train(resumed, ab2, cd2, 5)
+	assert.Equal(t, ab.Data(), ab2.Data())
+	assert.Equal(t, cd.Data(), cd2.Data())
+
+	assert.Panics(t, func() { NewAdam([]core.Tensor{ab}, 0.01).LoadStateDict(loaded) })
+	assert.Panics(t, func() { newAdam(core.Zeros(3).SetRequiresGrad(true), cd).LoadStateDict(loaded) })
+}
+
+func TestGroups(t *testing.T) {
+	a, b := params(1, 1), params(1, 1)
+	// all the params in WithGroup
+	opt := NewSGD(nil, 0, WithGroup([]core.Tensor{a}, 0.1, 0), WithGroup([]core.Tensor{b}, 0.2, 0.5))
+	assert.Len(t, opt.Groups(), 2)
+
+	a.SumAll().Add(b.SumAll()).Backward()
+	opt.Step()
+	assert.Nil(t, core.EqualFloatArray(a.Data(), []float64{0.9, 0.9}, 1e-12))
+	// grad + wd * p = 1.5
+	assert.Nil(t, core.EqualFloatArray(b.Data(), []float64{0.7, 0.7}, 1e-12))
+
+	// the lr of a group can be changed between steps
+	opt.Groups()[0].LR = 1
+	opt.Step()
+	assert.Nil(t, core.EqualFloatArray(a.Data(), []float64{-0.1, -0.1}, 1e-12))
+}
+
+func TestSparseStepCount(t *testing.T) {
+	w := core.Ones(4, 2).SetRequiresGrad(true)
+	opt := NewAdam([]core.Tensor{w}, 0.1)
+	core.Embedding(w, core.NewTensor([]float64{1}), -1).Backward()
+	opt.Step()
+	opt.ZeroGrad()
+
+	// the gradient is allocated but holds no row, so neither the parameter nor its step count move
+	data := append([]float64{}, w.Data()...)
+	opt.Step()
+	assert.Equal(t, data, w.Data())
+	assert.Equal(t, 1, opt.StateDict().Params[0].Step)
+
+	core.Embedding(w, core.NewTensor([]float64{2}), -1).Backward()
+	opt.Step()
+	assert.Equal(t, 2, opt.StateDict().Params[0].Step)
+}
@@ -0,0 +1,70 @@
+package optim
+
+import (
+	"dexianta/tgnn/core"
+	"math"
+)
+
+// RMSprop divides the gradient by a running root mean square of the gradients
+//
+//	v = alpha * v + (1 - alpha) * grad^2
+//	p = p - lr * grad / (sqrt(v) + eps)
+//
+// with momentum, the scaled gradient is accumulated into a velocity b = momentum * b + grad / (sqrt(v) + eps), and
+// p = p - lr * b
+type RMSprop struct {
+	optimizer
+	Alpha, Eps, Momentum float64
+}
+
+// NewRMSprop creates a RMSprop, it supports the options WithAlpha (0.99 by default), WithEps (1e-8 by default),
+// WithMomentum, WithWeightDecay and WithGroup
+func NewRMSprop(params []core.Tensor, lr float64, opts ...Option) *RMSprop {
+	c := newConfig(append([]Option{WithAlpha(0.99), WithEps(1e-8)}, opts...))
+	return &RMSprop{optimizer: newOptimizer(params, lr, c), Alpha: c.alpha, Eps: c.eps, Momentum: c.momentum}
+}
+
+func (r *RMSprop) Step() {
+	r.step(false, func(g *Group, st *paramState, data, grad []float64, size, lo, hi int) {
+		v := st.buf("square_avg", size)[lo:hi]
+		var b []float64
+		if r.Momentum != 0 {
+			b = st.buf("momentum", size)[lo:hi]
+		}
+		for j := range data {
+			v[j] = r.Alpha*v[j] + (1-r.Alpha)*grad[j]*grad[j]
+			scaled := grad[j] / (math.Sqrt(v[j]) + r.Eps)
+			if b != nil {
+				b[j] = r.Momentum*b[j] + scaled
+				scaled = b[j]
+			}
+			data[j] -= g.LR * scaled
+		}
+	})
+}
+
+// Adagrad divides the gradient by the root of the sum of all the past squared gradients, so the elements with large
+// gradients slow down, and the step decays over the training
+//
+//	s = s + grad^2
+//	p = p - lr * grad / (sqrt(s) + eps)
+type Adagrad struct {
+	optimizer
+	Eps float64
+}
+
+// NewAdagrad creates an Adagrad, it supports the options WithEps (1e-10 by default), WithWeightDecay and WithGroup
+func NewAdagrad(params []core.Tensor, lr float64, opts ...Option) *Adagrad {
+	c := newConfig(append([]Option{WithEps(1e-10)}, opts...))
+	return &Adagrad{optimizer: newOptimizer(params, lr, c), Eps: c.eps}
+}
+
+func (a *Adagrad) Step() {
+	a.step(false, func(g *Group, st *paramState, data, grad []float64, size, lo, hi int) {
+		s := st.buf("sum", size)[lo:hi]
+		for j := range data {
+			s[j] += grad[j] * grad[j]
+			data[j] -= g.LR * grad[j] / (math.Sqrt(s[j]) + a.Eps)
+		}
+	})
+}
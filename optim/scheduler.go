@@ -0,0 +1,286 @@
+package optim
+
+import (
+	"fmt"
+	"math"
+)
+
+// Scheduler updates the LR of the groups of an optimizer as the training goes, e.g.
+//
+//	opt := optim.NewSGD(model.Parameters(), 0.1, optim.WithMomentum(0.9))
+//	sched := optim.NewCosineAnnealingWarmRestarts(opt, 10, 2)
+//	for epoch := ... {
+//		for ... {
+//			...
+//			opt.Step()
+//		}
+//		sched.Step()
+//	}
+//
+// the constructors set the LR of the first epoch, then Step moves to the next one. whether an epoch is a whole pass
+// over the data or a single batch only depends on where Step is called (OneCycle and LinearWarmup usually step every
+// batch). ReduceLROnPlateau doesn't implement Scheduler since its Step needs the metric of the epoch
+type Scheduler interface {
+	Step()
+	// LR returns the current LR of every group
+	LR() []float64
+	// StateDict returns the state of the scheduler, to be saved along the one of the optimizer, which LoadStateDict
+	// restores into a scheduler of the same type
+	StateDict() SchedulerState
+	LoadStateDict(s SchedulerState)
+}
+
+// SchedulerState is the state of a scheduler, made of plain values so it can be saved with encoding/gob
+type SchedulerState struct {
+	Epoch   int       // the number of calls to Step
+	BaseLRs []float64 // the LR of the groups when the scheduler was created
+	// ReduceLROnPlateau only
+	Best                float64
+	BadEpochs, Cooldown int
+}
+
+// scheduler sets the LR of every group to lr(base LR, epoch), and implements everything but the LR of the epochs
+type scheduler struct {
+	opt     Optimizer
+	baseLRs []float64
+	epoch   int
+	lr      func(base float64, epoch int) float64 // nil when the LR isn't a function of the epoch
+}
+
+func newScheduler(opt Optimizer) scheduler {
+	s := scheduler{opt: opt}
+	for _, g := range opt.Groups() {
+		s.baseLRs = append(s.baseLRs, g.LR)
+	}
+	return s
+}
+
+// apply sets the LR of the current epoch
+func (s *scheduler) apply() {
+	if s.lr == nil {
+		return
+	}
+	for i, g := range s.opt.Groups() {
+		g.LR = s.lr(s.baseLRs[i], s.epoch)
+	}
+}
+
+func (s *scheduler) Step() {
+	s.epoch++
+	s.apply()
+}
+
+func (s *scheduler) LR() []float64 {
+	var ret []float64
+	for _, g := range s.opt.Groups() {
+		ret = append(ret, g.LR)
+	}
+	return ret
+}
+
+func (s *scheduler) StateDict() SchedulerState {
+	return SchedulerState{Epoch: s.epoch, BaseLRs: append([]float64{}, s.baseLRs...)}
+}
+
+// LoadStateDict panics if s doesn't have a base LR for every group
+func (s *scheduler) LoadStateDict(st SchedulerState) {
+	if len(st.BaseLRs) != len(s.opt.Groups()) {
+		panic(fmt.Sprintf("scheduler state of %d groups doesn't match %d groups", len(st.BaseLRs),
+			len(s.opt.Groups())))
+	}
+	s.epoch, s.baseLRs = st.Epoch, append([]float64{}, st.BaseLRs...)
+	s.apply()
+}
+
+// StepLR multiplies the LR by Gamma every StepSize epochs
+type StepLR struct {
+	scheduler
+	StepSize int
+	Gamma    float64
+}
+
+func NewStepLR(opt Optimizer, stepSize int, gamma float64) *StepLR {
+	if stepSize <= 0 {
+		panic(fmt.Sprintf("invalid step size %d, it must be > 0", stepSize))
+	}
+	s := &StepLR{scheduler: newScheduler(opt), StepSize: stepSize, Gamma: gamma}
+	s.lr = func(base float64, epoch int) float64 {
+		return base * math.Pow(s.Gamma, float64(epoch/s.StepSize))
+	}
+	s.apply()
+	return s
+}
+
+// ExponentialLR multiplies the LR by Gamma every epoch
+type ExponentialLR struct {
+	scheduler
+	Gamma float64
+}
+
+func NewExponentialLR(opt Optimizer, gamma float64) *ExponentialLR {
+	s := &ExponentialLR{scheduler: newScheduler(opt), Gamma: gamma}
+	s.lr = func(base float64, epoch int) float64 {
+		return base * math.Pow(s.Gamma, float64(epoch))
+	}
+	s.apply()
+	return s
+}
+
+// CosineAnnealingWarmRestarts anneals the LR from the base LR to MinLR along a half cosine over Period epochs, then
+// restarts from the base LR with a period Mult times longer
+//
+//	lr = min + (base - min) * (1 + cos(pi * t / T)) / 2
+//
+// where t is the number of epochs since the last restart and T the current period. a Mult large enough to never
+// restart during the training gives a plain cosine annealing
+type CosineAnnealingWarmRestarts struct {
+	scheduler
+	Period, Mult int
+	MinLR        float64
+}
+
+// NewCosineAnnealingWarmRestarts creates a CosineAnnealingWarmRestarts, it supports the option WithMinLR
+func NewCosineAnnealingWarmRestarts(opt Optimizer, period, mult int, opts ...Option) *CosineAnnealingWarmRestarts {
+	if period < 1 || mult < 1 {
+		panic(fmt.Sprintf("invalid period %d or mult %d, they must be >= 1", period, mult))
+	}
+	c := newConfig(opts)
+	s := &CosineAnnealingWarmRestarts{scheduler: newScheduler(opt), Period: period, Mult: mult, MinLR: c.minLR}
+	s.lr = func(base float64, epoch int) float64 {
+		t, T := epoch, s.Period
+		for t >= T {
+			t -= T
+			T *= s.Mult
+		}
+		return s.MinLR + (base-s.MinLR)*(1+math.Cos(math.Pi*float64(t)/float64(T)))/2
+	}
+	s.apply()
+	return s
+}
+
+// OneCycle is the 1cycle policy: the LR goes up from max / DivFactor to max over the first PctStart of the
+// TotalSteps, then anneals down to max / (DivFactor * FinalDivFactor), both along half cosines. the max LR of every
+// group is its LR when the scheduler is created, and Step is meant to be called after every batch
+type OneCycle struct {
+	scheduler
+	TotalSteps                          int
+	PctStart, DivFactor, FinalDivFactor float64
+}
+
+// NewOneCycle creates a OneCycle, it supports the options WithPctStart and WithDivFactors. it panics when the warmup
+// doesn't last more than a step, and Step panics past the TotalSteps
+func NewOneCycle(opt Optimizer, totalSteps int, opts ...Option) *OneCycle {
+	c := newConfig(append([]Option{WithPctStart(0.3), WithDivFactors(25, 1e4)}, opts...))
+	// the warmup ends at the step PctStart * TotalSteps - 1 (see lr), which must be past the first one
+	if c.pctStart*float64(totalSteps)-1 <= 0 {
+		panic(fmt.Sprintf("invalid pct start %v of %d total steps, the warmup must last more than a step",
+			c.pctStart, totalSteps))
+	}
+	s := &OneCycle{scheduler: newScheduler(opt), TotalSteps: totalSteps, PctStart: c.pctStart,
+		DivFactor: c.divFactor, FinalDivFactor: c.finalDivFactor}
+	anneal := func(start, end, pct float64) float64 {
+		return end + (start-end)*(1+math.Cos(math.Pi*pct))/2
+	}
+	s.lr = func(max float64, epoch int) float64 {
+		if epoch > s.TotalSteps {
+			panic(fmt.Sprintf("OneCycle stepped %d times, past its %d steps", epoch, s.TotalSteps))
+		}
+		initial := max / s.DivFactor
+		// the last steps of the two phases, as in pytorch
+		up, down := s.PctStart*float64(s.TotalSteps)-1, float64(s.TotalSteps-1)
+		if e := float64(epoch); e <= up {
+			return anneal(initial, max, e/up)
+		}
+		return anneal(max, initial/s.FinalDivFactor, (float64(epoch)-up)/(down-up))
+	}
+	s.apply()
+	return s
+}
+
+// LinearWarmup scales the LR by a factor going linearly from StartFactor to 1 over the first Steps epochs, and
+// leaves the base LR after, to avoid the large updates of the first steps of adaptive optimizers like Adam
+type LinearWarmup struct {
+	scheduler
+	Steps       int
+	StartFactor float64
+}
+
+func NewLinearWarmup(opt Optimizer, steps int, startFactor float64) *LinearWarmup {
+	s := &LinearWarmup{scheduler: newScheduler(opt), Steps: steps, StartFactor: startFactor}
+	s.lr = func(base float64, epoch int) float64 {
+		if epoch >= s.Steps {
+			return base
+		}
+		return base * (s.StartFactor + (1-s.StartFactor)*float64(epoch)/float64(s.Steps))
+	}
+	s.apply()
+	return s
+}
+
+// ReduceLROnPlateau multiplies the LR by Factor when the metric given to Step (e.g. the validation loss) hasn't
+// improved for more than Patience epochs, down to MinLR. an epoch improves when the metric is lower than the best one
+// by a relative Threshold (or higher with WithMaximize). after a reduction, the bad epochs are only counted again
+// after Cooldown epochs
+type ReduceLROnPlateau struct {
+	scheduler
+	Factor    float64
+	Patience  int
+	Threshold float64
+	Cooldown  int
+	MinLR     float64
+	Maximize  bool
+
+	best                float64
+	badEpochs, cooldown int
+}
+
+// NewReduceLROnPlateau creates a ReduceLROnPlateau, it supports the options WithThreshold, WithCooldown, WithMinLR
+// and WithMaximize
+func NewReduceLROnPlateau(opt Optimizer, factor float64, patience int, opts ...Option) *ReduceLROnPlateau {
+	if factor >= 1 {
+		panic(fmt.Sprintf("invalid factor %v, it must be < 1", factor))
+	}
+	c := newConfig(append([]Option{WithThreshold(1e-4)}, opts...))
+	s := &ReduceLROnPlateau{scheduler: newScheduler(opt), Factor: factor, Patience: patience,
+		Threshold: c.threshold, Cooldown: c.cooldown, MinLR: c.minLR, Maximize: c.maximize}
+	s.best = s.worst()
+	return s
+}
+
+func (s *ReduceLROnPlateau) worst() float64 {
+	if s.Maximize {
+		return math.Inf(-1)
+	}
+	return math.Inf(1)
+}
+
+// Step records the metric of an epoch, and reduces the LR after too many epochs without improvement
+func (s *ReduceLROnPlateau) Step(metric float64) {
+	s.epoch++
+	if s.Maximize && metric > s.best*(1+s.Threshold) || !s.Maximize && metric < s.best*(1-s.Threshold) {
+		s.best, s.badEpochs = metric, 0
+	} else {
+		s.badEpochs++
+	}
+	if s.cooldown > 0 {
+		s.cooldown--
+		s.badEpochs = 0
+	}
+	if s.badEpochs > s.Patience {
+		for _, g := range s.opt.Groups() {
+			g.LR = math.Max(g.LR*s.Factor, s.MinLR)
+		}
+		s.cooldown, s.badEpochs = s.Cooldown, 0
+	}
+}
+
+func (s *ReduceLROnPlateau) StateDict() SchedulerState {
+	ret := s.scheduler.StateDict()
+	ret.Best, ret.BadEpochs, ret.Cooldown = s.best, s.badEpochs, s.cooldown
+	return ret
+}
+
+func (s *ReduceLROnPlateau) LoadStateDict(st SchedulerState) {
+	s.scheduler.LoadStateDict(st)
+	s.best, s.badEpochs, s.cooldown = st.Best, st.BadEpochs, st.Cooldown
+}
@@ -0,0 +1,132 @@
+package optim
+
+import (
+	"bytes"
+	"dexianta/tgnn/core"
+	"encoding/gob"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// lrs returns the LR of the first group over the first epochs of the scheduler
+func lrs(s Scheduler, epochs int) []float64 {
+	var ret []float64
+	for i := 0; i < epochs; i++ {
+		ret = append(ret, s.LR()[0])
+		s.Step()
+	}
+	return ret
+}
+
+func newOpt(lrs ...float64) Optimizer {
+	var opts []Option
+	for _, lr := range lrs[1:] {
+		opts = append(opts, WithGroup([]core.Tensor{core.Zeros(1)}, lr, 0))
+	}
+	return NewSGD([]core.Tensor{core.Zeros(1)}, lrs[0], opts...)
+}
+
+func TestSchedulers(t *testing.T) {
+	assert.Nil(t, core.EqualFloatArray(lrs(NewStepLR(newOpt(1), 2, 0.5), 6),
+		[]float64{1, 1, 0.5, 0.5, 0.25, 0.25}, 1e-15))
+	assert.Nil(t, core.EqualFloatArray(lrs(NewExponentialLR(newOpt(1), 0.5), 4),
+		[]float64{1, 0.5, 0.25, 0.125}, 1e-15))
+	// restarts at the epochs 2 and 6
+	assert.Nil(t, core.EqualFloatArray(lrs(NewCosineAnnealingWarmRestarts(newOpt(1), 2, 2, WithMinLR(0.1)), 8),
+		[]float64{1, 0.55, 1, 0.8681980515339464, 0.55, 0.23180194846605365, 1, 0.9657457896300791}, 1e-15))
+	// the values of torch.optim.lr_scheduler.OneCycleLR(max_lr=0.1, total_steps=10)
+	oneCycle := NewOneCycle(newOpt(0.1), 10)
+	assert.Nil(t, core.EqualFloatArray(lrs(oneCycle, 10), []float64{0.004, 0.052, 0.1, 0.09504846320134738,
+		0.0811745653949763, 0.06112620219362893, 0.03887419780637107, 0.0188258346050237, 0.004951936798652629,
+		4e-07}, 1e-15))
+	assert.Panics(t, func() { oneCycle.Step() })
+	// a warmup of a single step would give a NaN LR
+	assert.Panics(t, func() { NewOneCycle(newOpt(0.1), 2, WithPctStart(0.5)) })
+	assert.Panics(t, func() { NewOneCycle(newOpt(0.1), 10, WithPctStart(0)) })
+	assert.Panics(t, func() { NewStepLR(newOpt(1), 0, 0.5) })
+	assert.Nil(t, core.EqualFloatArray(lrs(NewLinearWarmup(newOpt(1), 4, 0.2), 6),
+		[]float64{0.2, 0.4, 0.6, 0.8, 1, 1}, 1e-15))
+
+	// every group is scheduled from its own LR
+	opt := newOpt(1, 0.1)
+	s := NewStepLR(opt, 1, 0.5)
+	s.Step()
+	assert.Equal(t, []float64{0.5, 0.05}, s.LR())
+	assert.Equal(t, 0.05, opt.Groups()[1].LR)
+}
+
+func TestReduceLROnPlateau(t *testing.T) {
+	opt := newOpt(1)
+	s := NewReduceLROnPlateau(opt, 0.5, 1, WithCooldown(1), WithMinLR(0.2))
+	var got []float64
+	for _, loss := range []float64{5, 4, 4, 4, 4, 4, 4, 4, 4, 4} {
+		s.Step(loss)
+		got = append(got, s.LR()[0])
+	}
+	// 2 bad epochs reduce the LR, then the cooldown epoch isn't counted, down to the min LR
+	assert.Equal(t, []float64{1, 1, 1, 0.5, 0.5, 0.5, 0.25, 0.25, 0.25, 0.2}, got)
+
+	// a negligible improvement is a bad epoch
+	s = NewReduceLROnPlateau(newOpt(1), 0.1, 0, WithThreshold(0.1))
+	s.Step(10)
+	s.Step(9.5)
+	assert.Nil(t, core.EqualFloatArray(s.LR(), []float64{0.1}, 1e-15))
+
+	s = NewReduceLROnPlateau(newOpt(1), 0.1, 0, WithMaximize())
+	s.Step(0.5)
+	s.Step(0.6)
+	assert.Equal(t, []float64{1}, s.LR())
+	s.Step(0.4)
+	assert.Nil(t, core.EqualFloatArray(s.LR(), []float64{0.1}, 1e-15))
+}
+
+// the states of an optimizer and its scheduler saved together in a checkpoint
+type checkpoint struct {
+	Optimizer StateDict
+	Scheduler SchedulerState
+}
+
+func TestSchedulerStateDict(t *testing.T) {
+	ab, cd := params(0, 0), params(0, 0)
+	opt := NewAdam([]core.Tensor{ab}, 0.01, WithGroup([]core.Tensor{cd}, 0.001, 0))
+	s := NewCosineAnnealingWarmRestarts(opt, 4, 2)
+	for i := 0; i < 5; i++ {
+		train(opt, ab, cd, 1)
+		s.Step()
+	}
+
+	var buf bytes.Buffer
+	assert.Nil(t, gob.NewEncoder(&buf).Encode(checkpoint{opt.StateDict(), s.StateDict()}))
+	var c checkpoint
+	assert.Nil(t, gob.NewDecoder(&buf).Decode(&c))
+
+	ab2, cd2 := params(ab.Data()...), params(cd.Data()...)
+	opt2 := NewAdam([]core.Tensor{ab2}, 1, WithGroup([]core.Tensor{cd2}, 1, 0))
+	s2 := NewCosineAnnealingWarmRestarts(opt2, 4, 2)
+	opt2.LoadStateDict(c.Optimizer)
+	s2.LoadStateDict(c.Scheduler)
+	assert.Equal(t, s.LR(), s2.LR())
+	for i := 0; i < 5; i++ {
+		train(opt, ab, cd, 1)
+		s.Step()
+		train(opt2, ab2, cd2, 1)
+		s2.Step()
+	}
+	assert.Equal(t, s.LR(), s2.LR())
+	assert.Equal(t, ab.Data(), ab2.Data())
+	assert.Equal(t, cd.Data(), cd2.Data())
+	assert.Panics(t, func() { NewStepLR(newOpt(1), 1, 0.5).LoadStateDict(c.Scheduler) })
+
+	p := NewReduceLROnPlateau(newOpt(1), 0.5, 2)
+	p.Step(3)
+	p.Step(4)
+	p2 := NewReduceLROnPlateau(newOpt(1), 0.5, 2)
+	p2.LoadStateDict(p.StateDict())
+	for _, loss := range []float64{4, 4} {
+		p.Step(loss)
+		p2.Step(loss)
+	}
+	assert.Equal(t, []float64{0.5}, p.LR())
+	assert.Equal(t, p.LR(), p2.LR())
+}
@@ -0,0 +1,41 @@
+package optim
+
+import "dexianta/tgnn/core"
+
+// SGD is the stochastic gradient descent with momentum
+//
+//	v = momentum * v + grad
+//	p = p - lr * v
+//
+// with Nesterov momentum the update looks ahead along the velocity: p = p - lr * (grad + momentum * v)
+type SGD struct {
+	optimizer
+	Momentum float64
+	Nesterov bool
+}
+
+// NewSGD creates a SGD, it supports the options WithMomentum, WithNesterov, WithWeightDecay and WithGroup
+func NewSGD(params []core.Tensor, lr float64, opts ...Option) *SGD {
+	c := newConfig(opts)
+	return &SGD{optimizer: newOptimizer(params, lr, c), Momentum: c.momentum, Nesterov: c.nesterov}
+}
+
+func (s *SGD) Step() {
+	s.step(false, func(g *Group, st *paramState, data, grad []float64, size, lo, hi int) {
+		if s.Momentum == 0 {
+			for j := range data {
+				data[j] -= g.LR * grad[j]
+			}
+			return
+		}
+		v := st.buf("momentum", size)[lo:hi]
+		for j := range data {
+			v[j] = s.Momentum*v[j] + grad[j]
+			if s.Nesterov {
+				data[j] -= g.LR * (grad[j] + s.Momentum*v[j])
+			} else {
+				data[j] -= g.LR * v[j]
+			}
+		}
+	})
+}
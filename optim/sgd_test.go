@@ -0,0 +1,67 @@
+package optim
+
+import (
+	"dexianta/tgnn/core"
+	"dexianta/tgnn/nn"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSGD(t *testing.T) {
+	p := core.NewTensor([]float64{1, 2}).SetRequiresGrad(true)
+	opt := NewSGD([]core.Tensor{p}, 0.1, WithMomentum(0.5))
+
+	// the gradient of sum(p^2) is 2p
+	p.Pow(2).Backward()
+	opt.Step()
+	assert.Nil(t, core.EqualFloatArray(p.Data(), []float64{0.8, 1.6}, 1e-12))
+	opt.ZeroGrad()
+	assert.Nil(t, core.EqualFloatArray(p.Grad(), []float64{0, 0}, 0))
+
+	// v = 0.5 * 2 + 1.6 = 2.6 for the first element
+	p.Pow(2).Backward()
+	opt.Step()
+	assert.Nil(t, core.EqualFloatArray(p.Data(), []float64{0.8 - 0.1*2.6, 1.6 - 0.1*5.2}, 1e-12))
+
+	// a parameter without gradient is left as is
+	q := core.Ones(2).SetRequiresGrad(true)
+	NewSGD([]core.Tensor{q}, 0.1).Step()
+	assert.Nil(t, core.EqualFloatArray(q.Data(), []float64{1, 1}, 0))
+}
+
+func TestSparseSGD(t *testing.T) {
+	w := core.Ones(4, 2).SetRequiresGrad(true)
+	opt := NewSGD([]core.Tensor{w}, 1, WithMomentum(0.5))
+
+	core.Embedding(w, core.NewTensor([]float64{1, 3, 1}), -1).Backward()
+	opt.Step()
+	assert.Nil(t, core.EqualFloatArray(w.Data(), []float64{1, 1, -1, -1, 1, 1, 0, 0}, 0))
+	opt.ZeroGrad()
+
+	// only the row looked up moves, the momentum of the others waits for their next gradient
+	core.Embedding(w, core.NewTensor([]float64{0}), -1).Backward()
+	opt.Step()
+	assert.Nil(t, core.EqualFloatArray(w.Data(), []float64{0, 0, -1, -1, 1, 1, 0, 0}, 0))
+	opt.ZeroGrad()
+
+	core.Embedding(w, core.NewTensor([]float64{1}), -1).Backward()
+	opt.Step()
+	assert.Nil(t, core.EqualFloatArray(w.Data(), []float64{0, 0, -3, -3, 1, 1, 0, 0}, 0))
+}
+
+// the weight of a convolution is reshaped by the forward pass, before the ZeroGrad in the order of pytorch
+func TestSGDZeroGradAfterForward(t *testing.T) {
+	conv := nn.NewConv2d(1, 2, 2)
+	before := append([]float64{}, conv.Weight.Contiguous().Data()...)
+	opt := NewSGD(conv.Parameters(), 0.1)
+
+	out := conv.Forward(core.Ones(1, 1, 3, 3))
+	opt.ZeroGrad()
+	out.Backward()
+	opt.Step()
+	// every input is 1, so the gradient of every weight is the 4 positions of the output
+	for i, w := range conv.Weight.Contiguous().Data() {
+		assert.InDelta(t, before[i]-0.4, w, 1e-12)
+	}
+}
@@ -0,0 +1,44 @@
+package util
+
+import "math"
+
+func Sum[T ~int | ~float64](arr []T) (ret T) {
+	for _, t := range arr {
+		ret += t
+	}
+	return
+}
+
+func Sign(x float64) float64 {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
+
+// Sigmoid is 1 / (1 + e^-x), computed so it doesn't overflow
+func Sigmoid(x float64) float64 {
+	// exp only for non positive numbers
+	if x >= 0 {
+		return 1 / (1 + math.Exp(-x))
+	}
+	e := math.Exp(x)
+	return e / (1 + e)
+}
+
+func Imin(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func Imax(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}